@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+)
+
+// checkpointIgnoredFlags contains the flags that do not change the information fetched about the buckets, and can thus differ
+// between a scan and its resumption from a checkpoint
+var checkpointIgnoredFlags = map[string]bool{
+	"bucket-timeout":      true,
+	"bucket-workers":      true,
+	"checkpoint":          true,
+	"config":              true,
+	"limit":               true,
+	"max-retries":         true,
+	"output":              true,
+	"preset":              true,
+	"storage-class-basis": true,
+	"timeout":             true,
+	"unit":                true,
+	"workers":             true,
+}
+
+// checkpointFlags returns the value of every flag the checkpoint of a scan is bound to, i.e. every flag but the checkpointIgnoredFlags
+// It must be called once the configuration file has been applied, since its values change the scan as much as the command line's
+func checkpointFlags(fs *flag.FlagSet) map[string]string {
+	flags := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !checkpointIgnoredFlags[f.Name] {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
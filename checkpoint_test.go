@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("checkpoint", "", "")
+	fs.String("output", "table", "")
+	fs.Int("workers", 10, "")
+	fs.Bool("versions", false, "")
+	fs.String("where", "", "")
+	if err := fs.Parse([]string{"-checkpoint", "scan.json", "-output", "csv", "-where", `size > 1GB`}); err != nil {
+		t.Fatalf("checkpointFlags(): FAILED, Expected valid arguments - Received: %v", err)
+	}
+
+	expected := map[string]string{"versions": "false", "where": "size > 1GB"}
+	flags := checkpointFlags(fs)
+	if !reflect.DeepEqual(flags, expected) {
+		t.Errorf("checkpointFlags(): FAILED, Expected: %v - Received: %v", expected, flags)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+// fetchGroup is a set of bucket information fetched together by the scanner
+type fetchGroup int
+
+const (
+	fetchNone fetchGroup = iota
+	fetchObjects
+	fetchVersions
+	fetchMultipart
+	fetchSecurity
+	fetchConfiguration
+	fetchCost
+)
+
+// column is a column of the table, markdown and csv outputs
+// header and value format the column for the table and markdown outputs while csvFields are the csvHeader fields it maps to
+type column struct {
+	name        string
+	description string
+	fetch       fetchGroup
+	header      func(options printOptions) string
+	value       func(bucket *s3.Bucket, options printOptions) string
+	csvFields   []string
+}
+
+// columns contains every column that can be selected with '-columns', in the order used by '-columns all'
+var columns = []column{
+	{"profile", "The profile the bucket was found with", fetchNone,
+		fixedHeader("PROFILE"), func(b *s3.Bucket, _ printOptions) string { return b.Profile }, []string{"profile"}},
+	{"account", "The ID of the account owning the bucket", fetchNone,
+		fixedHeader("ACCOUNT"), func(b *s3.Bucket, _ printOptions) string { return b.Account }, []string{"account"}},
+	{"name", "The bucket's name, followed by (incomplete) if its information could not all be fetched", fetchNone,
+		fixedHeader("NAME"), tableName, []string{"name"}},
+	{"region", "The bucket's region", fetchNone,
+		fixedHeader("REGION"), func(b *s3.Bucket, _ printOptions) string { return b.Region }, []string{"region"}},
+	{"cost", "The bucket's cost over the -costperiod", fetchCost,
+		func(o printOptions) string { return "COST $USD(" + strconv.Itoa(o.CostPeriod) + "days)" }, tableCost, []string{"cost", "cost_period_days", "cost_unattributed"}},
+	{"size", "The total size of the current versions of the objects, prefixed with ~ and followed by its confidence interval if estimated with -sample", fetchObjects,
+		sizeHeader("TOTAL SIZE"), tableObjectsSize, []string{"size_bytes"}},
+	{"files", "The number of objects, not counting their previous versions, prefixed with ~ and followed by its confidence interval if estimated with -sample", fetchObjects,
+		fixedHeader("NUMBER OF FILES"), tableObjectCount, []string{"object_count"}},
+	{"storageclasses", "The share of the objects in every storage class, by count or by size depending on -storage-class-basis", fetchObjects,
+		storageClassesHeader, tableStorageClasses, []string{"storage_classes_stats", "storage_classes_size_stats"}},
+	{"storageclassbytes", "The total size of the current versions of the objects in every storage class", fetchObjects,
+		sizeHeader("STORAGE CLASSES SIZE"), func(b *s3.Bucket, o printOptions) string {
+			return tableEstimate(b, formatStorageClassesSize(b.StorageClassesBytes, o.SizeUnit), "", "")
+		}, []string{"storage_classes_bytes"}},
+	{"created", "The bucket's creation date", fetchNone,
+		fixedHeader("CREATED ON"), func(b *s3.Bucket, _ printOptions) string { return b.CreationDate.Format("02-01-2006") }, []string{"creation_date"}},
+	{"modified", "The last modification date of the bucket's objects", fetchObjects,
+		fixedHeader("LAST MODIFIED"), tableLastModified, []string{"last_modified"}},
+	{"incomplete", "Whether the bucket's information could not all be fetched", fetchNone,
+		fixedHeader("INCOMPLETE"), func(b *s3.Bucket, _ printOptions) string { return formatTableBool(&b.Incomplete) }, []string{"incomplete"}},
+	{"estimated", "Whether the objects metrics were estimated from a sample of the objects with -sample, LOWER BOUND if the requests ran out first", fetchObjects,
+		fixedHeader("ESTIMATED"), tableEstimated, []string{"estimated", "object_count_low", "object_count_high", "size_bytes_low", "size_bytes_high"}},
+	{"noncurrentsize", "The total size of the previous versions of the objects", fetchVersions,
+		sizeHeader("NONCURRENT SIZE"), func(b *s3.Bucket, o printOptions) string { return tableSize(b.NoncurrentSizeBytes, o) }, []string{"noncurrent_size_bytes"}},
+	{"noncurrentfiles", "The number of previous versions of the objects", fetchVersions,
+		fixedHeader("NONCURRENT FILES"), func(b *s3.Bucket, _ printOptions) string { return strconv.Itoa(b.NoncurrentObjectCount) }, []string{"noncurrent_object_count"}},
+	{"noncurrentshare", "The share of the versions that are noncurrent in every storage class", fetchVersions,
+		fixedHeader("NONCURRENT SHARE"), func(b *s3.Bucket, _ printOptions) string {
+			return formatStorageClasses(b.NoncurrentStorageClassesStats)
+		}, []string{"noncurrent_storage_classes_stats"}},
+	{"deletemarkers", "The number of delete markers", fetchVersions,
+		fixedHeader("DELETE MARKERS"), func(b *s3.Bucket, _ printOptions) string { return strconv.Itoa(b.DeleteMarkerCount) }, []string{"delete_marker_count"}},
+	{"uploads", "The number of incomplete multipart uploads", fetchMultipart,
+		fixedHeader("INCOMPLETE UPLOADS"), func(b *s3.Bucket, _ printOptions) string { return strconv.Itoa(b.IncompleteUploadCount) }, []string{"incomplete_upload_count"}},
+	{"uploadsize", "The total size of the incomplete multipart uploads' parts", fetchMultipart,
+		sizeHeader("UPLOADS SIZE"), func(b *s3.Bucket, o printOptions) string { return tableSize(b.IncompleteUploadSizeBytes, o) }, []string{"incomplete_upload_size_bytes"}},
+	{"oldestupload", "The initiation date of the oldest incomplete multipart upload", fetchMultipart,
+		fixedHeader("OLDEST UPLOAD"), tableOldestUpload, []string{"oldest_upload_initiated"}},
+	{"encryption", "The default encryption algorithm, NONE if the bucket is not encrypted by default", fetchSecurity,
+		fixedHeader("ENCRYPTION"), tableEncryption, []string{"encryption"}},
+	{"publicaccessblock", "Whether all the settings of the public access block are enabled", fetchSecurity,
+		fixedHeader("PUBLIC ACCESS BLOCK"), securityValue(func(r bucketRecord) string { return formatTableBool(r.PublicAccessBlocked) }), []string{"public_access_blocked"}},
+	{"publicpolicy", "Whether the bucket's policy makes it public", fetchSecurity,
+		fixedHeader("PUBLIC POLICY"), securityValue(func(r bucketRecord) string { return formatTableBool(r.PolicyIsPublic) }), []string{"policy_is_public"}},
+	{"aclgrants", "The grants of the bucket's ACL, formatted as grantee:PERMISSION", fetchSecurity,
+		fixedHeader("ACL GRANTS"), tableACLGrants, []string{"acl_grants", "acl_is_public"}},
+	{"public", "Whether the bucket is public, i.e. its policy or ACL is public and not prevented by the public access block", fetchSecurity,
+		fixedHeader("PUBLIC"), securityValue(func(r bucketRecord) string { return formatTableBool(r.Public) }), []string{"public"}},
+	{"securityerrors", "The errors that happened fetching the security settings", fetchSecurity,
+		fixedHeader("SECURITY ERRORS"), securityValue(func(r bucketRecord) string { return formatTableErrors(r.SecurityErrors) }), []string{"security_errors"}},
+	{"lifecyclerules", "The number of enabled lifecycle rules", fetchConfiguration,
+		fixedHeader("LIFECYCLE RULES"), lifecycleValue(func(r bucketRecord) string { return strconv.Itoa(*r.LifecycleRuleCount) }), []string{"lifecycle_rule_count"}},
+	{"expiresobjects", "Whether a lifecycle rule expires the objects", fetchConfiguration,
+		fixedHeader("EXPIRES OBJECTS"), configurationValue(func(r bucketRecord) string { return formatTableBool(r.LifecycleExpiresObjects) }), []string{"lifecycle_expires_objects"}},
+	{"transitions", "The storage classes the lifecycle rules transition the objects to", fetchConfiguration,
+		fixedHeader("TRANSITIONS"), lifecycleValue(func(r bucketRecord) string { return formatTableList(r.LifecycleTransitions) }), []string{"lifecycle_transitions"}},
+	{"noncurrentexpiration", "Whether a lifecycle rule expires the previous versions of the objects", fetchConfiguration,
+		fixedHeader("NONCURRENT EXPIRATION"), configurationValue(func(r bucketRecord) string { return formatTableBool(r.LifecycleNoncurrentExpiration) }), []string{"lifecycle_noncurrent_expiration"}},
+	{"abortuploads", "The number of days after which the incomplete multipart uploads are aborted", fetchConfiguration,
+		fixedHeader("ABORT UPLOADS AFTER"), lifecycleValue(tableAbortUploads), []string{"lifecycle_abort_uploads_days"}},
+	{"replicationdestinations", "The buckets the objects are replicated to", fetchConfiguration,
+		fixedHeader("REPLICATION DESTINATIONS"), replicationValue(func(r bucketRecord) string { return formatTableList(r.ReplicationDestinations) }), []string{"replication_destinations"}},
+	{"replicationregions", "The regions the objects are replicated to", fetchConfiguration,
+		fixedHeader("REPLICATION REGIONS"), replicationValue(func(r bucketRecord) string { return formatTableList(r.ReplicationRegions) }), []string{"replication_regions"}},
+	{"configurationerrors", "The errors that happened fetching the lifecycle and replication configurations", fetchConfiguration,
+		fixedHeader("CONFIGURATION ERRORS"), configurationValue(func(r bucketRecord) string { return formatTableErrors(r.ConfigurationErrors) }), []string{"configuration_errors"}},
+}
+
+// lookupColumn returns the column with the provided name
+func lookupColumn(name string) (column, bool) {
+	for _, c := range columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// parseColumnsFlag parses the comma separated '-columns' flag, 'all' selecting every column
+func parseColumnsFlag(columnsFlag string) ([]string, error) {
+	if strings.ToLower(strings.TrimSpace(columnsFlag)) == "all" {
+		names := make([]string, 0, len(columns))
+		for _, c := range columns {
+			names = append(names, c.name)
+		}
+		return names, nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(columnsFlag, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := lookupColumn(name); !ok {
+			return nil, fmt.Errorf("Error - '%v' is not a valid '-columns' value, use '-columns help' to list the valid columns", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Error - the '%v' column is used more than once in '-columns'", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// columnsFetches returns the information the columns need to be fetched
+func columnsFetches(names []string) map[fetchGroup]bool {
+	fetches := map[fetchGroup]bool{}
+	for _, name := range names {
+		c, _ := lookupColumn(name)
+		fetches[c.fetch] = true
+	}
+	return fetches
+}
+
+// printColumnsHelp outputs every column along with its description
+func printColumnsHelp(w io.Writer) {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "COLUMN\tDESCRIPTION")
+	for _, c := range columns {
+		fmt.Fprintf(writer, "%v\t%v\n", c.name, c.description)
+	}
+	writer.Flush()
+}
+
+// defaultColumns returns the columns shown when '-columns' is not passed, depending on the information that was fetched
+// The profile and account columns are only added if the buckets come from several accounts or profiles
+func defaultColumns(options printOptions) []string {
+	names := []string{"name", "region", "cost", "size", "files", "storageclasses", "created", "modified"}
+	if options.Accounts {
+		names = append([]string{"profile", "account"}, names...)
+	}
+	if options.Versions {
+		names = append(names, "noncurrentsize", "noncurrentfiles", "noncurrentshare", "deletemarkers")
+	}
+	if options.MultipartUploads {
+		names = append(names, "uploads", "uploadsize", "oldestupload")
+	}
+	if options.Security {
+		names = append(names, "encryption", "publicaccessblock", "publicpolicy", "aclgrants", "public")
+	}
+	if options.Configuration {
+		names = append(names, "lifecyclerules", "expiresobjects", "transitions", "noncurrentexpiration", "abortuploads", "replicationdestinations", "replicationregions")
+	}
+	return names
+}
+
+// selectedColumns returns the columns to output: the '-columns' ones if any, the default ones otherwise
+func selectedColumns(options printOptions) []column {
+	names := options.Columns
+	if len(names) == 0 {
+		names = defaultColumns(options)
+	}
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		if c, ok := lookupColumn(name); ok {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+// fixedHeader returns a header function always returning the provided header
+func fixedHeader(header string) func(printOptions) string {
+	return func(printOptions) string { return header }
+}
+
+// sizeHeader returns a header function appending the size unit to the provided header
+func sizeHeader(header string) func(printOptions) string {
+	return func(o printOptions) string { return header + " (" + strings.ToUpper(o.SizeUnit) + ")" }
+}
+
+// tableName returns the bucket's name, flagging the buckets whose information could not all be fetched
+func tableName(b *s3.Bucket, _ printOptions) string {
+	if b.Incomplete {
+		return b.Name + " (incomplete)"
+	}
+	return b.Name
+}
+
+// tableCost returns the bucket's cost, N/A if it could not be fetched and UNATTRIBUTED if no cost is tagged with the bucket's name
+func tableCost(b *s3.Bucket, _ printOptions) string {
+	if b.CostUnattributed {
+		return "UNATTRIBUTED"
+	}
+	if b.Cost <= 0 {
+		return "N/A"
+	}
+	return fmt.Sprintf("%f", b.Cost)
+}
+
+// tableSize returns a size converted to the '-unit' unit
+func tableSize(sizeBytes int64, options printOptions) string {
+	return fmt.Sprintf("%.2f", convertSize(sizeBytes, options.SizeUnit))
+}
+
+// tableObjectsSize returns the total size of the objects, along with its confidence interval if estimated
+func tableObjectsSize(b *s3.Bucket, o printOptions) string {
+	if b.Estimate == nil {
+		return tableSize(b.SizeBytes, o)
+	}
+	return tableEstimate(b, tableSize(b.SizeBytes, o), tableSize(b.Estimate.SizeBytesLow, o), tableSize(b.Estimate.SizeBytesHigh, o))
+}
+
+// tableObjectCount returns the number of objects, along with its confidence interval if estimated
+func tableObjectCount(b *s3.Bucket, _ printOptions) string {
+	if b.Estimate == nil {
+		return strconv.Itoa(b.ObjectCount)
+	}
+	return tableEstimate(b, strconv.Itoa(b.ObjectCount), strconv.Itoa(b.Estimate.ObjectCountLow), strconv.Itoa(b.Estimate.ObjectCountHigh))
+}
+
+// tableEstimate marks an objects metric estimated from a sample of the objects: prefixed with ~ and followed by its confidence interval
+// from low to high, if any, or prefixed with >= when it is only a lower bound
+func tableEstimate(b *s3.Bucket, value, low, high string) string {
+	switch {
+	case b.Estimate == nil || value == "":
+		return value
+	case b.Estimate.LowerBound:
+		return ">=" + value
+	case low == "":
+		return "~" + value
+	}
+	return fmt.Sprintf("~%v (%v-%v)", value, low, high)
+}
+
+// tableEstimated returns whether the objects metrics were estimated, LOWER BOUND if they only count the objects listed
+func tableEstimated(b *s3.Bucket, _ printOptions) string {
+	if b.Estimate != nil && b.Estimate.LowerBound {
+		return "LOWER BOUND"
+	}
+	estimated := b.Estimate != nil
+	return formatTableBool(&estimated)
+}
+
+// storageClassesHeader returns the header of the storage classes column, flagging the shares computed on the size of the objects
+func storageClassesHeader(o printOptions) string {
+	if o.StorageClassBasis == storageClassBasisBytes {
+		return "STORAGE CLASSES (BYTES)"
+	}
+	return "STORAGE CLASSES"
+}
+
+// tableStorageClasses returns the share of every storage class, computed on the number or on the size of the objects
+func tableStorageClasses(b *s3.Bucket, o printOptions) string {
+	if o.StorageClassBasis == storageClassBasisBytes {
+		return tableEstimate(b, formatStorageClasses(b.StorageClassesSizeStats), "", "")
+	}
+	return tableEstimate(b, formatStorageClasses(b.StorageClassesStats), "", "")
+}
+
+// tableLastModified returns the last modification date of the objects, N/A if unknown, e.g. for an empty bucket or with the CloudWatch metrics
+// It is prefixed with >= when estimated, being the latest date of the sampled objects only
+func tableLastModified(b *s3.Bucket, _ printOptions) string {
+	if b.Estimate != nil && !b.LastModified.IsZero() {
+		return ">=" + formatTableDate(b.LastModified)
+	}
+	return formatTableDate(b.LastModified)
+}
+
+// tableOldestUpload returns the initiation date of the oldest incomplete multipart upload, N/A if there is none
+func tableOldestUpload(b *s3.Bucket, _ printOptions) string {
+	return formatTableDate(b.OldestUploadInitiated)
+}
+
+// formatTableDate formats a date for the table output, returning N/A for the zero date
+func formatTableDate(date time.Time) string {
+	if date.IsZero() {
+		return "N/A"
+	}
+	return date.Format("02-01-2006")
+}
+
+// tableEncryption returns the default encryption algorithm, NONE if the bucket is not encrypted by default and N/A if unknown
+func tableEncryption(b *s3.Bucket, _ printOptions) string {
+	record := bucketRecord{}
+	setSecurityFields(&record, b)
+	if record.Encryption == nil {
+		return "N/A"
+	}
+	if *record.Encryption == "" {
+		return "NONE"
+	}
+	return *record.Encryption
+}
+
+// tableACLGrants returns the ACL grants, N/A if they could not be fetched
+func tableACLGrants(b *s3.Bucket, _ printOptions) string {
+	record := bucketRecord{}
+	setSecurityFields(&record, b)
+	if record.ACLGrants == nil {
+		return "N/A"
+	}
+	return strings.Join(record.ACLGrants, " ")
+}
+
+// tableAbortUploads returns after how many days the incomplete multipart uploads are aborted, NEVER if they are not
+func tableAbortUploads(r bucketRecord) string {
+	if *r.LifecycleAbortUploadsDays > 0 {
+		return strconv.Itoa(*r.LifecycleAbortUploadsDays) + " days"
+	}
+	return "NEVER"
+}
+
+// formatTableErrors formats the errors recorded per field for the table output, returning NONE if there is none
+func formatTableErrors(errors map[string]string) string {
+	if len(errors) == 0 {
+		return "NONE"
+	}
+	return strings.Replace(formatErrorsCSV(errors), ";", " ", -1)
+}
+
+// securityValue returns a value function formatting the security fields of the bucket's record
+func securityValue(format func(r bucketRecord) string) func(*s3.Bucket, printOptions) string {
+	return func(b *s3.Bucket, _ printOptions) string {
+		record := bucketRecord{}
+		setSecurityFields(&record, b)
+		return format(record)
+	}
+}
+
+// configurationValue returns a value function formatting the lifecycle and replication fields of the bucket's record
+func configurationValue(format func(r bucketRecord) string) func(*s3.Bucket, printOptions) string {
+	return func(b *s3.Bucket, _ printOptions) string {
+		record := bucketRecord{}
+		setConfigurationFields(&record, b)
+		return format(record)
+	}
+}
+
+// lifecycleValue is a configurationValue returning N/A if the lifecycle configuration could not be fetched
+func lifecycleValue(format func(r bucketRecord) string) func(*s3.Bucket, printOptions) string {
+	return configurationValue(func(r bucketRecord) string {
+		if r.LifecycleRuleCount == nil {
+			return "N/A"
+		}
+		return format(r)
+	})
+}
+
+// replicationValue is a configurationValue returning N/A if the replication configuration could not be fetched
+func replicationValue(format func(r bucketRecord) string) func(*s3.Bucket, printOptions) string {
+	return configurationValue(func(r bucketRecord) string {
+		if r.ReplicationDestinations == nil {
+			return "N/A"
+		}
+		return format(r)
+	})
+}
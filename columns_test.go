@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnsFlag(t *testing.T) {
+	var tests = []struct {
+		columnsFlag string
+		expected    []string
+		err         bool
+	}{
+		{
+			columnsFlag: "name, Cost,size",
+			expected:    []string{"name", "cost", "size"},
+			err:         false,
+		},
+		{
+			columnsFlag: "public,name",
+			expected:    []string{"public", "name"},
+			err:         false,
+		},
+		{
+			columnsFlag: "name,colour",
+			expected:    nil,
+			err:         true,
+		},
+		{
+			columnsFlag: "name,cost,name",
+			expected:    nil,
+			err:         true,
+		},
+		{
+			columnsFlag: "name,",
+			expected:    nil,
+			err:         true,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := parseColumnsFlag(test.columnsFlag)
+		if err != nil && test.err == false {
+			t.Errorf("parseColumnsFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("parseColumnsFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseColumnsFlag(): FAILED, Expected: %v - Received: %v", test.expected, result)
+		}
+	}
+
+	all, err := parseColumnsFlag("all")
+	if err != nil || len(all) != len(columns) {
+		t.Errorf("parseColumnsFlag(): FAILED, Expected %v columns - Received: %v, %v", len(columns), len(all), err)
+	}
+}
+
+func TestColumnsCSVFields(t *testing.T) {
+	seen := map[string]int{}
+	for _, c := range columns {
+		for _, field := range c.csvFields {
+			seen[field]++
+		}
+	}
+	for _, field := range csvHeader {
+		if seen[field] != 1 {
+			t.Errorf("columns: FAILED, Expected the '%v' csv field to be used by one column - Received: %v", field, seen[field])
+		}
+	}
+}
+
+func TestColumnsFetches(t *testing.T) {
+	var tests = []struct {
+		names    []string
+		expected map[fetchGroup]bool
+	}{
+		{
+			names:    []string{"name", "region"},
+			expected: map[fetchGroup]bool{fetchNone: true},
+		},
+		{
+			names:    []string{"name", "size", "cost"},
+			expected: map[fetchGroup]bool{fetchNone: true, fetchObjects: true, fetchCost: true},
+		},
+		{
+			names:    []string{"deletemarkers", "public", "transitions"},
+			expected: map[fetchGroup]bool{fetchVersions: true, fetchSecurity: true, fetchConfiguration: true},
+		},
+	}
+
+	for _, test := range tests {
+		result := columnsFetches(test.names)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("columnsFetches(): FAILED, Expected: %v - Received: %v", test.expected, result)
+		}
+	}
+}
+
+func TestDefaultColumns(t *testing.T) {
+	expected := []string{"profile", "account", "name", "region", "cost", "size", "files", "storageclasses", "created", "modified", "uploads", "uploadsize", "oldestupload"}
+	result := defaultColumns(printOptions{Accounts: true, MultipartUploads: true})
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("defaultColumns(): FAILED, Expected: %v - Received: %v", expected, result)
+	}
+}
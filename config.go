@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultConfigFilename is the name of the configuration file looked up in the user's home directory when '-config' is not passed
+const defaultConfigFilename = ".bucket-digger.json"
+
+// config is the content of a configuration file
+// Its defaults and presets map flag names (e.g. 'workers') to their value, a preset's values overriding the defaults
+type config struct {
+	Defaults map[string]interface{}            `json:"defaults"`
+	Presets  map[string]map[string]interface{} `json:"presets"`
+}
+
+// defaultConfigPath returns the path of the configuration file in the user's home directory
+func defaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, defaultConfigFilename), nil
+}
+
+// parseConfig reads a JSON configuration file, rejecting the unknown fields
+func parseConfig(r io.Reader) (*config, error) {
+	var c config
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// values returns the flag values of the defaults merged with the ones of the preset, if any, formatted as they would be on the command line
+func (c *config) values(preset string) (map[string]string, error) {
+	values := map[string]string{}
+	sources := []map[string]interface{}{c.Defaults}
+	if preset != "" {
+		presetValues, ok := c.Presets[preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset '%v', available presets: %v", preset, strings.Join(c.presetNames(), ", "))
+		}
+		sources = append(sources, presetValues)
+	}
+
+	for _, source := range sources {
+		for name, value := range source {
+			switch v := value.(type) {
+			case string:
+				values[name] = v
+			case json.Number:
+				values[name] = v.String()
+			case bool:
+				values[name] = fmt.Sprint(v)
+			default:
+				return nil, fmt.Errorf("invalid value for '%v', expected a string, a number or a boolean", name)
+			}
+		}
+	}
+	return values, nil
+}
+
+// presetNames returns the sorted names of the presets
+func (c *config) presetNames() []string {
+	names := make([]string, 0, len(c.Presets))
+	for name := range c.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// passedFlags returns the names of the flags that were set, which are the ones passed on the command line until the configuration file is applied
+func passedFlags(flagSet *flag.FlagSet) map[string]bool {
+	passed := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		passed[f.Name] = true
+	})
+	return passed
+}
+
+// applyConfigValues sets the flags that were not passed on the command line to the provided values
+// The values then go through the same parsing and validation as the command line's ones
+func applyConfigValues(flagSet *flag.FlagSet, values map[string]string) error {
+	passed := passedFlags(flagSet)
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "config" || name == "preset" || flagSet.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag '%v'", name)
+		}
+		if passed[name] {
+			continue
+		}
+		if err := flagSet.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value '%v' for flag '%v': %v", values[name], name, err)
+		}
+	}
+	return nil
+}
+
+// applyConfigFile applies the defaults and the preset of the configuration file to the flags that were not passed on the command line,
+// returning the names of the flags set by the preset
+// When no path is provided, the file in the user's home directory is used if it exists
+func applyConfigFile(flagSet *flag.FlagSet, path, preset string) (map[string]bool, error) {
+	if path == "" {
+		defaultPath, err := defaultConfigPath()
+		if err == nil {
+			if _, err = os.Stat(defaultPath); err == nil {
+				path = defaultPath
+			}
+		}
+	}
+	if path == "" {
+		if preset != "" {
+			return nil, fmt.Errorf("the -preset flag requires a configuration file, none was found in the home directory")
+		}
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseConfig(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+	values, err := c.values(preset)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if err := applyConfigValues(flagSet, values); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	presetFlags := map[string]bool{}
+	for name := range c.Presets[preset] {
+		presetFlags[name] = true
+	}
+	return presetFlags, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+	"defaults": {"workers": 20, "unit": "gb", "versions": true},
+	"presets": {
+		"cold-storage-audit": {"filter": "storageclasses", "regex": "GLACIER", "unit": "tb"},
+		"fast": {"workers": 50}
+	}
+}`
+
+// newTestFlagSet returns a flag set with a few of the cli flags, parsed from args
+func newTestFlagSet(t *testing.T, args ...string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("config", "", "")
+	flagSet.String("filter", "", "")
+	flagSet.String("preset", "", "")
+	flagSet.String("regex", "", "")
+	flagSet.String("unit", "mb", "")
+	flagSet.Bool("versions", false, "")
+	flagSet.Int("workers", 10, "")
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flagSet
+}
+
+func TestConfigValues(t *testing.T) {
+	var tests = []struct {
+		preset   string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			preset:   "",
+			expected: map[string]string{"workers": "20", "unit": "gb", "versions": "true"},
+			err:      false,
+		},
+		{
+			preset:   "cold-storage-audit",
+			expected: map[string]string{"workers": "20", "unit": "tb", "versions": "true", "filter": "storageclasses", "regex": "GLACIER"},
+			err:      false,
+		},
+		{
+			preset:   "unknown",
+			expected: nil,
+			err:      true,
+		},
+	}
+
+	c, err := parseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("parseConfig(): FAILED, Unexpected error '%v'", err)
+	}
+	for _, test := range tests {
+		result, err := c.values(test.preset)
+		if (err != nil) != test.err {
+			t.Errorf("values(): FAILED, Expected error '%v' - Received '%v'", test.err, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("values(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+
+	// The unknown fields and the values that are not strings, numbers or booleans are rejected
+	if _, err := parseConfig(strings.NewReader(`{"default": {}}`)); err == nil {
+		t.Errorf("parseConfig(): FAILED, Expected an error for an unknown field")
+	}
+	c, _ = parseConfig(strings.NewReader(`{"defaults": {"workers": [1]}}`))
+	if _, err := c.values(""); err == nil {
+		t.Errorf("values(): FAILED, Expected an error for a list value")
+	}
+}
+
+func TestApplyConfigValues(t *testing.T) {
+	// The flags passed on the command line are kept
+	flagSet := newTestFlagSet(t, "-unit", "kb")
+	err := applyConfigValues(flagSet, map[string]string{"unit": "gb", "workers": "20", "versions": "true"})
+	if err != nil {
+		t.Fatalf("applyConfigValues(): FAILED, Unexpected error '%v'", err)
+	}
+	for name, expected := range map[string]string{"unit": "kb", "workers": "20", "versions": "true"} {
+		if result := flagSet.Lookup(name).Value.String(); result != expected {
+			t.Errorf("applyConfigValues(): FAILED, Expected '%v' for '%v' - Received '%v'", expected, name, result)
+		}
+	}
+
+	// The unknown flags and the values that cannot be parsed are rejected
+	for _, values := range []map[string]string{{"unknown": "1"}, {"preset": "fast"}, {"workers": "many"}} {
+		if err := applyConfigValues(newTestFlagSet(t), values); err == nil {
+			t.Errorf("applyConfigValues(): FAILED, Expected an error for '%v'", values)
+		}
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Without any configuration file, nothing is applied but a preset cannot be used
+	flagSet := newTestFlagSet(t)
+	if _, err := applyConfigFile(flagSet, "", ""); err != nil || flagSet.Lookup("workers").Value.String() != "10" {
+		t.Errorf("applyConfigFile(): FAILED, Expected the flags to be unchanged - Received error '%v'", err)
+	}
+	if _, err := applyConfigFile(flagSet, "", "fast"); err == nil {
+		t.Errorf("applyConfigFile(): FAILED, Expected an error for a preset without configuration file")
+	}
+
+	// The file in the home directory is used by default
+	if err := ioutil.WriteFile(filepath.Join(home, defaultConfigFilename), []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flagSet = newTestFlagSet(t)
+	presetFlags, err := applyConfigFile(flagSet, "", "fast")
+	if err != nil || flagSet.Lookup("workers").Value.String() != "50" {
+		t.Errorf("applyConfigFile(): FAILED, Expected '50' workers - Received '%v' (error '%v')", flagSet.Lookup("workers").Value, err)
+	}
+	if !reflect.DeepEqual(presetFlags, map[string]bool{"workers": true}) {
+		t.Errorf("applyConfigFile(): FAILED, Expected the flags of the preset - Received '%v'", presetFlags)
+	}
+
+	// An explicit file must exist
+	if _, err := applyConfigFile(newTestFlagSet(t), filepath.Join(home, "missing.json"), ""); err == nil {
+		t.Errorf("applyConfigFile(): FAILED, Expected an error for a missing configuration file")
+	}
+}
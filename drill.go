@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+// validDrillOutputFlags is a slice containing the valid output formats that can be passed as cli arguments with '-output' along with '-drill'
+var validDrillOutputFlags = []string{"table", "tree", "markdown", "json", "ndjson", "csv"}
+
+// drillIncompatibleFlags contains the flags that cannot be used with '-drill', which only lists the current versions of the objects of a single bucket
+var drillIncompatibleFlags = []string{"all-profiles", "bucket-workers", "checkpoint", "columns", "costperiod", "costtag", "fast", "filter", "inventory-dir", "lifecycle", "metrics-source", "multipart", "public", "regex", "roles-file", "sample", "security", "sort", "sortasc", "sortdes", "unencrypted", "uploads-older-than", "versions", "where"}
+
+// drillOptions contains the options used to output the prefixes of a bucket
+type drillOptions struct {
+	printOptions
+	// Bucket is the name of the bucket the prefixes belong to
+	Bucket string
+	// Limit is the maximum number of prefixes in the table, markdown, json, ndjson and csv outputs, and of children of every prefix in the tree output
+	Limit int
+}
+
+// prefixRecord is the machine-readable representation of an s3.Prefix, used by the json, ndjson and csv outputs of '-drill'
+// Its field names are part of the output format and must stay stable
+type prefixRecord struct {
+	Bucket                  string             `json:"bucket"`
+	Prefix                  string             `json:"prefix"`
+	Depth                   int                `json:"depth"`
+	SizeBytes               int64              `json:"size_bytes"`
+	ObjectCount             int                `json:"object_count"`
+	StorageClassesStats     map[string]float64 `json:"storage_classes_stats"`
+	StorageClassesSizeStats map[string]float64 `json:"storage_classes_size_stats"`
+	StorageClassesBytes     map[string]int64   `json:"storage_classes_bytes"`
+	LastModified            *string            `json:"last_modified"`
+}
+
+// prefixCSVHeader contains the csv column names of '-drill', in the same order as the values returned by prefixRecord.csvRecord
+var prefixCSVHeader = []string{"bucket", "prefix", "depth", "size_bytes", "object_count", "storage_classes_stats", "storage_classes_size_stats", "storage_classes_bytes", "last_modified"}
+
+// newPrefixRecord builds the prefixRecord of a prefix
+func newPrefixRecord(bucket string, prefix *s3.Prefix) prefixRecord {
+	return prefixRecord{
+		Bucket:                  bucket,
+		Prefix:                  prefix.Prefix,
+		Depth:                   prefix.Depth,
+		SizeBytes:               prefix.SizeBytes,
+		ObjectCount:             prefix.ObjectCount,
+		StorageClassesStats:     prefix.StorageClassesStats,
+		StorageClassesSizeStats: prefix.StorageClassesSizeStats,
+		StorageClassesBytes:     prefix.StorageClassesBytes,
+		LastModified:            formatISODate(prefix.LastModified),
+	}
+}
+
+// csvRecord returns the record's values as strings, in the same order as prefixCSVHeader
+func (r prefixRecord) csvRecord() []string {
+	var lastModified string
+	if r.LastModified != nil {
+		lastModified = *r.LastModified
+	}
+
+	return []string{
+		r.Bucket,
+		r.Prefix,
+		strconv.Itoa(r.Depth),
+		strconv.FormatInt(r.SizeBytes, 10),
+		strconv.Itoa(r.ObjectCount),
+		formatStorageClassesCSV(r.StorageClassesStats),
+		formatStorageClassesCSV(r.StorageClassesSizeStats),
+		formatStorageClassesBytesCSV(r.StorageClassesBytes),
+		lastModified,
+	}
+}
+
+// validateDrillOutputFlag validates that the provided output format exists in the validDrillOutputFlags slice
+func validateDrillOutputFlag(output string) error {
+	for _, validOutput := range validDrillOutputFlags {
+		if strings.ToLower(output) == validOutput {
+			return nil
+		}
+	}
+	return fmt.Errorf("Error - '%v' is not a valid '-output' value with '-drill'", output)
+}
+
+// validateDrillDepthFlag validates that the provided depth is at least 1
+func validateDrillDepthFlag(depth int) error {
+	if depth < 1 {
+		return fmt.Errorf("Error - '%v' is not a valid '-drill-depth' value, it must be bigger than 0", depth)
+	}
+	return nil
+}
+
+// checkDrillFlags returns an error if one of the drillIncompatibleFlags is in flags, the flags passed on the command line or set by the
+// preset of the configuration file. The defaults of the configuration file are left out, since they apply to every run and not to '-drill'
+func checkDrillFlags(flags map[string]bool) error {
+	var incompatible []string
+	for _, name := range drillIncompatibleFlags {
+		if flags[name] {
+			incompatible = append(incompatible, "-"+name)
+		}
+	}
+	if len(incompatible) > 0 {
+		return fmt.Errorf("Error - the -drill flag cannot be used with %v", strings.Join(incompatible, ", "))
+	}
+	return nil
+}
+
+// flattenPrefixes returns the prefixes below the root, whatever their level, from the biggest to the smallest, the prefixes of the same size being sorted by name
+func flattenPrefixes(root *s3.Prefix) []*s3.Prefix {
+	prefixes := make([]*s3.Prefix, 0)
+	root.Walk(func(prefix *s3.Prefix) {
+		if prefix != root {
+			prefixes = append(prefixes, prefix)
+		}
+	})
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		if prefixes[i].SizeBytes != prefixes[j].SizeBytes {
+			return prefixes[i].SizeBytes > prefixes[j].SizeBytes
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+	return prefixes
+}
+
+// prefixStorageClasses returns the share of every storage class of the prefix, computed on the number or on the size of the objects
+func prefixStorageClasses(prefix *s3.Prefix, options drillOptions) string {
+	if options.StorageClassBasis == storageClassBasisBytes {
+		return formatStorageClasses(prefix.StorageClassesSizeStats)
+	}
+	return formatStorageClasses(prefix.StorageClassesStats)
+}
+
+// prefixHeader returns the header of the table, tree and markdown outputs, name being the header of the prefixes' column
+func prefixHeader(name string, options drillOptions) []string {
+	return []string{name, sizeHeader("TOTAL SIZE")(options.printOptions), "NUMBER OF FILES", storageClassesHeader(options.printOptions), "LAST MODIFIED"}
+}
+
+// prefixRow returns the values of the table, tree and markdown outputs, name being the value of the prefixes' column
+func prefixRow(name string, prefix *s3.Prefix, options drillOptions) []string {
+	return []string{name, tableSize(prefix.SizeBytes, options.printOptions), strconv.Itoa(prefix.ObjectCount), prefixStorageClasses(prefix, options), formatTableDate(prefix.LastModified)}
+}
+
+// printPrefixes outputs the prefixes of a bucket to w using the provided output format
+// Every format but the tree lists the prefixes of every level below the root from the biggest to the smallest, up to options.Limit
+func printPrefixes(w io.Writer, root *s3.Prefix, options drillOptions) error {
+	if strings.ToLower(options.Output) == "tree" {
+		printPrefixesTree(w, root, options)
+		return nil
+	}
+
+	prefixes := flattenPrefixes(root)
+	if len(prefixes) > options.Limit {
+		prefixes = prefixes[:options.Limit]
+	}
+
+	switch strings.ToLower(options.Output) {
+	case "json":
+		records := make([]prefixRecord, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			records = append(records, newPrefixRecord(options.Bucket, prefix))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, prefix := range prefixes {
+			if err := encoder.Encode(newPrefixRecord(options.Bucket, prefix)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(prefixCSVHeader); err != nil {
+			return err
+		}
+		for _, prefix := range prefixes {
+			if err := writer.Write(newPrefixRecord(options.Bucket, prefix).csvRecord()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "markdown":
+		rows := make([][]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			rows = append(rows, prefixRow(prefix.Prefix, prefix, options))
+		}
+		return writeMarkdownTable(w, prefixHeader("PREFIX", options), rows)
+	default:
+		t := tabby.NewCustom(tabwriter.NewWriter(w, 0, 0, 2, ' ', 0))
+		t.AddHeader(toInterfaces(prefixHeader("PREFIX", options))...)
+		for _, prefix := range prefixes {
+			t.AddLine(toInterfaces(prefixRow(prefix.Prefix, prefix, options))...)
+		}
+		t.Print()
+		return nil
+	}
+}
+
+// printPrefixesTree outputs the prefixes as a tree starting from the root, the children of every prefix being sorted by size
+// and limited to options.Limit, the number of hidden children being shown instead of them
+func printPrefixesTree(w io.Writer, root *s3.Prefix, options drillOptions) {
+	t := tabby.NewCustom(tabwriter.NewWriter(w, 0, 0, 2, ' ', 0))
+	t.AddHeader(toInterfaces(prefixHeader("PREFIX", options))...)
+	t.AddLine(toInterfaces(prefixRow("s3://"+options.Bucket+"/"+root.Prefix, root, options))...)
+
+	var addChildren func(prefix *s3.Prefix, indent string)
+	addChildren = func(prefix *s3.Prefix, indent string) {
+		children := prefix.Children
+		hidden := 0
+		if len(children) > options.Limit {
+			hidden = len(children) - options.Limit
+			children = children[:options.Limit]
+		}
+
+		for i, child := range children {
+			branch, next := "├── ", "│   "
+			if i == len(children)-1 && hidden == 0 {
+				branch, next = "└── ", "    "
+			}
+			t.AddLine(toInterfaces(prefixRow(indent+branch+strings.TrimPrefix(child.Prefix, prefix.Prefix), child, options))...)
+			addChildren(child, indent+next)
+		}
+		if hidden > 0 {
+			t.AddLine(indent + "└── (" + strconv.Itoa(hidden) + " more)")
+		}
+	}
+	addChildren(root, "")
+
+	t.Print()
+}
+
+// toInterfaces converts the values of a row to the type expected by tabby
+func toInterfaces(values []string) []interface{} {
+	converted := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		converted = append(converted, value)
+	}
+	return converted
+}
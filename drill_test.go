@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+// testPrefixes returns the prefixes of a bucket drilled down to 2 levels
+func testPrefixes() *s3.Prefix {
+	prefix := func(name string, depth int, size int64, count int, children ...*s3.Prefix) *s3.Prefix {
+		return &s3.Prefix{
+			Prefix:                  name,
+			Depth:                   depth,
+			SizeBytes:               size,
+			ObjectCount:             count,
+			LastModified:            time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC),
+			StorageClassesStats:     map[string]float64{"STANDARD": 100},
+			StorageClassesSizeStats: map[string]float64{"STANDARD": 100},
+			StorageClassesBytes:     map[string]int64{"STANDARD": size},
+			Children:                children,
+		}
+	}
+
+	return prefix("", 0, 3500000, 6,
+		prefix("logs/", 1, 3000000, 4,
+			prefix("logs/2021/", 2, 2000000, 1),
+			prefix("logs/2020/", 2, 1000000, 3),
+		),
+		prefix("data/", 1, 500000, 2),
+	)
+}
+
+func TestPrintPrefixesMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	err := printPrefixes(&b, testPrefixes(), drillOptions{printOptions: printOptions{Output: "markdown", SizeUnit: "mb"}, Bucket: "bucket1", Limit: 3})
+	if err != nil {
+		t.Errorf("printPrefixes(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "| PREFIX | TOTAL SIZE (MB) | NUMBER OF FILES | STORAGE CLASSES | LAST MODIFIED |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| logs/ | 3.00 | 4 | STANDARD(100.0%)  | 01-03-2020 |\n" +
+		"| logs/2021/ | 2.00 | 1 | STANDARD(100.0%)  | 01-03-2020 |\n" +
+		"| logs/2020/ | 1.00 | 3 | STANDARD(100.0%)  | 01-03-2020 |\n"
+	if b.String() != expected {
+		t.Errorf("printPrefixes(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintPrefixesTree(t *testing.T) {
+	var b bytes.Buffer
+	err := printPrefixes(&b, testPrefixes(), drillOptions{printOptions: printOptions{Output: "tree", SizeUnit: "mb"}, Bucket: "bucket1", Limit: 1})
+	if err != nil {
+		t.Errorf("printPrefixes(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "PREFIX         TOTAL SIZE (MB)  NUMBER OF FILES  STORAGE CLASSES    LAST MODIFIED\n" +
+		"------         ---------------  ---------------  ---------------    -------------\n" +
+		"s3://bucket1/  3.50             6                STANDARD(100.0%)   01-03-2020\n" +
+		"├── logs/      3.00             4                STANDARD(100.0%)   01-03-2020\n" +
+		"│   ├── 2021/  2.00             1                STANDARD(100.0%)   01-03-2020\n" +
+		"│   └── (1 more)\n" +
+		"└── (1 more)\n"
+	if b.String() != expected {
+		t.Errorf("printPrefixes(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintPrefixesCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := printPrefixes(&b, testPrefixes(), drillOptions{printOptions: printOptions{Output: "csv"}, Bucket: "bucket1", Limit: 2})
+	if err != nil {
+		t.Errorf("printPrefixes(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "bucket,prefix,depth,size_bytes,object_count,storage_classes_stats,storage_classes_size_stats,storage_classes_bytes,last_modified\n" +
+		"bucket1,logs/,1,3000000,4,STANDARD=100,STANDARD=100,STANDARD=3000000,2020-03-01T00:00:00Z\n" +
+		"bucket1,logs/2021/,2,2000000,1,STANDARD=100,STANDARD=100,STANDARD=2000000,2020-03-01T00:00:00Z\n"
+	if b.String() != expected {
+		t.Errorf("printPrefixes(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestCheckDrillFlags(t *testing.T) {
+	var tests = []struct {
+		args []string
+		err  bool
+	}{
+		{
+			args: []string{"-drill", "bucket1", "-drill-depth", "2", "-output", "tree"},
+			err:  false,
+		},
+		{
+			args: []string{"-drill", "bucket1", "-versions"},
+			err:  true,
+		},
+		{
+			args: []string{"-drill", "bucket1", "-sort", "-size"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.String("drill", "", "")
+		fs.Int("drill-depth", 1, "")
+		fs.String("output", "table", "")
+		fs.Bool("versions", false, "")
+		fs.String("sort", "", "")
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatalf("checkDrillFlags(): FAILED, Expected valid arguments - Received: %v", err)
+		}
+
+		err := checkDrillFlags(passedFlags(fs))
+		if err != nil && test.err == false {
+			t.Errorf("checkDrillFlags(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("checkDrillFlags(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
+func TestValidateDrillDepthFlag(t *testing.T) {
+	var tests = []struct {
+		depth int
+		err   bool
+	}{
+		{
+			depth: 1,
+			err:   false,
+		},
+		{
+			depth: 0,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateDrillDepthFlag(test.depth)
+		if err != nil && test.err == false {
+			t.Errorf("validateDrillDepthFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateDrillDepthFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
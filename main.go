@@ -1,19 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
+	"os"
+	"os/signal"
 	"regexp"
-	"sort"
-	"strconv"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/costexplorer"
-	awss3 "github.com/aws/aws-sdk-go/service/s3"
-	"github.com/cheynewallace/tabby"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/cocotton/bucket-digger/s3"
 )
 
@@ -21,22 +17,84 @@ const defaultRegion = "us-east-1"
 
 func main() {
 	// Initialize the cli flags
-	var costTag, filter, regex, sortasc, sortdes, sizeUnit string
-	var costPeriod, limit, workers int
+	var checkpointPath, columnsFlag, configPath, costTag, drill, drillDelimiter, drillPrefix, endpoint, externalID, filter, inventoryDir, metricsSource, output, preset, profiles, region, regex, roleName, rolesFile, sortFlag, sortasc, sortdes, sizeUnit, storageClassBasis, where string
+	var bucketWorkers, costPeriod, drillDepth, limit, maxRetries, sample, uploadsOlderThan, workers int
+	var bucketTimeout, timeout time.Duration
+	var allProfiles, disableSSL, fast, lifecycle, multipart, pathStyle, public, security, unencrypted, versions bool
 
+	flag.BoolVar(&allProfiles, "all-profiles", false, "Scan every profile found in the shared config and credentials files")
+	flag.DurationVar(&bucketTimeout, "bucket-timeout", 0, "The maximum time spent fetching a single bucket's information (e.g. 10m), the bucket being marked as incomplete once reached. 0 means no timeout")
+	flag.IntVar(&bucketWorkers, "bucket-workers", 1, "The number of ranges of keys of a single bucket whose objects are listed at the same time, by every -workers. Speeds up the listing of huge buckets")
+	flag.StringVar(&checkpointPath, "checkpoint", "", "The file recording the progress of the scan, an interrupted scan being resumed from it when run again with the same flags. Removed once the scan completes")
+	flag.StringVar(&columnsFlag, "columns", "", "The comma separated columns to output, in order, for the table, markdown and csv outputs. 'all' outputs every column and 'help' lists them")
+	flag.StringVar(&configPath, "config", "", "The JSON configuration file holding the default flag values and the presets. Default: ~/"+defaultConfigFilename+", if it exists")
 	flag.IntVar(&costPeriod, "costperiod", 30, "The period (in days) over which to calculate the cost of the bucket (e.g. from 30 days ago up to today). Max value: 365")
 	flag.StringVar(&costTag, "costtag", "name", "The cost allocation tag")
-	flag.StringVar(&filter, "filter", "", "The field to filter on. Possible values: "+strings.Join(validFilterFlags, ", "))
-	flag.StringVar(&regex, "regex", "", "The regex to be applied on the filter")
+	flag.StringVar(&drill, "drill", "", "Break the objects of this bucket down by prefix instead of scanning every bucket, see -drill-depth, -drill-delimiter and -drill-prefix")
+	flag.StringVar(&drillDelimiter, "drill-delimiter", "/", "The character separating the levels of the keys with -drill")
+	flag.IntVar(&drillDepth, "drill-depth", 1, "The number of levels the objects are broken down to with -drill")
+	flag.StringVar(&drillPrefix, "drill-prefix", "", "Only break down the objects under this prefix with -drill, e.g. logs/")
+	flag.BoolVar(&disableSSL, "disable-ssl", false, "Use HTTP instead of HTTPS to reach S3, e.g. for a local S3 compatible service")
+	flag.StringVar(&endpoint, "endpoint", "", "The URL of an S3 compatible service (e.g. http://localhost:9000 for MinIO) to use instead of AWS S3. The cost and account are not fetched")
+	flag.StringVar(&externalID, "external-id", "", "The external ID passed when assuming the '-role-name' role, if any")
+	flag.BoolVar(&fast, "fast", false, "Only output the name, region and creation date of the buckets, without listing their objects nor fetching their cost. Much faster on many or big buckets")
+	flag.StringVar(&filter, "filter", "", "Deprecated, use -where. The field to filter on. Possible values: "+strings.Join(validFilterFlags, ", "))
+	flag.StringVar(&inventoryDir, "inventory-dir", "", "The local copy of the inventories' destination bucket to read the inventory reports from, instead of the destination bucket itself. Implies -metrics-source inventory")
+	flag.IntVar(&maxRetries, "max-retries", s3.DefaultMaxRetries, "The number of times a failed or throttled request is retried, with an exponential backoff, before giving up on the information it fetches")
+	flag.StringVar(&metricsSource, "metrics-source", s3.MetricsSourceList, "Where the objects metrics come from: 'list' lists every object, 'cloudwatch' reads S3's daily storage metrics from CloudWatch, 'auto' lists the objects of the buckets without CloudWatch metrics and 'inventory' reads the buckets' S3 Inventory reports, listing the objects of the buckets without one. Only CSV inventories can be read, the buckets with an ORC or Parquet inventory being listed and reported with an 'unsupported inventory format' error. Possible values: "+strings.Join(validMetricsSourceFlags, ", "))
+	flag.BoolVar(&multipart, "multipart", false, "Fetch the number, total size and age of the incomplete multipart uploads of every bucket")
+	flag.StringVar(&output, "output", "table", "The format used to output the buckets. Possible values: "+strings.Join(validOutputFlags, ", ")+", and tree with -drill")
+	flag.BoolVar(&pathStyle, "path-style", false, "Address the buckets in the URL's path (e.g. http://endpoint/bucket) instead of its host, as required by most S3 compatible services")
+	flag.StringVar(&preset, "preset", "", "The name of the configuration file's preset to apply")
+	flag.StringVar(&profiles, "profiles", "", "The comma separated shared config profiles to scan (e.g. dev,prod). The default credential chain is used if not provided")
+	flag.BoolVar(&public, "public", false, "Only show the public buckets, i.e. the ones with a public policy or ACL not prevented by a public access block. Implies -security")
+	flag.StringVar(&region, "region", defaultRegion, "The region used to list the buckets and, with -endpoint, the region of every bucket")
+	flag.StringVar(&regex, "regex", "", "Deprecated, use -where. The regex to be applied on the filter")
+	flag.BoolVar(&lifecycle, "lifecycle", false, "Fetch the summary of the lifecycle and replication configurations of every bucket")
 	flag.IntVar(&limit, "limit", 100, "The maximum number of buckets that will be outputed to the console")
-	flag.StringVar(&sortasc, "sortasc", "", "The field to sort (ascending) the output by. Possible values: "+strings.Join(validSortFlags, ", "))
-	flag.StringVar(&sortdes, "sortdes", "", "The field to sort (descending) the output by. Possible values: "+strings.Join(validSortFlags, ", "))
+	flag.StringVar(&roleName, "role-name", "", "The name of the role to assume in every account of the '-roles-file' file")
+	flag.StringVar(&rolesFile, "roles-file", "", "The file listing the IDs of the accounts to scan, one per line, by assuming the '-role-name' role in each of them")
+	flag.IntVar(&sample, "sample", 0, "Estimate the objects metrics of the listed buckets from at most this number of listing requests per bucket (e.g. 200) instead of listing every object, the estimates being marked with their 95% confidence intervals. 0 lists every object")
+	flag.BoolVar(&security, "security", false, "Fetch the security settings of every bucket: default encryption, public access block, policy status and ACL grants")
+	flag.StringVar(&sortFlag, "sort", "", "The comma separated fields to sort the output by, prefixed with '-' for a descending order (e.g. region,-cost). Possible values: "+strings.Join(validSortFlags, ", ")+", "+storageClassBytesSortField+":CLASS")
+	flag.StringVar(&sortasc, "sortasc", "", "Deprecated, use -sort. The field to sort (ascending) the output by")
+	flag.StringVar(&sortdes, "sortdes", "", "Deprecated, use -sort. The field to sort (descending) the output by")
+	flag.StringVar(&storageClassBasis, "storage-class-basis", storageClassBasisCount, "What the storage classes shares of the table and markdown outputs are computed on: 'count' for the number of objects, 'bytes' for their size. Possible values: "+strings.Join(validStorageClassBasisFlags, ", "))
+	flag.DurationVar(&timeout, "timeout", 0, "The maximum duration of the whole scan (e.g. 1h), the unfinished buckets being marked as incomplete once reached. 0 means no timeout")
+	flag.BoolVar(&unencrypted, "unencrypted", false, "Only show the buckets without default encryption. Implies -security")
 	flag.StringVar(&sizeUnit, "unit", "mb", "Unit used to display a bucket's size. Possible values: b, kb, mb, gb, tb, pb, eb")
+	flag.IntVar(&uploadsOlderThan, "uploads-older-than", 0, "Only show the buckets having an incomplete multipart upload older than this number of days. Implies -multipart")
+	flag.BoolVar(&versions, "versions", false, "Take into account the previous versions of the objects and the delete markers in the objects metrics. Slower, since every version gets listed")
+	flag.StringVar(&where, "where", "", `The expression the buckets must match, e.g. 'region == "eu-west-1" && size > 500GB && modified > 90d && storageclass("GLACIER") > 20%'`)
 	flag.IntVar(&workers, "workers", 10, "The number of workers used to fetch the data from AWS")
 	flag.Parse()
+	commandLineFlags := passedFlags(flag.CommandLine)
+
+	// Apply the configuration file's defaults and preset to the flags that were not passed on the command line
+	// The flags are validated afterwards, whether they come from the command line or from the file
+	presetFlags, err := applyConfigFile(flag.CommandLine, configPath, preset)
+	if err != nil {
+		exitErrorf("Error - unable to apply the configuration file. Error: %v", err)
+	}
+
+	// '-drill' only lists the objects of a single bucket, most of the scan flags not applying to it whether they were passed on the
+	// command line or set by the preset, '-drill' itself possibly coming from the configuration file
+	if drill != "" {
+		drillFlags := map[string]bool{}
+		for name := range commandLineFlags {
+			drillFlags[name] = true
+		}
+		for name := range presetFlags {
+			drillFlags[name] = true
+		}
+		err := checkDrillFlags(drillFlags)
+		if err != nil {
+			exitErrorf(err.Error())
+		}
+	}
 
 	// Validate the '-unit' flag
-	err := validateSizeUnitFlag(sizeUnit)
+	err = validateSizeUnitFlag(sizeUnit)
 	if err != nil {
 		exitErrorf(err.Error())
 	}
@@ -47,14 +105,98 @@ func main() {
 		exitErrorf(err.Error())
 	}
 
+	// Validate the '-output' flag, the tree output being specific to '-drill'
+	if drill != "" {
+		err = validateDrillOutputFlag(output)
+	} else {
+		err = validateOutputFlag(output)
+	}
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+
+	// Validate the '-drill-depth' flag
+	err = validateDrillDepthFlag(drillDepth)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+
+	// Validate the '-storage-class-basis' flag
+	err = validateStorageClassBasisFlag(storageClassBasis)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+	storageClassBasis = strings.ToLower(storageClassBasis)
+
+	// Validate the '-metrics-source' flag
+	// S3 compatible services do not publish their metrics to CloudWatch
+	err = validateMetricsSourceFlag(metricsSource)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+	metricsSource = strings.ToLower(metricsSource)
+	if inventoryDir != "" {
+		if metricsSource != s3.MetricsSourceList && metricsSource != s3.MetricsSourceInventory {
+			exitErrorf("Error - the -inventory-dir flag can only be used with the '%v' metrics source", s3.MetricsSourceInventory)
+		}
+		if info, err := os.Stat(inventoryDir); err != nil || !info.IsDir() {
+			exitErrorf("Error - the -inventory-dir %v is not a readable directory", inventoryDir)
+		}
+		metricsSource = s3.MetricsSourceInventory
+	}
+	if endpoint != "" && metricsSource != s3.MetricsSourceList {
+		exitErrorf("Error - the -endpoint flag can only be used with the '%v' metrics source", s3.MetricsSourceList)
+	}
+
 	// Validate the '-limit' flag
 	err = validateLimitFlag(limit)
 	if err != nil {
 		exitErrorf(err.Error())
 	}
 
-	// Validate the '-workers' flag
-	err = validateWorkersFlag(workers)
+	// Validate the '-timeout' and '-bucket-timeout' flags
+	err = validateTimeoutFlag("timeout", timeout)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+	err = validateTimeoutFlag("bucket-timeout", bucketTimeout)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+
+	// Validate the '-uploads-older-than' flag
+	// Filtering on the uploads' age requires their metrics
+	err = validateUploadsOlderThanFlag(uploadsOlderThan)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+	if uploadsOlderThan > 0 {
+		multipart = true
+	}
+
+	// Filtering on the security settings requires them to be fetched
+	if public || unencrypted {
+		security = true
+	}
+
+	// Validate the '-max-retries' flag
+	err = validateMaxRetriesFlag(maxRetries)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+
+	// Validate the '-sample' flag
+	err = validateSampleFlag(sample)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+
+	// Validate the '-workers' and '-bucket-workers' flags
+	err = validateWorkersFlag("workers", workers)
+	if err != nil {
+		exitErrorf(err.Error())
+	}
+	err = validateWorkersFlag("bucket-workers", bucketWorkers)
 	if err != nil {
 		exitErrorf(err.Error())
 	}
@@ -78,196 +220,330 @@ func main() {
 		}
 	}
 
-	// Make sure only one of the '-sortasc' and '-sortdes' flags are provided or none of them
-	// If one of the flags is provided, validare it
-	if len(sortasc) > 0 || len(sortdes) > 0 {
-		if len(sortasc) > 0 && len(sortdes) > 0 {
-			exitErrorf("Error - cannot pass both -sortasc and -sortdes flags at the same time")
+	// Parse and type-check the '-where' expression
+	var whereExpr *s3.Where
+	if where != "" {
+		whereExpr, err = s3.ParseWhere(where)
+		if err != nil {
+			exitErrorf("Error - invalid -where expression, %v", err)
+		}
+	}
+
+	// Make sure only one of the '-sort', '-sortasc' and '-sortdes' flags are provided or none of them
+	// The deprecated '-sortasc' and '-sortdes' flags are converted to a single '-sort' key
+	var sortKeys []sortKey
+	if len(sortFlag) > 0 || len(sortasc) > 0 || len(sortdes) > 0 {
+		if (len(sortFlag) > 0 && len(sortasc) > 0) || (len(sortFlag) > 0 && len(sortdes) > 0) || (len(sortasc) > 0 && len(sortdes) > 0) {
+			exitErrorf("Error - cannot pass more than one of the -sort, -sortasc and -sortdes flags at the same time")
 		} else if len(sortasc) > 0 {
-			err = validateSortFlag(sortasc)
+			sortFlag = sortasc
 		} else if len(sortdes) > 0 {
-			err = validateSortFlag(sortdes)
+			sortFlag = "-" + sortdes
 		}
+		sortKeys, err = parseSortFlag(sortFlag)
 		if err != nil {
 			exitErrorf(err.Error())
 		}
 	}
 
-	// Initialize an AWS session in the defaultRegion
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(defaultRegion)},
-	)
+	// Parse the '-columns' flag, 'help' listing the available columns
+	// '-fast' is a shortcut for the columns that do not require the objects to be listed nor the cost to be fetched, which only drive the
+	// scan plan with the json and ndjson outputs, the fields that were not fetched being null
+	var selectedColumns []string
+	columnsFlag, err = fastColumnsFlag(fast, columnsFlag, commandLineFlags)
 	if err != nil {
-		exitErrorf("Error - unable to initialize the AWS session. Error:  %v", err)
+		exitErrorf(err.Error())
+	}
+	if columnsFlag != "" {
+		if strings.ToLower(strings.TrimSpace(columnsFlag)) == "help" {
+			printColumnsHelp(os.Stdout)
+			os.Exit(0)
+		}
+		if format := strings.ToLower(output); (format == "json" || format == "ndjson") && (!fast || commandLineFlags["columns"]) {
+			exitErrorf("Error - the -columns flag cannot be used with the %v output, which always contains every field", format)
+		}
+		selectedColumns, err = parseColumnsFlag(columnsFlag)
+		if err != nil {
+			exitErrorf(err.Error())
+		}
 	}
 
-	// Initialize the S3 client in the defaultRegion
-	s3Client := awss3.New(sess)
-	// Initialize the cost explorer client in the defaultRegion
-	cExplorerClient := costexplorer.New(sess)
+	// Build the list of profiles to scan, an empty profile meaning the default credential chain
+	// The '-profiles' and '-all-profiles' flags cannot be used together
+	profileNames := []string{""}
+	if allProfiles {
+		if profiles != "" {
+			exitErrorf("Error - cannot pass both -profiles and -all-profiles flags at the same time")
+		}
+		profileNames, err = listSharedProfiles()
+		if err != nil {
+			exitErrorf("Error - unable to read the shared config and credentials files. Error: %v", err)
+		}
+		if len(profileNames) == 0 {
+			exitErrorf("Error - no profile found in the shared config and credentials files")
+		}
+	} else if profiles != "" {
+		profileNames = splitProfilesFlag(profiles)
+		if len(profileNames) == 0 {
+			exitErrorf("Error - the -profiles flag does not contain any profile")
+		}
+	}
 
-	// List all the S3 buckets
-	buckets, err := s3.ListBuckets(s3Client)
-	if err != nil {
-		exitErrorf("Error - unable to list the buckets. Error:  %v", err)
+	// Read the accounts in which to assume the '-role-name' role, the '-roles-file' and '-role-name' flags requiring each other
+	var accounts []string
+	if rolesFile != "" {
+		if roleName == "" {
+			exitErrorf("Error - the -roles-file flag must be used with the -role-name flag")
+		}
+		accounts, err = readRolesFile(rolesFile)
+		if err != nil {
+			exitErrorf("Error - unable to read the roles file %v. Error: %v", rolesFile, err)
+		}
+		if len(accounts) == 0 {
+			exitErrorf("Error - the roles file %v does not contain any account ID", rolesFile)
+		}
+		if len(profileNames) > 1 {
+			exitErrorf("Error - the -roles-file flag can only be used with a single profile, from which the roles are assumed")
+		}
+	} else if roleName != "" || externalID != "" {
+		exitErrorf("Error - the -role-name and -external-id flags must be used with the -roles-file flag")
 	}
+	targets := buildScanTargets(profileNames, accounts)
 
-	// Make a map containing an S3 client for every bucket's region
-	// We need to use a client with the same region as the bucket's region to be able to fetch the bucket's objects
-	clientMap := make(map[string]*awss3.S3)
-	clientMap[defaultRegion] = s3Client
+	// Compute the scan plan from the columns to output, the default ones depending on the flags, and the sort keys
+	// Only the information in the plan is fetched, e.g. the cost is not fetched if it is neither shown nor sorted on
+	if fast && len(targets) > 1 {
+		selectedColumns = append([]string{"profile", "account"}, selectedColumns...)
+	}
+	planColumns := selectedColumns
+	if len(planColumns) == 0 {
+		planColumns = defaultColumns(printOptions{Accounts: len(targets) > 1, Configuration: lifecycle, MultipartUploads: multipart, Security: security, Versions: versions})
+	}
+	plan := newScanPlan(planColumns, sortKeys)
+	versions = versions || plan.versions
+	multipart = multipart || plan.multipart
+	security = security || plan.security
+	lifecycle = lifecycle || plan.configuration
+	if sample > 0 && versions {
+		exitErrorf("Error - the -sample flag cannot be used with -versions, nor with the columns, sort keys or -where fields using the previous versions of the objects")
+	}
 
-	// Make the channel from which the workers will fetch the butckets they need to process
-	bucketChan := make(chan *s3.Bucket, len(buckets))
+	// Configure the scanner, passing the '-regex' to the filter matching the '-filter' flag
+	// The rate of the requests is limited per service and region across every profile and account
+	options := s3.ScannerOptions{
+		BucketTimeout:    bucketTimeout,
+		BucketWorkers:    bucketWorkers,
+		DisableSSL:       disableSSL,
+		Endpoint:         endpoint,
+		InventoryDir:     inventoryDir,
+		Configuration:    lifecycle,
+		CostPeriod:       costPeriod,
+		CostTag:          costTag,
+		MetricsSource:    metricsSource,
+		MultipartUploads: multipart,
+		PathStyle:        pathStyle,
+		PublicOnly:       public,
+		Sample:           sample,
+		Security:         security,
+		SkipCost:         !plan.cost,
+		SkipObjects:      !plan.objects && !plan.versions,
+		Throttler:        s3.NewThrottler(maxRetries),
+		UnencryptedOnly:  unencrypted,
+		UploadsOlderThan: time.Duration(uploadsOlderThan) * 24 * time.Hour,
+		Versions:         versions,
+		Where:            whereExpr,
+		Workers:          workers,
+	}
+	switch strings.ToLower(filter) {
+	case "account":
+		options.AccountFilter = compiledRegex
+	case "name":
+		options.NameFilter = compiledRegex
+	case "storageclasses":
+		options.StorageClassFilter = compiledRegex
+	}
+
+	// Resume the scan from the '-checkpoint' file, if it exists, the scan having to be run with the same flags as when it was saved
+	if checkpointPath != "" {
+		options.Checkpoint, err = s3.OpenCheckpoint(checkpointPath, checkpointFlags(flag.CommandLine))
+		if err != nil {
+			exitErrorf("Error - unable to open the checkpoint. Error: %v", err)
+		}
+		if completed := options.Checkpoint.CompletedBuckets(); completed > 0 {
+			printErrorf("Resuming the scan from %v, %v bucket(s) already scanned", checkpointPath, completed)
+		}
+	}
+
+	// Cancel the scan once the '-timeout' is reached, if any, the timeout being derived from the context cancelled by Ctrl-C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	// Cancel the scan on the first Ctrl-C so that the buckets already processed still get printed
+	// Any following Ctrl-C exits right away
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		printErrorf("Interrupted - stopping the workers, press Ctrl-C again to exit right away")
+		cancel()
+	}()
+
+	// Break the '-drill' bucket down by prefix instead of scanning the buckets
+	if drill != "" {
+		if len(targets) > 1 {
+			exitErrorf("Error - the -drill flag can only be used with a single profile")
+		}
+		sess, err := newProfileSession(targets[0].profile, region)
+		if err != nil {
+			exitErrorf("Error - unable to create the session. Error: %v", err)
+		}
+		root, err := s3.NewScanner(sess, options).Drill(ctx, drill, s3.DrillOptions{
+			Delimiter: drillDelimiter,
+			Depth:     drillDepth,
+			Prefix:    drillPrefix,
+			Workers:   workers,
+		})
+		printRetriesSummary(os.Stderr, options.Throttler.Stats())
+		if err != nil {
+			exitErrorf("Error - %v", err)
+		}
+		err = printPrefixes(os.Stdout, root, drillOptions{
+			printOptions: printOptions{
+				Output:            output,
+				SizeUnit:          sizeUnit,
+				StorageClassBasis: storageClassBasis,
+			},
+			Bucket: drill,
+			Limit:  limit,
+		})
+		if err != nil {
+			exitErrorf("Error - unable to output the prefixes. Error: %v", err)
+		}
+		return
+	}
 
-	// Make the slice thay will be filled with the filtered buckets
+	// Scan the buckets of every profile or account, printing the errors that happened for specific buckets
+	// When scanning several profiles or accounts, the ones that cannot be scanned (e.g. a role that cannot be assumed) are skipped
 	filteredBuckets := make([]*s3.Bucket, 0)
+	skippedTargets := 0
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			printErrorf("Warning - the scan was interrupted, skipping %v", target)
+			skippedTargets++
+			continue
+		}
 
-	// Initialize a waitgroup that will wait for all the workers to be done working
-	var wg sync.WaitGroup
-
-	// Start all the workers
-	for i := 1; i <= workers; i++ {
-		// Increment the waitgroup and launch a worker into its own goroutine
-		wg.Add(1)
-		go func() {
-			// Decrement the waitgroup when the worker is done working
-			defer wg.Done()
-
-			// Loop over the bucket (job) channel to get the buckets to process
-			for bucket := range bucketChan {
-				// Check if the name filter's regex matches the current bucket's name
-				// Skip the bucket if it does not
-				if strings.ToLower(filter) == "name" {
-					if !compiledRegex.Match([]byte(bucket.Name)) {
-						continue
-					}
-				}
-
-				// Set the bucket's region attribute
-				// Skip the bucket if an error is returned. This is because without its region, we might not be able to fetch its objects and will end up with bad informations
-				err := bucket.SetBucketRegion(s3Client)
-				if err != nil {
-					printErrorf("Error - unable to get the region for bucket %v, skipping it. Error: %v", bucket.Name, err)
-					continue
-				} else {
-					// Create a client for a region not found in clientMap and add it in clientMap
-					if _, ok := clientMap[bucket.Region]; !ok {
-						regionSess, err := session.NewSession(&aws.Config{
-							Region: aws.String(bucket.Region)},
-						)
-						if err != nil {
-							printErrorf("Error - unable to initialize the AWS session. Error: %v", err)
-						}
-						regionClient := awss3.New(regionSess)
-						clientMap[bucket.Region] = regionClient
-					}
-
-				}
-
-				// Set the bucket objects metrics (e.g. objects count, total size)
-				err = bucket.SetBucketObjectsMetrics(clientMap[bucket.Region])
-				if err != nil {
-					printErrorf("Error - unable to get the objects metrics for bucket %v, skipping it. Error: %v", bucket.Name, err)
-					continue
-				}
-
-				// Check if the current bucket has a storage class matching the regex used to filter the buckets
-				// Skip the bucket if it does not
-				if strings.ToLower(filter) == "storageclasses" {
-					hasStorageClass := false
-					for class := range bucket.StorageClassesStats {
-						if compiledRegex.Match([]byte(class)) {
-							hasStorageClass = true
-						}
-					}
-					if !hasStorageClass {
-						continue
-					}
-				}
-
-				// Set the bucket's cost over the provided period (e.g. 30 days)
-				err = bucket.SetBucketCostOverPeriod(cExplorerClient, costPeriod, costTag)
-				if err != nil {
-					printErrorf("Error - Unable to get cost for bucket: %v. Error: %v", bucket.Name, err)
-				}
-
-				// Add the bucket to the list that will be used to output the results in the console
-				filteredBuckets = append(filteredBuckets, bucket)
+		sess, err := newProfileSession(target.profile, region)
+		if err == nil && target.account != "" {
+			sess, err = assumeRoleSession(sess, sts.New(sess), target.account, roleName, externalID)
+		}
+		if err == nil {
+			options.Profile = target.profile
+			var buckets []*s3.Bucket
+			var bucketErrors []*s3.BucketError
+			scanner := s3.NewScanner(sess, options)
+			buckets, bucketErrors, err = scanner.Scan(ctx)
+			for _, bucketErr := range bucketErrors {
+				printErrorf("Error - %v", bucketErr)
 			}
-		}()
-	}
-
-	// Add the buckets to the bucket (job) channel
-	for _, bucket := range buckets {
-		bucketChan <- bucket
-	}
-	// Close the bucket (job) channel to let the workers know no more job will be added to it
-	close(bucketChan)
-	// Wait for the workers to be done working
-	wg.Wait()
-
-	// Sort the bucket list, either ascending or descending, according to the cli flag
-	if len(sortasc) > 0 {
-		switch sortasc {
-		case "name":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Name < filteredBuckets[j].Name })
-		case "region":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Region < filteredBuckets[j].Region })
-		case "size":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].SizeBytes < filteredBuckets[j].SizeBytes })
-		case "files":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].ObjectCount < filteredBuckets[j].ObjectCount })
-		case "created":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].CreationDate.Before(filteredBuckets[j].CreationDate) })
-		case "modified":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].LastModified.Before(filteredBuckets[j].LastModified) })
-		case "cost":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Cost < filteredBuckets[j].Cost })
-		}
-	} else if len(sortdes) > 0 {
-		switch sortdes {
-		case "name":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Name > filteredBuckets[j].Name })
-		case "region":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Region > filteredBuckets[j].Region })
-		case "size":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].SizeBytes > filteredBuckets[j].SizeBytes })
-		case "files":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].ObjectCount > filteredBuckets[j].ObjectCount })
-		case "created":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].CreationDate.After(filteredBuckets[j].CreationDate) })
-		case "modified":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].LastModified.After(filteredBuckets[j].LastModified) })
-		case "cost":
-			sort.SliceStable(filteredBuckets, func(i, j int) bool { return filteredBuckets[i].Cost > filteredBuckets[j].Cost })
-		}
-	}
-
-	// Output the buckets to the terminal, up to the '-limit' flag
-	t := tabby.New()
-	t.AddHeader("NAME", "REGION", "COST $USD("+strconv.Itoa(costPeriod)+"days)", "TOTAL SIZE ("+strings.ToUpper(sizeUnit)+")", "NUMBER OF FILES", "STORAGE CLASSES", "CREATED ON", "LAST MODIFIED")
-	for index, bucket := range filteredBuckets {
-		var cost string
-		if bucket.Cost <= 0 {
-			cost = "N/A"
-		} else {
-			cost = fmt.Sprintf("%f", bucket.Cost)
+			unattributedCosts, untaggedCost := scanner.UnattributedCosts()
+			printUnattributedCosts(os.Stderr, target.String(), costTag, unattributedCosts, untaggedCost)
+			filteredBuckets = append(filteredBuckets, buckets...)
 		}
+		if err != nil {
+			if len(targets) == 1 {
+				exitErrorf("Error - unable to list the buckets. Error:  %v", err)
+			}
+			printErrorf("Error - unable to list the buckets of %v, skipping it. Error: %v", target, err)
+			skippedTargets++
+		}
+	}
+
+	// Let the user know how many requests had to be retried, and which APIs throttled them
+	printRetriesSummary(os.Stderr, options.Throttler.Stats())
 
-		t.AddLine(
-			bucket.Name,
-			bucket.Region,
-			cost,
-			fmt.Sprintf("%.2f", convertSize(bucket.SizeBytes, sizeUnit)),
-			bucket.ObjectCount,
-			formatStorageClasses(bucket.StorageClassesStats),
-			bucket.CreationDate.Format("02-01-2006"),
-			bucket.LastModified.Format("02-01-2006"),
-		)
-		if index >= limit-1 {
-			break
+	// Let the user know that some of the buckets are missing information
+	incomplete := 0
+	for _, bucket := range filteredBuckets {
+		if bucket.Incomplete {
+			incomplete++
 		}
 	}
-	t.Print()
+	if incomplete > 0 {
+		printErrorf("Warning - %v bucket(s) could not be fully processed and are marked as incomplete", incomplete)
+	}
+
+	// Let the user know that the cost of some of the buckets is unknown, no usage being tagged with their name
+	unattributed := 0
+	for _, bucket := range filteredBuckets {
+		if bucket.CostUnattributed {
+			unattributed++
+		}
+	}
+	if unattributed > 0 {
+		printErrorf("Warning - no cost is tagged with the name of %v bucket(s) in the '%v' cost allocation tag, their cost being reported as unattributed", unattributed, costTag)
+	}
+
+	// Let the user know that some of the objects metrics are estimates, and which are only lower bounds
+	estimated, lowerBounds := 0, 0
+	for _, bucket := range filteredBuckets {
+		if bucket.Estimate != nil {
+			estimated++
+			if bucket.Estimate.LowerBound {
+				lowerBounds++
+			}
+		}
+	}
+	if estimated > 0 {
+		printErrorf("Warning - the objects metrics of %v bucket(s) were estimated from a sample of their objects, %v of them being only lower bounds", estimated, lowerBounds)
+	}
+
+	// Remove the checkpoint once every bucket has been fully processed, or save it so that running the command again resumes the scan
+	if options.Checkpoint != nil {
+		if incomplete == 0 && skippedTargets == 0 {
+			err = options.Checkpoint.Remove()
+		} else {
+			err = options.Checkpoint.Save()
+			if err == nil {
+				printErrorf("Warning - the scan is not complete, run the same command again to resume it from %v", checkpointPath)
+			}
+		}
+		if err != nil {
+			printErrorf("Error - unable to update the checkpoint %v. Error: %v", checkpointPath, err)
+		}
+	}
+
+	// Sort the bucket list according to the '-sort' keys, if any
+	if len(sortKeys) > 0 {
+		sortBuckets(filteredBuckets, sortKeys)
+	}
+
+	// Only keep the buckets up to the '-limit' flag, whatever the output format
+	if len(filteredBuckets) > limit {
+		filteredBuckets = filteredBuckets[:limit]
+	}
+
+	// Output the buckets to the terminal using the '-output' format
+	err = printBuckets(os.Stdout, filteredBuckets, printOptions{
+		Accounts:          len(targets) > 1,
+		Columns:           selectedColumns,
+		Configuration:     lifecycle,
+		CostPeriod:        costPeriod,
+		MultipartUploads:  multipart,
+		Output:            output,
+		Security:          security,
+		SizeUnit:          sizeUnit,
+		SkipObjects:       !options.ListsObjects(),
+		StorageClassBasis: storageClassBasis,
+		Versions:          versions,
+	})
+	if err != nil {
+		exitErrorf("Error - unable to output the buckets. Error: %v", err)
+	}
 }
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+// printOptions contains the options used to output the buckets
+type printOptions struct {
+	// Accounts is set when the buckets come from several accounts or profiles
+	Accounts bool
+	// Columns contains the names of the columns selected with '-columns', the default columns being used if empty
+	Columns []string
+	// Configuration is set when the lifecycle and replication configurations of the buckets were fetched
+	Configuration bool
+	// CostPeriod is the period (in days) over which the cost of the buckets was calculated
+	CostPeriod int
+	// MultipartUploads is set when the incomplete multipart uploads metrics were fetched
+	MultipartUploads bool
+	// Output is the output format, one of validOutputFlags
+	Output string
+	// Security is set when the security settings of the buckets were fetched
+	Security bool
+	// SizeUnit is the unit used to display the sizes in the table, one of the sizeMap keys
+	SizeUnit string
+	// SkipObjects is set when the objects of the buckets were not listed, their metrics being unknown
+	SkipObjects bool
+	// StorageClassBasis is what the storage classes shares of the table are computed on, one of validStorageClassBasisFlags
+	StorageClassBasis string
+	// Versions is set when the objects metrics take into account the previous versions of the objects
+	Versions bool
+}
+
+// bucketRecord is the machine-readable representation of an s3.Bucket, used by the json, ndjson and csv outputs
+// Its field names are part of the output format and must stay stable
+// The cost is null when cost_unattributed is set, no usage being tagged with the bucket's name in the cost allocation tag
+// The objects metrics (size, count, storage classes and last modification date) are null when the objects were not listed, e.g. with -fast
+// The versions related fields are null unless the objects metrics take into account the previous versions of the objects
+// and the multipart uploads related fields are null unless their metrics were fetched
+// The objects metrics are estimates when estimated is set, their confidence intervals being bounded by the *_low and *_high fields, which
+// are null otherwise. The *_high fields are null too when the metrics are only lower bounds, the requests of -sample having run out
+// The security related fields are null unless the security settings were fetched, or if they could not be fetched, in which case
+// the error is available in security_errors. The same goes for the lifecycle and replication related fields and configuration_errors
+type bucketRecord struct {
+	Account                 string             `json:"account"`
+	Profile                 string             `json:"profile"`
+	Name                    string             `json:"name"`
+	Region                  string             `json:"region"`
+	Cost                    *float64           `json:"cost"`
+	CostPeriodDays          int                `json:"cost_period_days"`
+	CostUnattributed        bool               `json:"cost_unattributed"`
+	SizeBytes               *int64             `json:"size_bytes"`
+	ObjectCount             *int               `json:"object_count"`
+	StorageClassesStats     map[string]float64 `json:"storage_classes_stats"`
+	StorageClassesSizeStats map[string]float64 `json:"storage_classes_size_stats"`
+	StorageClassesBytes     map[string]int64   `json:"storage_classes_bytes"`
+	CreationDate            *string            `json:"creation_date"`
+	LastModified            *string            `json:"last_modified"`
+	Incomplete              bool               `json:"incomplete"`
+	Estimated               bool               `json:"estimated"`
+	ObjectCountLow          *int               `json:"object_count_low"`
+	ObjectCountHigh         *int               `json:"object_count_high"`
+	SizeBytesLow            *int64             `json:"size_bytes_low"`
+	SizeBytesHigh           *int64             `json:"size_bytes_high"`
+
+	NoncurrentObjectCount         *int               `json:"noncurrent_object_count"`
+	NoncurrentSizeBytes           *int64             `json:"noncurrent_size_bytes"`
+	NoncurrentStorageClassesStats map[string]float64 `json:"noncurrent_storage_classes_stats"`
+	DeleteMarkerCount             *int               `json:"delete_marker_count"`
+
+	IncompleteUploadCount     *int    `json:"incomplete_upload_count"`
+	IncompleteUploadSizeBytes *int64  `json:"incomplete_upload_size_bytes"`
+	OldestUploadInitiated     *string `json:"oldest_upload_initiated"`
+
+	Encryption          *string           `json:"encryption"`
+	PublicAccessBlocked *bool             `json:"public_access_blocked"`
+	PolicyIsPublic      *bool             `json:"policy_is_public"`
+	ACLGrants           []string          `json:"acl_grants"`
+	ACLIsPublic         *bool             `json:"acl_is_public"`
+	Public              *bool             `json:"public"`
+	SecurityErrors      map[string]string `json:"security_errors"`
+
+	LifecycleRuleCount            *int              `json:"lifecycle_rule_count"`
+	LifecycleExpiresObjects       *bool             `json:"lifecycle_expires_objects"`
+	LifecycleTransitions          []string          `json:"lifecycle_transitions"`
+	LifecycleNoncurrentExpiration *bool             `json:"lifecycle_noncurrent_expiration"`
+	LifecycleAbortUploadsDays     *int              `json:"lifecycle_abort_uploads_days"`
+	ReplicationDestinations       []string          `json:"replication_destinations"`
+	ReplicationRegions            []string          `json:"replication_regions"`
+	ConfigurationErrors           map[string]string `json:"configuration_errors"`
+}
+
+// csvHeader contains the csv column names, in the same order as the values returned by csvRecord
+var csvHeader = []string{"account", "profile", "name", "region", "cost", "cost_period_days", "cost_unattributed", "size_bytes", "object_count", "storage_classes_stats", "storage_classes_size_stats", "storage_classes_bytes", "creation_date", "last_modified", "incomplete", "estimated", "object_count_low", "object_count_high", "size_bytes_low", "size_bytes_high", "noncurrent_object_count", "noncurrent_size_bytes", "noncurrent_storage_classes_stats", "delete_marker_count", "incomplete_upload_count", "incomplete_upload_size_bytes", "oldest_upload_initiated", "encryption", "public_access_blocked", "policy_is_public", "acl_grants", "acl_is_public", "public", "security_errors", "lifecycle_rule_count", "lifecycle_expires_objects", "lifecycle_transitions", "lifecycle_noncurrent_expiration", "lifecycle_abort_uploads_days", "replication_destinations", "replication_regions", "configuration_errors"}
+
+// newBucketRecord builds the bucketRecord of a bucket
+func newBucketRecord(bucket *s3.Bucket, options printOptions) bucketRecord {
+	record := bucketRecord{
+		Account:          bucket.Account,
+		Profile:          bucket.Profile,
+		Name:             bucket.Name,
+		Region:           bucket.Region,
+		CostPeriodDays:   options.CostPeriod,
+		CostUnattributed: bucket.CostUnattributed,
+		CreationDate:     formatISODate(bucket.CreationDate),
+		Incomplete:       bucket.Incomplete,
+	}
+
+	// A negative cost means it could not be fetched, leave it to null in that case, as well as when no cost is tagged with the bucket's name
+	// The cost being the last information fetched, it is never available for an incomplete bucket
+	if bucket.Cost >= 0 && !bucket.CostUnattributed && !bucket.Incomplete {
+		cost := bucket.Cost
+		record.Cost = &cost
+	}
+
+	if !options.SkipObjects {
+		setObjectsFields(&record, bucket)
+	}
+
+	if options.Versions {
+		noncurrentObjectCount := bucket.NoncurrentObjectCount
+		noncurrentSizeBytes := bucket.NoncurrentSizeBytes
+		deleteMarkerCount := bucket.DeleteMarkerCount
+		record.NoncurrentObjectCount = &noncurrentObjectCount
+		record.NoncurrentSizeBytes = &noncurrentSizeBytes
+		record.DeleteMarkerCount = &deleteMarkerCount
+		record.NoncurrentStorageClassesStats = bucket.NoncurrentStorageClassesStats
+		if record.NoncurrentStorageClassesStats == nil {
+			record.NoncurrentStorageClassesStats = map[string]float64{}
+		}
+	}
+
+	if options.MultipartUploads {
+		incompleteUploadCount := bucket.IncompleteUploadCount
+		incompleteUploadSizeBytes := bucket.IncompleteUploadSizeBytes
+		record.IncompleteUploadCount = &incompleteUploadCount
+		record.IncompleteUploadSizeBytes = &incompleteUploadSizeBytes
+		record.OldestUploadInitiated = formatISODate(bucket.OldestUploadInitiated)
+	}
+
+	if options.Security {
+		setSecurityFields(&record, bucket)
+	}
+
+	if options.Configuration {
+		setConfigurationFields(&record, bucket)
+	}
+
+	return record
+}
+
+// csvRecord returns the record's values as strings, in the same order as csvHeader
+func (r bucketRecord) csvRecord() []string {
+	var cost, sizeBytes, objectCount, creationDate, lastModified, noncurrentObjectCount, noncurrentSizeBytes, deleteMarkerCount string
+	var objectCountLow, objectCountHigh, sizeBytesLow, sizeBytesHigh string
+	var incompleteUploadCount, incompleteUploadSizeBytes, oldestUploadInitiated string
+	var encryption, aclGrants, lifecycleRuleCount, lifecycleAbortUploadsDays string
+	if r.Cost != nil {
+		cost = strconv.FormatFloat(*r.Cost, 'f', -1, 64)
+	}
+	if r.SizeBytes != nil {
+		sizeBytes = strconv.FormatInt(*r.SizeBytes, 10)
+	}
+	if r.ObjectCount != nil {
+		objectCount = strconv.Itoa(*r.ObjectCount)
+	}
+	if r.CreationDate != nil {
+		creationDate = *r.CreationDate
+	}
+	if r.LastModified != nil {
+		lastModified = *r.LastModified
+	}
+	if r.ObjectCountLow != nil {
+		objectCountLow = strconv.Itoa(*r.ObjectCountLow)
+	}
+	if r.ObjectCountHigh != nil {
+		objectCountHigh = strconv.Itoa(*r.ObjectCountHigh)
+	}
+	if r.SizeBytesLow != nil {
+		sizeBytesLow = strconv.FormatInt(*r.SizeBytesLow, 10)
+	}
+	if r.SizeBytesHigh != nil {
+		sizeBytesHigh = strconv.FormatInt(*r.SizeBytesHigh, 10)
+	}
+	if r.NoncurrentObjectCount != nil {
+		noncurrentObjectCount = strconv.Itoa(*r.NoncurrentObjectCount)
+	}
+	if r.NoncurrentSizeBytes != nil {
+		noncurrentSizeBytes = strconv.FormatInt(*r.NoncurrentSizeBytes, 10)
+	}
+	if r.DeleteMarkerCount != nil {
+		deleteMarkerCount = strconv.Itoa(*r.DeleteMarkerCount)
+	}
+	if r.IncompleteUploadCount != nil {
+		incompleteUploadCount = strconv.Itoa(*r.IncompleteUploadCount)
+	}
+	if r.IncompleteUploadSizeBytes != nil {
+		incompleteUploadSizeBytes = strconv.FormatInt(*r.IncompleteUploadSizeBytes, 10)
+	}
+	if r.OldestUploadInitiated != nil {
+		oldestUploadInitiated = *r.OldestUploadInitiated
+	}
+	if r.Encryption != nil {
+		encryption = *r.Encryption
+	}
+	if r.ACLGrants != nil {
+		aclGrants = strings.Join(r.ACLGrants, ";")
+	}
+
+	if r.LifecycleRuleCount != nil {
+		lifecycleRuleCount = strconv.Itoa(*r.LifecycleRuleCount)
+	}
+	if r.LifecycleAbortUploadsDays != nil {
+		lifecycleAbortUploadsDays = strconv.Itoa(*r.LifecycleAbortUploadsDays)
+	}
+
+	return []string{
+		r.Account,
+		r.Profile,
+		r.Name,
+		r.Region,
+		cost,
+		strconv.Itoa(r.CostPeriodDays),
+		strconv.FormatBool(r.CostUnattributed),
+		sizeBytes,
+		objectCount,
+		formatStorageClassesCSV(r.StorageClassesStats),
+		formatStorageClassesCSV(r.StorageClassesSizeStats),
+		formatStorageClassesBytesCSV(r.StorageClassesBytes),
+		creationDate,
+		lastModified,
+		strconv.FormatBool(r.Incomplete),
+		strconv.FormatBool(r.Estimated),
+		objectCountLow,
+		objectCountHigh,
+		sizeBytesLow,
+		sizeBytesHigh,
+		noncurrentObjectCount,
+		noncurrentSizeBytes,
+		formatStorageClassesCSV(r.NoncurrentStorageClassesStats),
+		deleteMarkerCount,
+		incompleteUploadCount,
+		incompleteUploadSizeBytes,
+		oldestUploadInitiated,
+		encryption,
+		formatOptionalBool(r.PublicAccessBlocked),
+		formatOptionalBool(r.PolicyIsPublic),
+		aclGrants,
+		formatOptionalBool(r.ACLIsPublic),
+		formatOptionalBool(r.Public),
+		formatErrorsCSV(r.SecurityErrors),
+		lifecycleRuleCount,
+		formatOptionalBool(r.LifecycleExpiresObjects),
+		strings.Join(r.LifecycleTransitions, ";"),
+		formatOptionalBool(r.LifecycleNoncurrentExpiration),
+		lifecycleAbortUploadsDays,
+		strings.Join(r.ReplicationDestinations, ";"),
+		strings.Join(r.ReplicationRegions, ";"),
+		formatErrorsCSV(r.ConfigurationErrors),
+	}
+}
+
+// setObjectsFields sets the objects metrics of a record, along with the confidence intervals of the estimated ones
+func setObjectsFields(record *bucketRecord, bucket *s3.Bucket) {
+	sizeBytes := bucket.SizeBytes
+	objectCount := bucket.ObjectCount
+	record.SizeBytes = &sizeBytes
+	record.ObjectCount = &objectCount
+	record.LastModified = formatISODate(bucket.LastModified)
+
+	record.StorageClassesStats = bucket.StorageClassesStats
+	record.StorageClassesSizeStats = bucket.StorageClassesSizeStats
+	record.StorageClassesBytes = bucket.StorageClassesBytes
+	if record.StorageClassesStats == nil {
+		record.StorageClassesStats = map[string]float64{}
+	}
+	if record.StorageClassesSizeStats == nil {
+		record.StorageClassesSizeStats = map[string]float64{}
+	}
+	if record.StorageClassesBytes == nil {
+		record.StorageClassesBytes = map[string]int64{}
+	}
+
+	if bucket.Estimate != nil {
+		setEstimateFields(record, bucket.Estimate)
+	}
+}
+
+// setEstimateFields sets the confidence intervals of the estimated objects metrics, leaving the *_high fields to null for lower bounds
+func setEstimateFields(record *bucketRecord, estimate *s3.ObjectsEstimate) {
+	objectCountLow := estimate.ObjectCountLow
+	sizeBytesLow := estimate.SizeBytesLow
+	record.Estimated = true
+	record.ObjectCountLow = &objectCountLow
+	record.SizeBytesLow = &sizeBytesLow
+	if !estimate.LowerBound {
+		objectCountHigh := estimate.ObjectCountHigh
+		sizeBytesHigh := estimate.SizeBytesHigh
+		record.ObjectCountHigh = &objectCountHigh
+		record.SizeBytesHigh = &sizeBytesHigh
+	}
+}
+
+// setSecurityFields sets the security related fields of a record, leaving to null the ones that could not be fetched
+func setSecurityFields(record *bucketRecord, bucket *s3.Bucket) {
+	failed := func(field string) bool {
+		_, ok := bucket.SecurityErrors[field]
+		return ok
+	}
+
+	if !failed(s3.SecurityFieldEncryption) {
+		encryption := bucket.Encryption
+		record.Encryption = &encryption
+	}
+	if !failed(s3.SecurityFieldPublicAccessBlock) {
+		publicAccessBlocked := bucket.PublicAccessBlocked
+		record.PublicAccessBlocked = &publicAccessBlocked
+	}
+	if !failed(s3.SecurityFieldPolicyStatus) {
+		policyIsPublic := bucket.PolicyIsPublic
+		record.PolicyIsPublic = &policyIsPublic
+	}
+	if !failed(s3.SecurityFieldACL) {
+		aclIsPublic := bucket.ACLIsPublic
+		record.ACLGrants = bucket.ACLGrants
+		record.ACLIsPublic = &aclIsPublic
+		if record.ACLGrants == nil {
+			record.ACLGrants = []string{}
+		}
+	}
+	// Whether the bucket is public depends on all of the settings but the encryption
+	if record.PublicAccessBlocked != nil && record.PolicyIsPublic != nil && record.ACLIsPublic != nil {
+		public := bucket.IsPublic()
+		record.Public = &public
+	}
+
+	record.SecurityErrors = bucket.SecurityErrors
+	if record.SecurityErrors == nil {
+		record.SecurityErrors = map[string]string{}
+	}
+}
+
+// setConfigurationFields sets the lifecycle and replication related fields of a record, leaving to null the ones that could not be fetched
+func setConfigurationFields(record *bucketRecord, bucket *s3.Bucket) {
+	if _, failed := bucket.ConfigurationErrors[s3.ConfigurationFieldLifecycle]; !failed {
+		ruleCount := bucket.LifecycleRuleCount
+		expiresObjects := bucket.LifecycleExpiresObjects
+		noncurrentExpiration := bucket.LifecycleNoncurrentExpiration
+		abortUploadsDays := bucket.LifecycleAbortUploadsDays
+		record.LifecycleRuleCount = &ruleCount
+		record.LifecycleExpiresObjects = &expiresObjects
+		record.LifecycleTransitions = bucket.LifecycleTransitions
+		record.LifecycleNoncurrentExpiration = &noncurrentExpiration
+		record.LifecycleAbortUploadsDays = &abortUploadsDays
+		if record.LifecycleTransitions == nil {
+			record.LifecycleTransitions = []string{}
+		}
+	}
+	if _, failed := bucket.ConfigurationErrors[s3.ConfigurationFieldReplication]; !failed {
+		record.ReplicationDestinations = bucket.ReplicationDestinations
+		record.ReplicationRegions = bucket.ReplicationRegions
+		if record.ReplicationDestinations == nil {
+			record.ReplicationDestinations = []string{}
+		}
+		if record.ReplicationRegions == nil {
+			record.ReplicationRegions = []string{}
+		}
+	}
+
+	record.ConfigurationErrors = bucket.ConfigurationErrors
+	if record.ConfigurationErrors == nil {
+		record.ConfigurationErrors = map[string]string{}
+	}
+}
+
+// formatErrorsCSV builds a single csv field out of errors recorded per field, e.g. 'acl=AccessDenied', sorted by field
+func formatErrorsCSV(errors map[string]string) string {
+	fields := make([]string, 0, len(errors))
+	for field, msg := range errors {
+		fields = append(fields, field+"="+msg)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ";")
+}
+
+// formatOptionalBool formats a boolean that might not be set, returning an empty string in that case
+func formatOptionalBool(value *bool) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*value)
+}
+
+// formatISODate formats a date using ISO-8601, returning nil for the zero time (e.g. the last modified date of an empty bucket)
+func formatISODate(date time.Time) *string {
+	if date.IsZero() {
+		return nil
+	}
+	formatted := date.UTC().Format(time.RFC3339)
+	return &formatted
+}
+
+// formatStorageClassesCSV builds a single csv field out of the storage classes statistics, e.g. 'GLACIER=90.0;STANDARD=10.0'
+// The classes are sorted by name so that the output is stable between runs
+func formatStorageClassesCSV(storageClasses map[string]float64) string {
+	classes := make([]string, 0, len(storageClasses))
+	for class := range storageClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	fields := make([]string, 0, len(classes))
+	for _, class := range classes {
+		fields = append(fields, class+"="+strconv.FormatFloat(storageClasses[class], 'f', -1, 64))
+	}
+	return strings.Join(fields, ";")
+}
+
+// formatStorageClassesBytesCSV formats the size in bytes of every storage class as 'CLASS=bytes' pairs separated by semicolons, ordered by class
+func formatStorageClassesBytesCSV(storageClasses map[string]int64) string {
+	classes := make([]string, 0, len(storageClasses))
+	for class := range storageClasses {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	fields := make([]string, 0, len(classes))
+	for _, class := range classes {
+		fields = append(fields, class+"="+strconv.FormatInt(storageClasses[class], 10))
+	}
+	return strings.Join(fields, ";")
+}
+
+// printBuckets outputs the buckets to w using the provided output format
+func printBuckets(w io.Writer, buckets []*s3.Bucket, options printOptions) error {
+	switch strings.ToLower(options.Output) {
+	case "json":
+		return printJSON(w, buckets, options)
+	case "ndjson":
+		return printNDJSON(w, buckets, options)
+	case "csv":
+		return printCSV(w, buckets, options)
+	case "markdown":
+		return printMarkdown(w, buckets, options)
+	default:
+		printTable(w, buckets, options)
+		return nil
+	}
+}
+
+// printTable outputs the buckets as a human readable table, using the selected columns
+func printTable(w io.Writer, buckets []*s3.Bucket, options printOptions) {
+	selected := selectedColumns(options)
+
+	header := make([]interface{}, 0, len(selected))
+	for _, c := range selected {
+		header = append(header, c.header(options))
+	}
+
+	t := tabby.NewCustom(tabwriter.NewWriter(w, 0, 0, 2, ' ', 0))
+	t.AddHeader(header...)
+	for _, bucket := range buckets {
+		line := make([]interface{}, 0, len(selected))
+		for _, c := range selected {
+			line = append(line, c.value(bucket, options))
+		}
+		t.AddLine(line...)
+	}
+	t.Print()
+}
+
+// printMarkdown outputs the buckets as a markdown table, using the same columns and values as the table output
+func printMarkdown(w io.Writer, buckets []*s3.Bucket, options printOptions) error {
+	selected := selectedColumns(options)
+
+	header := make([]string, 0, len(selected))
+	for _, c := range selected {
+		header = append(header, c.header(options))
+	}
+	rows := make([][]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		row := make([]string, 0, len(selected))
+		for _, c := range selected {
+			row = append(row, c.value(bucket, options))
+		}
+		rows = append(rows, row)
+	}
+	return writeMarkdownTable(w, header, rows)
+}
+
+// writeMarkdownTable writes a markdown table made of the header and rows, escaping the pipes of the cells
+func writeMarkdownTable(w io.Writer, header []string, rows [][]string) error {
+	// writeRow writes a single row
+	writeRow := func(cells []string) error {
+		escaped := make([]string, 0, len(cells))
+		for _, cell := range cells {
+			escaped = append(escaped, strings.Replace(cell, "|", "\\|", -1))
+		}
+		_, err := fmt.Fprintf(w, "| %v |\n", strings.Join(escaped, " | "))
+		return err
+	}
+
+	separator := make([]string, 0, len(header))
+	for range header {
+		separator = append(separator, "---")
+	}
+	if err := writeRow(header); err != nil {
+		return err
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatTableBool formats a boolean that might not be set for the table output, returning N/A in that case
+func formatTableBool(value *bool) string {
+	if value == nil {
+		return "N/A"
+	}
+	if *value {
+		return "YES"
+	}
+	return "NO"
+}
+
+// formatTableList formats a list for the table output, returning NONE for an empty list
+func formatTableList(values []string) string {
+	if len(values) == 0 {
+		return "NONE"
+	}
+	return strings.Join(values, " ")
+}
+
+// printJSON outputs the buckets as a single JSON array
+func printJSON(w io.Writer, buckets []*s3.Bucket, options printOptions) error {
+	records := make([]bucketRecord, 0, len(buckets))
+	for _, bucket := range buckets {
+		records = append(records, newBucketRecord(bucket, options))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// printNDJSON outputs the buckets as newline-delimited JSON, one bucket per line
+func printNDJSON(w io.Writer, buckets []*s3.Bucket, options printOptions) error {
+	encoder := json.NewEncoder(w)
+	for _, bucket := range buckets {
+		if err := encoder.Encode(newBucketRecord(bucket, options)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printCSV outputs the buckets as CSV, preceded by a header line
+// When columns are selected, only their csv fields are output, in the columns' order
+func printCSV(w io.Writer, buckets []*s3.Bucket, options printOptions) error {
+	// Find the position of the selected columns' fields in the csv records
+	header := csvHeader
+	var indexes []int
+	if len(options.Columns) > 0 {
+		positions := map[string]int{}
+		for i, field := range csvHeader {
+			positions[field] = i
+		}
+		header = nil
+		for _, c := range selectedColumns(options) {
+			for _, field := range c.csvFields {
+				header = append(header, field)
+				indexes = append(indexes, positions[field])
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		record := newBucketRecord(bucket, options).csvRecord()
+		if indexes != nil {
+			selected := make([]string, 0, len(indexes))
+			for _, i := range indexes {
+				selected = append(selected, record[i])
+			}
+			record = selected
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
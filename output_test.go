@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+func testBuckets() []*s3.Bucket {
+	return []*s3.Bucket{
+		{
+			ACLGrants:                 []string{"owner:FULL_CONTROL"},
+			Account:                   "123456789012",
+			Cost:                      1.5,
+			CreationDate:              time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Encryption:                "AES256",
+			IncompleteUploadCount:     3,
+			IncompleteUploadSizeBytes: 512,
+			ObjectCount:               2,
+			LastModified:              time.Date(2020, time.February, 10, 12, 0, 0, 0, time.UTC),
+			LifecycleAbortUploadsDays: 7,
+			LifecycleExpiresObjects:   true,
+			LifecycleRuleCount:        2,
+			LifecycleTransitions:      []string{"GLACIER", "STANDARD_IA"},
+			Name:                      "bucket1",
+			OldestUploadInitiated:     time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC),
+			Profile:                   "prod",
+			PublicAccessBlocked:       true,
+			Region:                    "us-east-1",
+			ReplicationDestinations:   []string{"bucket1-replica"},
+			ReplicationRegions:        []string{"eu-west-1"},
+			SecurityErrors:            map[string]string{},
+			SizeBytes:                 2048,
+			StorageClassesStats:       map[string]float64{"STANDARD": 50, "GLACIER": 50},
+			StorageClassesSizeStats:   map[string]float64{"STANDARD": 97.65625, "GLACIER": 2.34375},
+			StorageClassesBytes:       map[string]int64{"STANDARD": 2000, "GLACIER": 48},
+		},
+		{
+			Cost:         -1,
+			CreationDate: time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC),
+			Incomplete:   true,
+			SecurityErrors: map[string]string{
+				s3.SecurityFieldACL: "AccessDenied",
+			},
+			ConfigurationErrors: map[string]string{
+				s3.ConfigurationFieldReplication: "AccessDenied",
+			},
+			Name:   "bucket2",
+			Region: "eu-west-1",
+		},
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets(), printOptions{CostPeriod: 30, Output: "json", SizeUnit: "mb"})
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	var records []map[string]interface{}
+	err = json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected valid JSON - Received: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("printBuckets(): FAILED, Expected 2 records - Received: %v", len(records))
+	}
+
+	if records[0]["creation_date"] != "2020-01-01T00:00:00Z" || records[0]["size_bytes"] != float64(2048) || records[0]["cost_period_days"] != float64(30) {
+		t.Errorf("printBuckets(): FAILED, Unexpected record: %v", records[0])
+	}
+	if records[1]["cost"] != nil || records[1]["last_modified"] != nil || records[1]["incomplete"] != true {
+		t.Errorf("printBuckets(): FAILED, Expected null cost and last_modified - Received: %v", records[1])
+	}
+	if records[0]["noncurrent_object_count"] != nil || records[0]["delete_marker_count"] != nil {
+		t.Errorf("printBuckets(): FAILED, Expected null versions fields without -versions - Received: %v", records[0])
+	}
+}
+
+func TestPrintJSONSkipObjects(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets(), printOptions{CostPeriod: 30, Output: "json", SkipObjects: true})
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	var records []map[string]interface{}
+	err = json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected valid JSON - Received: %v", err)
+	}
+	for _, field := range []string{"size_bytes", "object_count", "storage_classes_stats", "storage_classes_size_stats", "storage_classes_bytes", "last_modified"} {
+		if value, ok := records[0][field]; !ok || value != nil {
+			t.Errorf("printBuckets(): FAILED, Expected a null %v without the objects listed - Received: %v", field, value)
+		}
+	}
+	if records[0]["name"] != "bucket1" || records[0]["creation_date"] != "2020-01-01T00:00:00Z" || records[0]["cost"] != 1.5 {
+		t.Errorf("printBuckets(): FAILED, Expected the fields not depending on the objects - Received: %v", records[0])
+	}
+}
+
+func TestPrintNDJSON(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets(), printOptions{CostPeriod: 30, Output: "ndjson", SizeUnit: "mb", Versions: true})
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("printBuckets(): FAILED, Expected 2 lines - Received: %v", len(lines))
+	}
+	for _, line := range lines {
+		var record bucketRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Errorf("printBuckets(): FAILED, Expected valid JSON line - Received: %v", err)
+		}
+		if record.NoncurrentObjectCount == nil || record.DeleteMarkerCount == nil {
+			t.Errorf("printBuckets(): FAILED, Expected the versions fields with -versions - Received: %v", line)
+		}
+	}
+}
+
+func TestPrintCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets(), printOptions{Configuration: true, CostPeriod: 30, MultipartUploads: true, Output: "csv", Security: true, SizeUnit: "mb"})
+	if err != nil {
+		t.Fatalf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "account,profile,name,region,cost,cost_period_days,cost_unattributed,size_bytes,object_count,storage_classes_stats,storage_classes_size_stats,storage_classes_bytes,creation_date,last_modified,incomplete,estimated,object_count_low,object_count_high,size_bytes_low,size_bytes_high,noncurrent_object_count,noncurrent_size_bytes,noncurrent_storage_classes_stats,delete_marker_count,incomplete_upload_count,incomplete_upload_size_bytes,oldest_upload_initiated," +
+		"encryption,public_access_blocked,policy_is_public,acl_grants,acl_is_public,public,security_errors," +
+		"lifecycle_rule_count,lifecycle_expires_objects,lifecycle_transitions,lifecycle_noncurrent_expiration,lifecycle_abort_uploads_days,replication_destinations,replication_regions,configuration_errors\n" +
+		"123456789012,prod,bucket1,us-east-1,1.5,30,false,2048,2,GLACIER=50;STANDARD=50,GLACIER=2.34375;STANDARD=97.65625,GLACIER=48;STANDARD=2000,2020-01-01T00:00:00Z,2020-02-10T12:00:00Z,false,false,,,,,,,,,3,512,2020-01-15T00:00:00Z," +
+		"AES256,true,false,owner:FULL_CONTROL,false,false,," +
+		"2,true,GLACIER;STANDARD_IA,false,7,bucket1-replica,eu-west-1,\n" +
+		",,bucket2,eu-west-1,,30,false,0,0,,,,2020-03-01T00:00:00Z,,true,false,,,,,,,,,0,0,," +
+		",false,false,,,,acl=AccessDenied," +
+		"0,false,,false,0,,,replication=AccessDenied\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintCSVColumns(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets(), printOptions{Columns: []string{"name", "cost"}, CostPeriod: 30, Output: "csv"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "name,cost,cost_period_days,cost_unattributed\n" +
+		"bucket1,1.5,30,false\n" +
+		"bucket2,,30,false\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	buckets := testBuckets()
+	buckets[0].Name = "bucket|1"
+
+	var b bytes.Buffer
+	err := printBuckets(&b, buckets, printOptions{Columns: []string{"name", "region", "files"}, Output: "markdown"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "| NAME | REGION | NUMBER OF FILES |\n" +
+		"| --- | --- | --- |\n" +
+		"| bucket\\|1 | us-east-1 | 2 |\n" +
+		"| bucket2 (incomplete) | eu-west-1 | 0 |\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintMarkdownStorageClassBasis(t *testing.T) {
+	var b bytes.Buffer
+	err := printBuckets(&b, testBuckets()[:1], printOptions{Columns: []string{"name", "storageclasses", "storageclassbytes"}, Output: "markdown", SizeUnit: "b", StorageClassBasis: storageClassBasisBytes})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "| NAME | STORAGE CLASSES (BYTES) | STORAGE CLASSES SIZE (B) |\n" +
+		"| --- | --- | --- |\n" +
+		"| bucket1 | GLACIER(2.3%) STANDARD(97.7%)  | GLACIER(48.00) STANDARD(2000.00)  |\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintEstimates(t *testing.T) {
+	buckets := testBuckets()
+	buckets[0].Estimate = &s3.ObjectsEstimate{ObjectCountHigh: 3, ObjectCountLow: 1, SizeBytesHigh: 3000, SizeBytesLow: 1000}
+	buckets[1].Estimate = &s3.ObjectsEstimate{LowerBound: true}
+
+	var b bytes.Buffer
+	err := printBuckets(&b, buckets, printOptions{Columns: []string{"name", "size", "files", "storageclasses", "modified", "estimated"}, Output: "markdown", SizeUnit: "kb"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "| NAME | TOTAL SIZE (KB) | NUMBER OF FILES | STORAGE CLASSES | LAST MODIFIED | ESTIMATED |\n" +
+		"| --- | --- | --- | --- | --- | --- |\n" +
+		"| bucket1 | ~2.05 (1.00-3.00) | ~2 (1-3) | ~GLACIER(50.0%) STANDARD(50.0%)  | >=10-02-2020 | YES |\n" +
+		"| bucket2 (incomplete) | >=0.00 | >=0 |  | N/A | LOWER BOUND |\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+
+	b.Reset()
+	err = printBuckets(&b, buckets, printOptions{Columns: []string{"name", "estimated"}, Output: "csv"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected = "name,estimated,object_count_low,object_count_high,size_bytes_low,size_bytes_high\n" +
+		"bucket1,true,1,3,1000,3000\n" +
+		"bucket2,true,0,,0,\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintUnattributedCost(t *testing.T) {
+	buckets := testBuckets()
+	buckets[0].CostUnattributed = true
+
+	var b bytes.Buffer
+	err := printBuckets(&b, buckets, printOptions{Columns: []string{"name", "cost"}, CostPeriod: 30, Output: "markdown"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected := "| NAME | COST $USD(30days) |\n" +
+		"| --- | --- |\n" +
+		"| bucket1 | UNATTRIBUTED |\n" +
+		"| bucket2 (incomplete) | N/A |\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+
+	b.Reset()
+	err = printBuckets(&b, buckets, printOptions{Columns: []string{"name", "cost"}, CostPeriod: 30, Output: "csv"})
+	if err != nil {
+		t.Errorf("printBuckets(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	expected = "name,cost,cost_period_days,cost_unattributed\n" +
+		"bucket1,,30,true\n" +
+		"bucket2,,30,false\n"
+	if b.String() != expected {
+		t.Errorf("printBuckets(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fastColumns are the columns output by '-fast', which only need the buckets to be listed and their region to be looked up
+var fastColumns = []string{"name", "region", "created"}
+
+// fastColumnsFlag returns the '-columns' value once '-fast' is applied, commandLine holding the flags passed on the command line
+// Passing both flags on the command line is an error, while a flag passed on the command line wins over the other one coming from the
+// configuration file, '-fast' winning when both come from it
+func fastColumnsFlag(fast bool, columns string, commandLine map[string]bool) (string, error) {
+	if !fast {
+		return columns, nil
+	}
+	if columns != "" {
+		if commandLine["fast"] && commandLine["columns"] {
+			return "", fmt.Errorf("Error - cannot pass both -fast and -columns flags at the same time")
+		}
+		if commandLine["columns"] {
+			return columns, nil
+		}
+	}
+	return strings.Join(fastColumns, ","), nil
+}
+
+// scanPlan is the bucket information to fetch during the scan, computed from the output's columns and the sort keys
+// The scanner adds what the filters need by itself, e.g. the objects for a '-where' expression on the size
+type scanPlan struct {
+	objects       bool
+	versions      bool
+	multipart     bool
+	security      bool
+	configuration bool
+	cost          bool
+}
+
+// newScanPlan returns the plan fetching the information needed by the provided columns and sort keys
+func newScanPlan(columnNames []string, sortKeys []sortKey) scanPlan {
+	fetches := columnsFetches(columnNames)
+	for _, key := range sortKeys {
+		fetches[sortFetches[key.field]] = true
+	}
+
+	return scanPlan{
+		objects:       fetches[fetchObjects],
+		versions:      fetches[fetchVersions],
+		multipart:     fetches[fetchMultipart],
+		security:      fetches[fetchSecurity],
+		configuration: fetches[fetchConfiguration],
+		cost:          fetches[fetchCost],
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewScanPlan(t *testing.T) {
+	var tests = []struct {
+		columnNames []string
+		sortKeys    []sortKey
+		expected    scanPlan
+	}{
+		{
+			columnNames: fastColumns,
+			sortKeys:    nil,
+			expected:    scanPlan{},
+		},
+		{
+			columnNames: fastColumns,
+			sortKeys:    []sortKey{{field: "cost", descending: true}},
+			expected:    scanPlan{cost: true},
+		},
+		{
+			columnNames: []string{"name", "size", "public"},
+			sortKeys:    []sortKey{{field: "deletemarkers"}},
+			expected:    scanPlan{objects: true, versions: true, security: true},
+		},
+		{
+			columnNames: defaultColumns(printOptions{Configuration: true, MultipartUploads: true}),
+			sortKeys:    nil,
+			expected:    scanPlan{objects: true, multipart: true, configuration: true, cost: true},
+		},
+	}
+
+	for _, test := range tests {
+		result := newScanPlan(test.columnNames, test.sortKeys)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("newScanPlan(): FAILED, Expected: %+v - Received: %+v", test.expected, result)
+		}
+	}
+}
+
+func TestFastColumnsFlag(t *testing.T) {
+	var tests = []struct {
+		fast        bool
+		columns     string
+		commandLine map[string]bool
+		expected    string
+		err         bool
+	}{
+		{
+			fast:        false,
+			columns:     "name,cost",
+			commandLine: map[string]bool{"columns": true},
+			expected:    "name,cost",
+			err:         false,
+		},
+		{
+			fast:        true,
+			columns:     "",
+			commandLine: map[string]bool{"fast": true},
+			expected:    "name,region,created",
+			err:         false,
+		},
+		{
+			fast:        true,
+			columns:     "name,cost",
+			commandLine: map[string]bool{"fast": true, "columns": true},
+			err:         true,
+		},
+		{
+			fast:        true,
+			columns:     "name,cost",
+			commandLine: map[string]bool{"fast": true},
+			expected:    "name,region,created",
+			err:         false,
+		},
+		{
+			fast:        true,
+			columns:     "name,cost",
+			commandLine: map[string]bool{"columns": true},
+			expected:    "name,cost",
+			err:         false,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := fastColumnsFlag(test.fast, test.columns, test.commandLine)
+		if (err != nil) != test.err {
+			t.Errorf("fastColumnsFlag(): FAILED, Expected error '%v' - Received '%v'", test.err, err)
+		}
+		if result != test.expected {
+			t.Errorf("fastColumnsFlag(): FAILED, Expected: '%v' - Received: '%v'", test.expected, result)
+		}
+	}
+}
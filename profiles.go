@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// newProfileSession initializes an AWS session in the provided region using the provided shared config profile
+// An empty profile uses the default credential chain
+func newProfileSession(profile, region string) (*session.Session, error) {
+	options := session.Options{
+		Config: aws.Config{Region: aws.String(region)},
+	}
+	if profile != "" {
+		options.Profile = profile
+		options.SharedConfigState = session.SharedConfigEnable
+	}
+	return session.NewSessionWithOptions(options)
+}
+
+// listSharedProfiles returns the names of the profiles found in the shared config and credentials files, sorted and without duplicates
+// The files' locations can be overridden using the same environment variables as the AWS CLI
+func listSharedProfiles() ([]string, error) {
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = defaults.SharedConfigFilename()
+	}
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = defaults.SharedCredentialsFilename()
+	}
+
+	profiles := map[string]bool{}
+	for _, file := range []struct {
+		path     string
+		isConfig bool
+	}{
+		{path: configFile, isConfig: true},
+		{path: credentialsFile, isConfig: false},
+	} {
+		f, err := os.Open(file.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		names, err := parseProfileNames(f, file.isConfig)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			profiles[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// parseProfileNames returns the names of the profiles declared in a shared config or credentials file
+// In the config file, the sections are named '[profile name]', except for '[default]', while in the credentials file they are named '[name]'
+func parseProfileNames(r io.Reader, isConfig bool) ([]string, error) {
+	var names []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		section := strings.TrimSpace(line[1 : len(line)-1])
+		if isConfig && section != "default" {
+			if !strings.HasPrefix(section, "profile ") {
+				continue
+			}
+			section = strings.TrimSpace(strings.TrimPrefix(section, "profile "))
+		}
+		if section != "" {
+			names = append(names, section)
+		}
+	}
+
+	return names, scanner.Err()
+}
+
+// splitProfilesFlag splits the comma separated '-profiles' flag, ignoring the empty values
+func splitProfilesFlag(profiles string) []string {
+	var names []string
+	for _, name := range strings.Split(profiles, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
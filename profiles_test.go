@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProfileNames(t *testing.T) {
+	var tests = []struct {
+		content  string
+		isConfig bool
+		expected []string
+	}{
+		{
+			content:  "[default]\nregion = us-east-1\n\n[profile dev]\nregion = eu-west-1\n[sso-session corp]\n  [ profile prod ]  \n",
+			isConfig: true,
+			expected: []string{"default", "dev", "prod"},
+		},
+		{
+			content:  "[default]\naws_access_key_id = key\n# [commented]\n[dev]\n[]\n",
+			isConfig: false,
+			expected: []string{"default", "dev"},
+		},
+		{
+			content:  "",
+			isConfig: true,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := parseProfileNames(strings.NewReader(test.content), test.isConfig)
+		if err != nil {
+			t.Errorf("parseProfileNames(): FAILED, Unexpected error '%v'", err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseProfileNames(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestListSharedProfiles(t *testing.T) {
+	config := t.TempDir() + "/config"
+	credentials := t.TempDir() + "/credentials"
+	writeFile(t, config, "[default]\n[profile prod]\n[profile dev]\n")
+	writeFile(t, credentials, "[dev]\n[ci]\n")
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+
+	expected := []string{"ci", "default", "dev", "prod"}
+	result, err := listSharedProfiles()
+	if err != nil {
+		t.Errorf("listSharedProfiles(): FAILED, Unexpected error '%v'", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("listSharedProfiles(): FAILED, Expected '%v' - Received '%v'", expected, result)
+	}
+
+	// A missing file is ignored
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials+".missing")
+	expected = []string{"default", "dev", "prod"}
+	result, err = listSharedProfiles()
+	if err != nil {
+		t.Errorf("listSharedProfiles(): FAILED, Unexpected error '%v'", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("listSharedProfiles(): FAILED, Expected '%v' - Received '%v'", expected, result)
+	}
+}
+
+func TestSplitProfilesFlag(t *testing.T) {
+	var tests = []struct {
+		profiles string
+		expected []string
+	}{
+		{
+			profiles: "dev,prod",
+			expected: []string{"dev", "prod"},
+		},
+		{
+			profiles: " dev , ,prod,",
+			expected: []string{"dev", "prod"},
+		},
+		{
+			profiles: ",",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		result := splitProfilesFlag(test.profiles)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("splitProfilesFlag(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
+
+// writeFile writes the content to the file, failing the test on error
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
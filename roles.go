@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// roleSessionName is the name of the sessions created when assuming a role, visible in the target accounts' CloudTrail
+const roleSessionName = "bucket-digger"
+
+// accountIDRegex matches a valid AWS account ID
+var accountIDRegex = regexp.MustCompile(`^[0-9]{12}$`)
+
+// scanTarget is a set of buckets to scan: the ones of a profile or, if account is set, the ones of the account
+// in which a role is assumed using the profile's credentials
+type scanTarget struct {
+	account string
+	profile string
+}
+
+// String returns a description of the target used in the messages printed to the user
+func (t scanTarget) String() string {
+	switch {
+	case t.account != "" && t.profile != "":
+		return fmt.Sprintf("account %v (profile %v)", t.account, t.profile)
+	case t.account != "":
+		return "account " + t.account
+	case t.profile != "":
+		return "profile " + t.profile
+	default:
+		return "default profile"
+	}
+}
+
+// buildScanTargets returns the targets to scan: every profile, or every account if accounts are provided, the roles being assumed from
+// the first profile only so that every account is scanned once
+func buildScanTargets(profiles []string, accounts []string) []scanTarget {
+	if len(accounts) == 0 {
+		targets := make([]scanTarget, 0, len(profiles))
+		for _, profile := range profiles {
+			targets = append(targets, scanTarget{profile: profile})
+		}
+		return targets
+	}
+
+	targets := make([]scanTarget, 0, len(accounts))
+	for _, account := range accounts {
+		targets = append(targets, scanTarget{account: account, profile: profiles[0]})
+	}
+	return targets
+}
+
+// readRolesFile returns the account IDs listed in the '-roles-file' file
+func readRolesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseAccountIDs(f)
+}
+
+// parseAccountIDs returns the account IDs listed one per line, ignoring the empty lines and the comments starting with '#'
+// Every account ID is returned once, in the order it first appears in
+func parseAccountIDs(r io.Reader) ([]string, error) {
+	var accounts []string
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !accountIDRegex.MatchString(line) {
+			return nil, fmt.Errorf("invalid account ID '%v' on line %v, an account ID is made of 12 digits", line, lineNumber)
+		}
+		if !seen[line] {
+			seen[line] = true
+			accounts = append(accounts, line)
+		}
+	}
+
+	return accounts, scanner.Err()
+}
+
+// regionPartition returns the partition of the region (e.g. 'aws-cn' for the China regions), the standard 'aws' one if it is unknown
+func regionPartition(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.ID()
+	}
+	return endpoints.AwsPartitionID
+}
+
+// roleARN returns the ARN of the role named roleName in the account, in the partition the account belongs to
+func roleARN(partition, account, roleName string) string {
+	return fmt.Sprintf("arn:%v:iam::%v:role/%v", partition, account, roleName)
+}
+
+// assumeRoleSession returns a copy of sess using the credentials of the role named roleName in the account, assumed with stsClient
+// The role is assumed right away so that an account in which it cannot be assumed is detected before scanning it
+// The role's partition is the one of the session's region, the accounts of a partition not being able to assume roles in another one
+func assumeRoleSession(sess *session.Session, stsClient stsiface.STSAPI, account, roleName, externalID string) (*session.Session, error) {
+	arn := roleARN(regionPartition(aws.StringValue(sess.Config.Region)), account, roleName)
+	creds := stscreds.NewCredentialsWithClient(stsClient, arn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = roleSessionName
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+	if _, err := creds.Get(); err != nil {
+		return nil, err
+	}
+
+	return sess.Copy(&aws.Config{Credentials: creds}), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// mockSTSClient assumes the roles of every account except the denied ones, recording the inputs it received
+type mockSTSClient struct {
+	stsiface.STSAPI
+	denied map[string]bool
+	inputs []*sts.AssumeRoleInput
+}
+
+func (m *mockSTSClient) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return m.AssumeRoleWithContext(aws.BackgroundContext(), input)
+}
+
+func (m *mockSTSClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	m.inputs = append(m.inputs, input)
+	for account := range m.denied {
+		if strings.Contains(aws.StringValue(input.RoleArn), account) {
+			return nil, fmt.Errorf("AccessDenied: not authorized to perform sts:AssumeRole")
+		}
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASSUMEDKEY"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func TestAssumeRoleSession(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(defaultRegion),
+		Credentials: credentials.NewStaticCredentials("SOURCEKEY", "secret", ""),
+	}))
+	stsClient := &mockSTSClient{denied: map[string]bool{"222222222222": true}}
+
+	// The role is assumed and its credentials used by the returned session
+	assumed, err := assumeRoleSession(sess, stsClient, "111111111111", "auditor", "external")
+	if err != nil {
+		t.Fatalf("assumeRoleSession(): FAILED, expected no errors but received '%v'", err)
+	}
+	value, err := assumed.Config.Credentials.Get()
+	if err != nil || value.AccessKeyID != "ASSUMEDKEY" {
+		t.Errorf("assumeRoleSession(): FAILED, expected the assumed credentials but received '%v' (error: '%v')", value.AccessKeyID, err)
+	}
+	input := stsClient.inputs[0]
+	if aws.StringValue(input.RoleArn) != "arn:aws:iam::111111111111:role/auditor" || aws.StringValue(input.ExternalId) != "external" ||
+		aws.StringValue(input.RoleSessionName) != roleSessionName {
+		t.Errorf("assumeRoleSession(): FAILED, unexpected AssumeRole input '%v'", input)
+	}
+
+	// The source session is left untouched
+	value, _ = sess.Config.Credentials.Get()
+	if value.AccessKeyID != "SOURCEKEY" {
+		t.Errorf("assumeRoleSession(): FAILED, expected the source session to be unchanged but it uses '%v'", value.AccessKeyID)
+	}
+
+	// An account in which the role cannot be assumed returns an error right away
+	if _, err := assumeRoleSession(sess, stsClient, "222222222222", "auditor", ""); err == nil {
+		t.Errorf("assumeRoleSession(): FAILED, expected an error for a denied account")
+	}
+	if input := stsClient.inputs[1]; input.ExternalId != nil {
+		t.Errorf("assumeRoleSession(): FAILED, expected no external ID but received '%v'", aws.StringValue(input.ExternalId))
+	}
+
+	// The role is in the partition of the session's region
+	var tests = []struct {
+		region   string
+		expected string
+	}{
+		{region: "eu-west-3", expected: "arn:aws:iam::111111111111:role/auditor"},
+		{region: "cn-north-1", expected: "arn:aws-cn:iam::111111111111:role/auditor"},
+		{region: "us-gov-west-1", expected: "arn:aws-us-gov:iam::111111111111:role/auditor"},
+		{region: "", expected: "arn:aws:iam::111111111111:role/auditor"},
+	}
+
+	for _, test := range tests {
+		regionSess := sess.Copy(&aws.Config{Region: aws.String(test.region)})
+		if _, err := assumeRoleSession(regionSess, stsClient, "111111111111", "auditor", ""); err != nil {
+			t.Fatalf("assumeRoleSession(): FAILED, expected no errors but received '%v'", err)
+		}
+		if arn := aws.StringValue(stsClient.inputs[len(stsClient.inputs)-1].RoleArn); arn != test.expected {
+			t.Errorf("assumeRoleSession(): FAILED, expected the role '%v' in the region %v but received '%v'", test.expected, test.region, arn)
+		}
+	}
+}
+
+func TestParseAccountIDs(t *testing.T) {
+	var tests = []struct {
+		content  string
+		expected []string
+		err      bool
+	}{
+		{
+			content:  "111111111111\n\n# production\n222222222222 # main account\n  111111111111  \n",
+			expected: []string{"111111111111", "222222222222"},
+			err:      false,
+		},
+		{
+			content:  "111111111111\n12345\n",
+			expected: nil,
+			err:      true,
+		},
+		{
+			content:  "# nothing yet\n",
+			expected: nil,
+			err:      false,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := parseAccountIDs(strings.NewReader(test.content))
+		if (err != nil) != test.err {
+			t.Errorf("parseAccountIDs(): FAILED, Expected error '%v' - Received '%v'", test.err, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseAccountIDs(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestBuildScanTargets(t *testing.T) {
+	var tests = []struct {
+		profiles []string
+		accounts []string
+		expected []scanTarget
+	}{
+		{
+			profiles: []string{""},
+			accounts: nil,
+			expected: []scanTarget{{}},
+		},
+		{
+			profiles: []string{"dev", "prod"},
+			accounts: nil,
+			expected: []scanTarget{{profile: "dev"}, {profile: "prod"}},
+		},
+		{
+			profiles: []string{""},
+			accounts: []string{"111111111111", "222222222222"},
+			expected: []scanTarget{{account: "111111111111"}, {account: "222222222222"}},
+		},
+		{
+			profiles: []string{"audit", "prod"},
+			accounts: []string{"111111111111", "222222222222"},
+			expected: []scanTarget{{account: "111111111111", profile: "audit"}, {account: "222222222222", profile: "audit"}},
+		},
+	}
+
+	for _, test := range tests {
+		result := buildScanTargets(test.profiles, test.accounts)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("buildScanTargets(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
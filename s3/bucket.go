@@ -2,28 +2,63 @@ package s3
 
 import (
 	"context"
-	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 
-	"github.com/aws/aws-sdk-go/service/costexplorer"
-	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // Bucket represents an S3 bucket with added information compared to the github.com/aws/aws-sdk-go/service/s3.Bucket object
+// Incomplete is set when the scan or the bucket timed out or was cancelled before all of the bucket's information could be fetched
+// StorageClassesStats is the share of the objects in every storage class, StorageClassesSizeStats the share of their bytes and
+// StorageClassesBytes the bytes stored in every class. With the CloudWatch metrics, the number of objects per class being unknown,
+// StorageClassesStats is the share of the bytes too
+// CostUnattributed is set by SetBucketCost when no usage is tagged with the bucket's name, its cost being unknown rather than 0
+// Estimate is only set by SetBucketObjectsMetricsSample, when the objects metrics were extrapolated from a sample of the objects
+// The Noncurrent* and DeleteMarkerCount fields are only set by SetBucketVersionsMetrics
+// The *Upload* fields are only set by SetBucketMultipartUploadsMetrics
+// The ACL*, Encryption, PolicyIsPublic, PublicAccessBlocked and SecurityErrors fields are only set by SetBucketSecurity
+// The ConfigurationErrors, Lifecycle* and Replication* fields are only set by SetBucketConfiguration
 type Bucket struct {
-	Cost                float64
-	CreationDate        time.Time
-	ObjectCount         int
-	LastModified        time.Time
-	Name                string
-	Region              string
-	SizeBytes           int64
-	StorageClassesStats map[string]float64
+	ACLGrants                     []string
+	Account                       string
+	ACLIsPublic                   bool
+	ConfigurationErrors           map[string]string
+	Cost                          float64
+	CostUnattributed              bool
+	CreationDate                  time.Time
+	DeleteMarkerCount             int
+	Encryption                    string
+	Estimate                      *ObjectsEstimate
+	Incomplete                    bool
+	IncompleteUploadCount         int
+	IncompleteUploadSizeBytes     int64
+	ObjectCount                   int
+	LastModified                  time.Time
+	LifecycleAbortUploadsDays     int
+	LifecycleExpiresObjects       bool
+	LifecycleNoncurrentExpiration bool
+	LifecycleRuleCount            int
+	LifecycleTransitions          []string
+	Name                          string
+	NoncurrentObjectCount         int
+	NoncurrentSizeBytes           int64
+	NoncurrentStorageClassesStats map[string]float64
+	OldestUploadInitiated         time.Time
+	PolicyIsPublic                bool
+	Profile                       string
+	PublicAccessBlocked           bool
+	Region                        string
+	ReplicationDestinations       []string
+	ReplicationRegions            []string
+	SecurityErrors                map[string]string
+	SizeBytes                     int64
+	StorageClassesBytes           map[string]int64
+	StorageClassesSizeStats       map[string]float64
+	StorageClassesStats           map[string]float64
 }
 
 // ListBuckets lists and returns the buckets in the S3 client's region
@@ -47,8 +82,7 @@ func ListBuckets(client s3iface.S3API) ([]*Bucket, error) {
 }
 
 // SetBucketRegion sets the bucket's region
-func (b *Bucket) SetBucketRegion(client s3iface.S3API) error {
-	ctx := context.Background()
+func (b *Bucket) SetBucketRegion(ctx context.Context, client s3iface.S3API) error {
 	region, err := s3manager.GetBucketRegionWithClient(ctx, client, b.Name)
 	if err != nil {
 		return err
@@ -60,26 +94,28 @@ func (b *Bucket) SetBucketRegion(client s3iface.S3API) error {
 }
 
 // SetBucketObjectsMetrics sets the metrics related to a bucket's objects
-func (b *Bucket) SetBucketObjectsMetrics(client s3iface.S3API) error {
+func (b *Bucket) SetBucketObjectsMetrics(ctx context.Context, client s3iface.S3API) error {
+	return b.listObjectsMetrics(ctx, client, newObjectsListing(), nil)
+}
+
+// listObjectsMetrics sets the metrics related to a bucket's objects, listing them from the listing's continuation token and adding them to its metrics
+// progress, when set, is called after every page but the last one with the listing to resume from
+func (b *Bucket) listObjectsMetrics(ctx context.Context, client s3iface.S3API, listing *objectsListing, progress func(listing *objectsListing)) error {
 	params := &s3.ListObjectsV2Input{
-		Bucket:  aws.String(b.Name),
-		MaxKeys: aws.Int64(1000000),
+		Bucket: aws.String(b.Name),
+	}
+	if listing.ContinuationToken != "" {
+		params.ContinuationToken = aws.String(listing.ContinuationToken)
 	}
 
-	var objects []*s3.Object
-	var sizeBytes int64
-	var lastModified time.Time
-	storageClasses := map[string]float64{}
-
-	err := client.ListObjectsV2Pages(params,
+	err := client.ListObjectsV2PagesWithContext(ctx, params,
 		func(page *s3.ListObjectsV2Output, last bool) bool {
 			for _, obj := range page.Contents {
-				objects = append(objects, obj)
-				sizeBytes += aws.Int64Value(obj.Size)
-				if obj.LastModified.After(lastModified) {
-					lastModified = *obj.LastModified
-				}
-				storageClasses[aws.StringValue(obj.StorageClass)]++
+				listing.Metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+			}
+			if progress != nil && !last {
+				listing.ContinuationToken = aws.StringValue(page.NextContinuationToken)
+				progress(listing)
 			}
 			return true
 		},
@@ -88,61 +124,90 @@ func (b *Bucket) SetBucketObjectsMetrics(client s3iface.S3API) error {
 		return err
 	}
 
-	for class, count := range storageClasses {
-		storageClasses[class] = count / float64(len(objects)) * 100
+	listing.Metrics.setObjects(b)
+
+	return nil
+}
+
+// SetBucketVersionsMetrics sets the metrics related to a bucket's objects, taking into account every version of the objects
+// The current versions are counted in the same fields as SetBucketObjectsMetrics while the previous versions and the delete markers
+// are counted in their own fields. NoncurrentStorageClassesStats contains, for every storage class, the share of its versions that are noncurrent
+func (b *Bucket) SetBucketVersionsMetrics(ctx context.Context, client s3iface.S3API) error {
+	params := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.Name),
 	}
 
-	b.ObjectCount = len(objects)
-	b.SizeBytes = sizeBytes
-	b.LastModified = lastModified
-	b.StorageClassesStats = storageClasses
+	metrics := newObjectsMetrics()
+	err := client.ListObjectVersionsPagesWithContext(ctx, params,
+		func(page *s3.ListObjectVersionsOutput, last bool) bool {
+			for _, version := range page.Versions {
+				metrics.addVersion(aws.Int64Value(version.Size), aws.TimeValue(version.LastModified), aws.StringValue(version.StorageClass), aws.BoolValue(version.IsLatest))
+			}
+			metrics.deleteMarkerCount += len(page.DeleteMarkers)
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	metrics.setVersions(b)
 
 	return nil
 }
 
-// SetBucketCostOverPeriod sets the bucket's cost from now up to X days ago
-func (b *Bucket) SetBucketCostOverPeriod(client costexploreriface.CostExplorerAPI, period int, tag string) error {
-	now := time.Now().AddDate(0, 0, 1)
-	then := now.AddDate(0, 0, -period)
-
-	param := &costexplorer.GetCostAndUsageInput{
-		Filter: &costexplorer.Expression{
-			And: []*costexplorer.Expression{
-				{
-					Dimensions: &costexplorer.DimensionValues{
-						Key:    aws.String("SERVICE"),
-						Values: []*string{aws.String("Amazon Simple Storage Service")},
-					},
-				},
-				{
-					Tags: &costexplorer.TagValues{
-						Key:    aws.String(tag),
-						Values: []*string{aws.String(b.Name)},
-					},
-				},
-			},
-		},
-		Granularity: aws.String("MONTHLY"),
-		Metrics:     []*string{aws.String("AmortizedCost")},
-		TimePeriod: &costexplorer.DateInterval{
-			Start: aws.String(then.Format("2006-01-02")),
-			End:   aws.String(now.Format("2006-01-02")),
-		},
+// SetBucketMultipartUploadsMetrics sets the metrics related to a bucket's incomplete multipart uploads
+// The size of an upload is the total size of the parts uploaded so far, which are billed even though the upload was never completed
+func (b *Bucket) SetBucketMultipartUploadsMetrics(ctx context.Context, client s3iface.S3API) error {
+	params := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(b.Name),
 	}
 
-	results, err := client.GetCostAndUsage(param)
+	var uploads []*s3.MultipartUpload
+	var oldestInitiated time.Time
+
+	err := client.ListMultipartUploadsPagesWithContext(ctx, params,
+		func(page *s3.ListMultipartUploadsOutput, last bool) bool {
+			for _, upload := range page.Uploads {
+				uploads = append(uploads, upload)
+				// S3 compatible services may not send the date an upload was initiated at, such uploads are left out of the oldest one
+				initiated := aws.TimeValue(upload.Initiated)
+				if !initiated.IsZero() && (oldestInitiated.IsZero() || initiated.Before(oldestInitiated)) {
+					oldestInitiated = initiated
+				}
+			}
+			return true
+		},
+	)
 	if err != nil {
-		b.Cost = -1
 		return err
 	}
 
-	var cost float64
-	for _, result := range results.ResultsByTime {
-		amount, _ := strconv.ParseFloat(aws.StringValue(result.Total["AmortizedCost"].Amount), 64)
-		cost += amount
+	// Sum the size of the parts of every upload
+	var sizeBytes int64
+	for _, upload := range uploads {
+		partsParams := &s3.ListPartsInput{
+			Bucket:   aws.String(b.Name),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		}
+		err := client.ListPartsPagesWithContext(ctx, partsParams,
+			func(page *s3.ListPartsOutput, last bool) bool {
+				for _, part := range page.Parts {
+					sizeBytes += aws.Int64Value(part.Size)
+				}
+				return true
+			},
+		)
+		if err != nil {
+			return err
+		}
 	}
 
-	b.Cost = cost
+	b.IncompleteUploadCount = len(uploads)
+	b.IncompleteUploadSizeBytes = sizeBytes
+	b.OldestUploadInitiated = oldestInitiated
 
 	return nil
 }
+
@@ -1,9 +1,13 @@
 package s3
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
@@ -60,3 +64,132 @@ func TestListBuckets(t *testing.T) {
 	}
 
 }
+
+func (m *mockS3Client) ListObjectVersionsPagesWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool, opts ...request.Option) error {
+	lastModified := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	previous := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fn(&s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{IsLatest: aws.Bool(true), Key: aws.String("a"), LastModified: &lastModified, Size: aws.Int64(100), StorageClass: aws.String("STANDARD")},
+			{IsLatest: aws.Bool(false), Key: aws.String("a"), LastModified: &previous, Size: aws.Int64(50), StorageClass: aws.String("STANDARD")},
+		},
+	}, false)
+	fn(&s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{IsLatest: aws.Bool(false), Key: aws.String("b"), LastModified: &previous, Size: aws.Int64(200), StorageClass: aws.String("GLACIER")},
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{
+			{IsLatest: aws.Bool(true), Key: aws.String("b"), LastModified: &lastModified},
+		},
+	}, true)
+
+	return nil
+}
+
+func TestSetBucketVersionsMetrics(t *testing.T) {
+	bucket := &Bucket{Name: "bucket1"}
+
+	err := bucket.SetBucketVersionsMetrics(context.Background(), &mockS3Client{})
+	if err != nil {
+		t.Fatalf("SetBucketVersionsMetrics(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.ObjectCount != 1 || bucket.SizeBytes != 100 {
+		t.Errorf("SetBucketVersionsMetrics(): FAILED, expected 1 current object of 100 bytes but received '%v' objects of '%v' bytes", bucket.ObjectCount, bucket.SizeBytes)
+	}
+	if bucket.NoncurrentObjectCount != 2 || bucket.NoncurrentSizeBytes != 250 {
+		t.Errorf("SetBucketVersionsMetrics(): FAILED, expected 2 noncurrent objects of 250 bytes but received '%v' objects of '%v' bytes", bucket.NoncurrentObjectCount, bucket.NoncurrentSizeBytes)
+	}
+	if bucket.DeleteMarkerCount != 1 {
+		t.Errorf("SetBucketVersionsMetrics(): FAILED, expected 1 delete marker but received '%v'", bucket.DeleteMarkerCount)
+	}
+	if bucket.StorageClassesStats["STANDARD"] != 100 {
+		t.Errorf("SetBucketVersionsMetrics(): FAILED, expected 100%% of the current objects in STANDARD but received '%v'", bucket.StorageClassesStats)
+	}
+	if bucket.NoncurrentStorageClassesStats["STANDARD"] != 50 || bucket.NoncurrentStorageClassesStats["GLACIER"] != 100 {
+		t.Errorf("SetBucketVersionsMetrics(): FAILED, expected a noncurrent share of 50%% in STANDARD and 100%% in GLACIER but received '%v'", bucket.NoncurrentStorageClassesStats)
+	}
+}
+
+// mockObjectsClient lists 9 STANDARD objects of 1 byte and a single GLACIER object of 91 bytes
+type mockObjectsClient struct {
+	s3iface.S3API
+}
+
+func (m *mockObjectsClient) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	lastModified := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	var objects []*s3.Object
+	for i := 0; i < 9; i++ {
+		objects = append(objects, &s3.Object{Key: aws.String(fmt.Sprintf("small-%v", i)), LastModified: &lastModified, Size: aws.Int64(1), StorageClass: aws.String("STANDARD")})
+	}
+	fn(&s3.ListObjectsV2Output{Contents: objects}, false)
+	fn(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("archive"), LastModified: &lastModified, Size: aws.Int64(91), StorageClass: aws.String("GLACIER")},
+		},
+	}, true)
+
+	return nil
+}
+
+func TestSetBucketObjectsMetricsStorageClassesBytes(t *testing.T) {
+	bucket := &Bucket{Name: "bucket1"}
+
+	err := bucket.SetBucketObjectsMetrics(context.Background(), &mockObjectsClient{})
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetrics(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.ObjectCount != 10 || bucket.SizeBytes != 100 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected 10 objects of 100 bytes but received '%v' objects of '%v' bytes", bucket.ObjectCount, bucket.SizeBytes)
+	}
+	if bucket.StorageClassesStats["STANDARD"] != 90 || bucket.StorageClassesStats["GLACIER"] != 10 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected a count share of 90%% in STANDARD and 10%% in GLACIER but received '%v'", bucket.StorageClassesStats)
+	}
+	if bucket.StorageClassesBytes["STANDARD"] != 9 || bucket.StorageClassesBytes["GLACIER"] != 91 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected 9 bytes in STANDARD and 91 bytes in GLACIER but received '%v'", bucket.StorageClassesBytes)
+	}
+	if bucket.StorageClassesSizeStats["STANDARD"] != 9 || bucket.StorageClassesSizeStats["GLACIER"] != 91 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected a size share of 9%% in STANDARD and 91%% in GLACIER but received '%v'", bucket.StorageClassesSizeStats)
+	}
+}
+
+func (m *mockS3Client) ListMultipartUploadsPagesWithContext(ctx aws.Context, input *s3.ListMultipartUploadsInput, fn func(*s3.ListMultipartUploadsOutput, bool) bool, opts ...request.Option) error {
+	fn(&s3.ListMultipartUploadsOutput{
+		Uploads: []*s3.MultipartUpload{
+			{Key: aws.String("no-date"), UploadId: aws.String("upload-no-date")},
+			{Initiated: aws.Time(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)), Key: aws.String("a"), UploadId: aws.String("upload-a")},
+			{Initiated: aws.Time(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)), Key: aws.String("b"), UploadId: aws.String("upload-b")},
+		},
+	}, true)
+	return nil
+}
+
+func (m *mockS3Client) ListPartsPagesWithContext(ctx aws.Context, input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool, opts ...request.Option) error {
+	fn(&s3.ListPartsOutput{
+		Parts: []*s3.Part{
+			{PartNumber: aws.Int64(1), Size: aws.Int64(100)},
+			{PartNumber: aws.Int64(2), Size: aws.Int64(50)},
+		},
+	}, true)
+	return nil
+}
+
+func TestSetBucketMultipartUploadsMetrics(t *testing.T) {
+	bucket := &Bucket{Name: "bucket1"}
+
+	err := bucket.SetBucketMultipartUploadsMetrics(context.Background(), &mockS3Client{})
+	if err != nil {
+		t.Fatalf("SetBucketMultipartUploadsMetrics(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.IncompleteUploadCount != 3 || bucket.IncompleteUploadSizeBytes != 450 {
+		t.Errorf("SetBucketMultipartUploadsMetrics(): FAILED, expected 3 uploads of 450 bytes but received '%v' uploads of '%v' bytes", bucket.IncompleteUploadCount, bucket.IncompleteUploadSizeBytes)
+	}
+	expectedOldest := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if !bucket.OldestUploadInitiated.Equal(expectedOldest) {
+		t.Errorf("SetBucketMultipartUploadsMetrics(): FAILED, expected the oldest upload to be initiated on '%v' but received '%v'", expectedOldest, bucket.OldestUploadInitiated)
+	}
+}
@@ -0,0 +1,251 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckpointVersion is the version of the checkpoint file format, the checkpoints of another version being rejected
+const CheckpointVersion = 1
+
+// checkpointInterval is the minimum time between two saves of a checkpoint while scanning
+const checkpointInterval = 10 * time.Second
+
+// Checkpoint records the progress of a scan in a file so that an interrupted scan can be resumed instead of restarted
+// It holds the outcome of the buckets already scanned and the continuation token of the objects listings in progress, along with
+// their metrics so far. The listings of the versions of the objects are not recorded, such buckets being scanned again
+// A Checkpoint is safe for concurrent use and saves itself at most every checkpointInterval while the scan updates it
+type Checkpoint struct {
+	file     checkpointFile
+	interval time.Duration
+	lastSave time.Time
+	mutex    sync.Mutex
+	path     string
+}
+
+// checkpointFile is the content of a checkpoint file, the buckets and listings being keyed by checkpointKey
+type checkpointFile struct {
+	Version  int                          `json:"version"`
+	Flags    map[string]string            `json:"flags"`
+	Buckets  map[string]*checkpointBucket `json:"buckets"`
+	Listings map[string]*objectsListing   `json:"listings"`
+}
+
+// checkpointBucket is the outcome of a bucket scanned without error, keep telling whether it matched the filters
+type checkpointBucket struct {
+	Bucket *Bucket `json:"bucket"`
+	Keep   bool    `json:"keep"`
+}
+
+// objectsListing is the progress of a bucket's objects listing: the token to list the next page from and the metrics of the previous pages
+type objectsListing struct {
+	ContinuationToken string          `json:"continuation_token"`
+	Metrics           *objectsMetrics `json:"metrics"`
+}
+
+// newObjectsListing returns a listing starting from the first page
+func newObjectsListing() *objectsListing {
+	return &objectsListing{Metrics: newObjectsMetrics()}
+}
+
+// checkpointKey returns the key of a bucket in a checkpoint, the same bucket being possibly scanned through several profiles
+func checkpointKey(bucket *Bucket) string {
+	return bucket.Account + "/" + bucket.Profile + "/" + bucket.Name
+}
+
+// OpenCheckpoint reads the checkpoint file at path, or starts an empty checkpoint if the file does not exist
+// flags are the values of the options the scan is run with, a checkpoint saved with other values or another format version being rejected
+func OpenCheckpoint(path string, flags map[string]string) (*Checkpoint, error) {
+	c := &Checkpoint{
+		file: checkpointFile{
+			Version:  CheckpointVersion,
+			Flags:    flags,
+			Buckets:  map[string]*checkpointBucket{},
+			Listings: map[string]*objectsListing{},
+		},
+		interval: checkpointInterval,
+		lastSave: time.Now(),
+		path:     path,
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file checkpointFile
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %v: %v", path, err)
+	}
+	if file.Version != CheckpointVersion {
+		return nil, fmt.Errorf("the checkpoint %v has the format version %v, only the version %v is supported", path, file.Version, CheckpointVersion)
+	}
+	if diff := diffFlags(file.Flags, flags); len(diff) > 0 {
+		return nil, fmt.Errorf("the checkpoint %v was saved with other flags: %v", path, strings.Join(diff, ", "))
+	}
+	if file.Buckets == nil {
+		file.Buckets = map[string]*checkpointBucket{}
+	}
+	if file.Listings == nil {
+		file.Listings = map[string]*objectsListing{}
+	}
+
+	c.file = file
+	return c, nil
+}
+
+// diffFlags returns the flags whose value differs between the saved and current flags, e.g. '-versions=true instead of false'
+func diffFlags(saved, current map[string]string) []string {
+	names := map[string]bool{}
+	for name := range saved {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+
+	var diff []string
+	for name := range names {
+		if saved[name] != current[name] {
+			diff = append(diff, fmt.Sprintf("-%v=%v instead of %v", name, saved[name], current[name]))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// CompletedBuckets returns the number of buckets already scanned
+func (c *Checkpoint) CompletedBuckets() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.file.Buckets)
+}
+
+// Save writes the checkpoint to its file, replacing it atomically so that an interruption never leaves a truncated file
+func (c *Checkpoint) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.save()
+}
+
+// Remove deletes the checkpoint's file, e.g. once the scan has completed
+func (c *Checkpoint) Remove() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := os.Remove(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// save writes the checkpoint to a temporary file renamed over its file, the mutex being held
+func (c *Checkpoint) save() error {
+	content, err := json.Marshal(c.file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.lastSave = time.Now()
+	return nil
+}
+
+// saveIfDue saves the checkpoint if it was last saved more than its interval ago, the mutex being held
+// An error is ignored, the checkpoint being saved again on the next update or by Save once the scan is over
+func (c *Checkpoint) saveIfDue() {
+	if time.Since(c.lastSave) >= c.interval {
+		c.save()
+	}
+}
+
+// completed returns the outcome of the bucket if it was already scanned. A nil checkpoint holds no bucket
+func (c *Checkpoint) completed(bucket *Bucket) (*checkpointBucket, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	completed, ok := c.file.Buckets[checkpointKey(bucket)]
+	return completed, ok
+}
+
+// complete records the outcome of a scanned bucket, unless it is incomplete or could not be scanned without errors
+func (c *Checkpoint) complete(result scanResult) {
+	if c == nil || result.bucket.Incomplete || len(result.errors) > 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.file.Buckets[checkpointKey(result.bucket)] = &checkpointBucket{Bucket: result.bucket, Keep: result.keep}
+	c.saveIfDue()
+}
+
+// listing returns the objects listing of the bucket to resume, a new listing if none was recorded
+func (c *Checkpoint) listing(bucket *Bucket) *objectsListing {
+	if c == nil {
+		return newObjectsListing()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	listing, ok := c.file.Listings[checkpointKey(bucket)]
+	if !ok {
+		return newObjectsListing()
+	}
+	return listing.clone()
+}
+
+// updateListing records the progress of the bucket's objects listing, a nil listing forgetting it once it is over
+func (c *Checkpoint) updateListing(bucket *Bucket, listing *objectsListing) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if listing == nil {
+		delete(c.file.Listings, checkpointKey(bucket))
+		c.saveIfDue()
+		return
+	}
+	c.file.Listings[checkpointKey(bucket)] = listing.clone()
+	c.saveIfDue()
+}
+
+// clone returns a copy of the listing, its metrics being updated by the listing while the checkpoint gets saved
+func (l *objectsListing) clone() *objectsListing {
+	metrics := newObjectsMetrics()
+	metrics.merge(l.Metrics)
+	return &objectsListing{ContinuationToken: l.ContinuationToken, Metrics: metrics}
+}
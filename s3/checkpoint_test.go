@@ -0,0 +1,223 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// mockPagesClient lists its pages of objects, the continuation token of every page but the first being its index, e.g. 'page2'
+// tokens records the continuation tokens the listings started from
+type mockPagesClient struct {
+	s3iface.S3API
+	pages  [][]*s3.Object
+	tokens []string
+}
+
+func (m *mockPagesClient) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	token := aws.StringValue(input.ContinuationToken)
+	m.tokens = append(m.tokens, token)
+
+	start := 0
+	for i := range m.pages {
+		if token == pageToken(i) {
+			start = i
+		}
+	}
+	for i := start; i < len(m.pages); i++ {
+		last := i == len(m.pages)-1
+		output := &s3.ListObjectsV2Output{Contents: m.pages[i]}
+		if !last {
+			output.NextContinuationToken = aws.String(pageToken(i + 1))
+		}
+		if !fn(output, last) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// pageToken returns the continuation token of a page of the mockPagesClient, the first page having none
+func pageToken(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return fmt.Sprintf("page%v", i)
+}
+
+// newMockPagesClient returns a client listing 3 pages of 2 objects
+func newMockPagesClient() *mockPagesClient {
+	object := func(key string, size int64, class string) *s3.Object {
+		return &s3.Object{Key: aws.String(key), LastModified: aws.Time(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)), Size: aws.Int64(size), StorageClass: aws.String(class)}
+	}
+	return &mockPagesClient{
+		pages: [][]*s3.Object{
+			{object("a", 1, "STANDARD"), object("b", 2, "STANDARD")},
+			{object("c", 3, "GLACIER"), object("d", 4, "STANDARD")},
+			{object("e", 5, "GLACIER"), object("f", 6, "STANDARD")},
+		},
+	}
+}
+
+func TestOpenCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, unable to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "scan.json")
+	flags := map[string]string{"versions": "false", "where": ""}
+
+	checkpoint, err := OpenCheckpoint(path, flags)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, expected no error for a missing file but received '%v'", err)
+	}
+	bucket := &Bucket{Account: "123456789012", Name: "bucket1", SizeBytes: 100, StorageClassesStats: map[string]float64{"STANDARD": 100}}
+	checkpoint.complete(scanResult{bucket: bucket, keep: true})
+	listing := newObjectsListing()
+	listing.ContinuationToken = "page1"
+	listing.Metrics.addVersion(10, time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), "GLACIER", true)
+	checkpoint.updateListing(&Bucket{Account: "123456789012", Name: "bucket2"}, listing)
+	if err := checkpoint.Save(); err != nil {
+		t.Fatalf("Save(): FAILED, expected no error but received '%v'", err)
+	}
+
+	resumed, err := OpenCheckpoint(path, flags)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, expected no error but received '%v'", err)
+	}
+	completed, ok := resumed.completed(&Bucket{Account: "123456789012", Name: "bucket1"})
+	if !ok || !completed.Keep || !reflect.DeepEqual(completed.Bucket, bucket) {
+		t.Errorf("OpenCheckpoint(): FAILED, expected the completed bucket '%v' but received '%v'", bucket, completed)
+	}
+	resumedListing := resumed.listing(&Bucket{Account: "123456789012", Name: "bucket2"})
+	if resumedListing.ContinuationToken != "page1" || !reflect.DeepEqual(resumedListing.Metrics, listing.Metrics) {
+		t.Errorf("OpenCheckpoint(): FAILED, expected the listing '%+v' but received '%+v'", listing.Metrics, resumedListing.Metrics)
+	}
+
+	_, err = OpenCheckpoint(path, map[string]string{"versions": "true", "where": ""})
+	if err == nil {
+		t.Errorf("OpenCheckpoint(): FAILED, expected an error for a checkpoint saved with other flags but received none")
+	}
+
+	err = ioutil.WriteFile(path, []byte(`{"version": 99, "flags": {"versions": "false", "where": ""}}`), 0600)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, unable to write the checkpoint: %v", err)
+	}
+	_, err = OpenCheckpoint(path, flags)
+	if err == nil {
+		t.Errorf("OpenCheckpoint(): FAILED, expected an error for another format version but received none")
+	}
+
+	if err := resumed.Remove(); err != nil {
+		t.Errorf("Remove(): FAILED, expected no error but received '%v'", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Remove(): FAILED, expected the checkpoint to be removed but received '%v'", err)
+	}
+}
+
+func TestListObjectsMetricsResume(t *testing.T) {
+	expected := &Bucket{Name: "bucket1"}
+	err := expected.SetBucketObjectsMetrics(context.Background(), newMockPagesClient())
+	if err != nil {
+		t.Fatalf("listObjectsMetrics(): FAILED, expected no error but received '%v'", err)
+	}
+
+	// Record the listing after the first page, as a checkpoint saved right before an interruption would
+	var saved *objectsListing
+	err = (&Bucket{Name: "bucket1"}).listObjectsMetrics(context.Background(), newMockPagesClient(), newObjectsListing(), func(listing *objectsListing) {
+		if saved == nil {
+			saved = listing.clone()
+		}
+	})
+	if err != nil || saved == nil {
+		t.Fatalf("listObjectsMetrics(): FAILED, expected the progress of the listing but received '%v', '%v'", saved, err)
+	}
+
+	client := newMockPagesClient()
+	resumed := &Bucket{Name: "bucket1"}
+	err = resumed.listObjectsMetrics(context.Background(), client, saved, nil)
+	if err != nil {
+		t.Fatalf("listObjectsMetrics(): FAILED, expected no error but received '%v'", err)
+	}
+	if !reflect.DeepEqual(client.tokens, []string{"page1"}) {
+		t.Errorf("listObjectsMetrics(): FAILED, expected the listing to resume from page1 but received '%v'", client.tokens)
+	}
+	if !reflect.DeepEqual(resumed, expected) {
+		t.Errorf("listObjectsMetrics(): FAILED, expected the same metrics as a full listing '%+v' but received '%+v'", expected, resumed)
+	}
+}
+
+func TestScanCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, unable to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoint, err := OpenCheckpoint(filepath.Join(dir, "scan.json"), nil)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, expected no error but received '%v'", err)
+	}
+	cached := &Bucket{Account: "123456789012", Name: "bucket1", Profile: "prod", Region: "eu-west-1", SizeBytes: 12345}
+	checkpoint.complete(scanResult{bucket: cached, keep: true})
+
+	buckets := map[string]string{"bucket1": "eu-west-1", "bucket2": "eu-west-1", "bucket3": "eu-west-1"}
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{Checkpoint: checkpoint, CostPeriod: 30, CostTag: "name", Profile: "prod", Workers: 2})
+	results, _, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Scan(): FAILED, expected 3 buckets but received '%v'", len(results))
+	}
+	for _, bucket := range results {
+		if bucket.Name == "bucket1" && bucket.SizeBytes != 12345 {
+			t.Errorf("Scan(): FAILED, expected bucket1 to come from the checkpoint but received '%+v'", bucket)
+		}
+	}
+	if listCalls := atomic.LoadInt64(&scanner.client.(*mockScanClient).listCalls); listCalls != 2 {
+		t.Errorf("Scan(): FAILED, expected the objects of 2 buckets to be listed but received '%v' listings", listCalls)
+	}
+	if checkpoint.CompletedBuckets() != 3 {
+		t.Errorf("Scan(): FAILED, expected 3 buckets in the checkpoint but received '%v'", checkpoint.CompletedBuckets())
+	}
+}
+
+func TestScanCheckpointCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, unable to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoint, err := OpenCheckpoint(filepath.Join(dir, "scan.json"), nil)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint(): FAILED, expected no error but received '%v'", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	scanner := newMockScanner(map[string]string{"bucket1": "eu-west-1"}, &mockCostClient{}, ScannerOptions{Checkpoint: checkpoint, CostPeriod: 30, CostTag: "name", Workers: 1})
+	_, _, err = scanner.Scan(ctx)
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if checkpoint.CompletedBuckets() != 0 {
+		t.Errorf("Scan(): FAILED, expected the incomplete buckets not to be recorded but received '%v' buckets", checkpoint.CompletedBuckets())
+	}
+}
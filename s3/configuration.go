@@ -0,0 +1,134 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// The keys of a bucket's ConfigurationErrors, one for every configuration fetched by SetBucketConfiguration
+const (
+	ConfigurationFieldLifecycle   = "lifecycle"
+	ConfigurationFieldReplication = "replication"
+)
+
+// SetBucketConfiguration sets the summary of the bucket's lifecycle and replication configurations
+// Only the enabled rules are taken into account. An error fetching one of the configurations (e.g. access denied) is recorded
+// in ConfigurationErrors under the configuration's key instead of being returned. An error is only returned if ctx is done
+func (b *Bucket) SetBucketConfiguration(ctx context.Context, client s3iface.S3API) error {
+	b.ConfigurationErrors = map[string]string{}
+
+	// recordError records the error of a configuration, returning the context's error if it is done
+	recordError := func(field string, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.ConfigurationErrors[field] = err.Error()
+		return nil
+	}
+
+	// Summarize the lifecycle rules, a bucket without lifecycle configuration having no rules
+	lifecycle, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(b.Name)})
+	if err != nil && !isErrorCode(err, "NoSuchLifecycleConfiguration") {
+		if err := recordError(ConfigurationFieldLifecycle, err); err != nil {
+			return err
+		}
+	} else {
+		b.setLifecycleSummary(lifecycle)
+	}
+
+	// Summarize the replication rules, a bucket without replication configuration having no destinations
+	replication, err := client.GetBucketReplicationWithContext(ctx, &s3.GetBucketReplicationInput{Bucket: aws.String(b.Name)})
+	if err != nil && !isErrorCode(err, "ReplicationConfigurationNotFoundError") {
+		if err := recordError(ConfigurationFieldReplication, err); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	destinations := map[string]bool{}
+	if replication != nil && replication.ReplicationConfiguration != nil {
+		for _, rule := range replication.ReplicationConfiguration.Rules {
+			if aws.StringValue(rule.Status) != s3.ReplicationRuleStatusEnabled || rule.Destination == nil {
+				continue
+			}
+			// The destination is a bucket ARN, e.g. arn:aws:s3:::bucket-name
+			arn := aws.StringValue(rule.Destination.Bucket)
+			destinations[arn[strings.LastIndex(arn, ":")+1:]] = true
+		}
+	}
+
+	// Get the region of every destination bucket
+	b.ReplicationDestinations = []string{}
+	regions := map[string]bool{}
+	for destination := range destinations {
+		b.ReplicationDestinations = append(b.ReplicationDestinations, destination)
+		region, err := s3manager.GetBucketRegionWithClient(ctx, client, destination)
+		if err != nil {
+			if err := recordError(ConfigurationFieldReplication, err); err != nil {
+				return err
+			}
+			continue
+		}
+		regions[region] = true
+	}
+	sort.Strings(b.ReplicationDestinations)
+	b.ReplicationRegions = sortedKeys(regions)
+
+	return nil
+}
+
+// setLifecycleSummary sets the summary of the bucket's enabled lifecycle rules
+func (b *Bucket) setLifecycleSummary(lifecycle *s3.GetBucketLifecycleConfigurationOutput) {
+	b.LifecycleRuleCount = 0
+	b.LifecycleExpiresObjects = false
+	b.LifecycleNoncurrentExpiration = false
+	b.LifecycleAbortUploadsDays = 0
+
+	transitions := map[string]bool{}
+	if lifecycle != nil {
+		for _, rule := range lifecycle.Rules {
+			if aws.StringValue(rule.Status) != s3.ExpirationStatusEnabled {
+				continue
+			}
+			b.LifecycleRuleCount++
+
+			if rule.Expiration != nil && (rule.Expiration.Days != nil || rule.Expiration.Date != nil) {
+				b.LifecycleExpiresObjects = true
+			}
+			for _, transition := range rule.Transitions {
+				transitions[aws.StringValue(transition.StorageClass)] = true
+			}
+			for _, transition := range rule.NoncurrentVersionTransitions {
+				transitions[aws.StringValue(transition.StorageClass)] = true
+			}
+			if rule.NoncurrentVersionExpiration != nil && rule.NoncurrentVersionExpiration.NoncurrentDays != nil {
+				b.LifecycleNoncurrentExpiration = true
+			}
+			// Keep the shortest delay if multiple rules abort the incomplete multipart uploads
+			if rule.AbortIncompleteMultipartUpload != nil {
+				days := int(aws.Int64Value(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+				if b.LifecycleAbortUploadsDays == 0 || days < b.LifecycleAbortUploadsDays {
+					b.LifecycleAbortUploadsDays = days
+				}
+			}
+		}
+	}
+
+	b.LifecycleTransitions = sortedKeys(transitions)
+}
+
+// sortedKeys returns the keys of a set, sorted
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// mockConfigurationClient is an S3 client serving the lifecycle and replication configurations of a bucket
+// The region of the replication destination buckets is served by mockScanClient
+type mockConfigurationClient struct {
+	*mockScanClient
+}
+
+func (m *mockConfigurationClient) GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	return &s3.GetBucketLifecycleConfigurationOutput{
+		Rules: []*s3.LifecycleRule{
+			{
+				Status:      aws.String(s3.ExpirationStatusEnabled),
+				Expiration:  &s3.LifecycleExpiration{Days: aws.Int64(365)},
+				Transitions: []*s3.Transition{{Days: aws.Int64(30), StorageClass: aws.String("STANDARD_IA")}},
+			},
+			{
+				Status:                         aws.String(s3.ExpirationStatusEnabled),
+				AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(7)},
+				NoncurrentVersionExpiration:    &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(30)},
+				NoncurrentVersionTransitions:   []*s3.NoncurrentVersionTransition{{StorageClass: aws.String("GLACIER")}},
+			},
+			{
+				Status:                         aws.String(s3.ExpirationStatusDisabled),
+				AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(1)},
+			},
+		},
+	}, nil
+}
+
+func (m *mockConfigurationClient) GetBucketReplicationWithContext(ctx aws.Context, input *s3.GetBucketReplicationInput, opts ...request.Option) (*s3.GetBucketReplicationOutput, error) {
+	return &s3.GetBucketReplicationOutput{
+		ReplicationConfiguration: &s3.ReplicationConfiguration{
+			Rules: []*s3.ReplicationRule{
+				{Status: aws.String(s3.ReplicationRuleStatusEnabled), Destination: &s3.Destination{Bucket: aws.String("arn:aws:s3:::replica")}},
+				{Status: aws.String(s3.ReplicationRuleStatusDisabled), Destination: &s3.Destination{Bucket: aws.String("arn:aws:s3:::disabled")}},
+			},
+		},
+	}, nil
+}
+
+func TestSetBucketConfiguration(t *testing.T) {
+	bucket := &Bucket{Name: "bucket1"}
+	client := &mockConfigurationClient{&mockScanClient{buckets: map[string]string{"replica": "eu-west-1"}}}
+
+	err := bucket.SetBucketConfiguration(context.Background(), client)
+	if err != nil {
+		t.Fatalf("SetBucketConfiguration(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.LifecycleRuleCount != 2 || !bucket.LifecycleExpiresObjects || !bucket.LifecycleNoncurrentExpiration || bucket.LifecycleAbortUploadsDays != 7 {
+		t.Errorf("SetBucketConfiguration(): FAILED, unexpected lifecycle summary '%+v'", bucket)
+	}
+	if len(bucket.LifecycleTransitions) != 2 || bucket.LifecycleTransitions[0] != "GLACIER" || bucket.LifecycleTransitions[1] != "STANDARD_IA" {
+		t.Errorf("SetBucketConfiguration(): FAILED, expected transitions to GLACIER and STANDARD_IA but received '%v'", bucket.LifecycleTransitions)
+	}
+	if len(bucket.ReplicationDestinations) != 1 || bucket.ReplicationDestinations[0] != "replica" {
+		t.Errorf("SetBucketConfiguration(): FAILED, expected the 'replica' destination but received '%v'", bucket.ReplicationDestinations)
+	}
+	if len(bucket.ReplicationRegions) != 1 || bucket.ReplicationRegions[0] != "eu-west-1" {
+		t.Errorf("SetBucketConfiguration(): FAILED, expected the 'eu-west-1' region but received '%v'", bucket.ReplicationRegions)
+	}
+	if len(bucket.ConfigurationErrors) != 0 {
+		t.Errorf("SetBucketConfiguration(): FAILED, expected no configuration errors but received '%v'", bucket.ConfigurationErrors)
+	}
+}
@@ -0,0 +1,149 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+)
+
+// CostReport is the S3 cost of an account over a period, grouped by value of the cost allocation tag holding the buckets' names
+// Untagged is the cost of the S3 usage without the tag, e.g. of the buckets not tagged or of the requests not tied to a bucket
+type CostReport struct {
+	Requests int
+	Tagged   map[string]float64
+	Untagged float64
+}
+
+// TagCost is the cost of the usage tagged with Value
+type TagCost struct {
+	Cost  float64
+	Value string
+}
+
+// GetCostReport fetches the S3 cost from now up to period days ago grouped by value of the tag, in a single query whose pages are
+// followed with their NextPageToken, instead of one query per bucket
+func GetCostReport(ctx context.Context, client costexploreriface.CostExplorerAPI, period int, tag string) (*CostReport, error) {
+	now := time.Now().AddDate(0, 0, 1)
+	then := now.AddDate(0, 0, -period)
+
+	param := &costexplorer.GetCostAndUsageInput{
+		Filter: &costexplorer.Expression{
+			Dimensions: &costexplorer.DimensionValues{
+				Key:    aws.String("SERVICE"),
+				Values: []*string{aws.String("Amazon Simple Storage Service")},
+			},
+		},
+		Granularity: aws.String("MONTHLY"),
+		GroupBy: []*costexplorer.GroupDefinition{
+			{
+				Key:  aws.String(tag),
+				Type: aws.String("TAG"),
+			},
+		},
+		Metrics: []*string{aws.String("AmortizedCost")},
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(then.Format("2006-01-02")),
+			End:   aws.String(now.Format("2006-01-02")),
+		},
+	}
+
+	// The keys of the groups are the tag's key and value separated by a $, the value being empty for the untagged usage
+	report := &CostReport{Tagged: map[string]float64{}}
+	for {
+		results, err := client.GetCostAndUsageWithContext(ctx, param)
+		if err != nil {
+			return nil, err
+		}
+		report.Requests++
+
+		for _, result := range results.ResultsByTime {
+			for _, group := range result.Groups {
+				if len(group.Keys) == 0 || group.Metrics["AmortizedCost"] == nil {
+					continue
+				}
+				amount, _ := strconv.ParseFloat(aws.StringValue(group.Metrics["AmortizedCost"].Amount), 64)
+				value := strings.TrimPrefix(aws.StringValue(group.Keys[0]), tag+"$")
+				if value == "" {
+					report.Untagged += amount
+				} else {
+					report.Tagged[value] += amount
+				}
+			}
+		}
+
+		if aws.StringValue(results.NextPageToken) == "" {
+			return report, nil
+		}
+		param.NextPageToken = results.NextPageToken
+	}
+}
+
+// SetBucketCost sets the bucket's cost from the report, the bucket's cost being unattributed if no usage is tagged with its name
+func (b *Bucket) SetBucketCost(report *CostReport) {
+	cost, ok := report.Tagged[b.Name]
+	b.Cost = cost
+	b.CostUnattributed = !ok
+}
+
+// Unattributed returns the costs tagged with a value matching none of the buckets, e.g. a deleted bucket or a tag holding another name
+// than its bucket's, sorted by decreasing cost
+func (r *CostReport) Unattributed(buckets []*Bucket) []TagCost {
+	names := map[string]bool{}
+	for _, bucket := range buckets {
+		names[bucket.Name] = true
+	}
+
+	var costs []TagCost
+	for value, cost := range r.Tagged {
+		if !names[value] {
+			costs = append(costs, TagCost{Cost: cost, Value: value})
+		}
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Cost != costs[j].Cost {
+			return costs[i].Cost > costs[j].Cost
+		}
+		return costs[i].Value < costs[j].Value
+	})
+	return costs
+}
+
+// costReportLoader fetches the cost report of a scan the first time a bucket needs its cost, safe for concurrent use
+// A report that could not be fetched is fetched again by the next bucket if the failure came from the bucket's context (e.g. its timeout),
+// the error being returned to every bucket otherwise
+type costReportLoader struct {
+	err    error
+	fetch  func(ctx context.Context) (*CostReport, error)
+	mutex  sync.Mutex
+	report *CostReport
+}
+
+// get returns the cost report, fetching it if needed
+func (l *costReportLoader) get(ctx context.Context) (*CostReport, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.report == nil && l.err == nil {
+		l.report, l.err = l.fetch(ctx)
+		if l.err != nil && ctx.Err() != nil {
+			err := l.err
+			l.err = nil
+			return nil, err
+		}
+	}
+	return l.report, l.err
+}
+
+// fetched returns the cost report if it was fetched
+func (l *costReportLoader) fetched() *CostReport {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.report
+}
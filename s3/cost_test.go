@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGetCostReport(t *testing.T) {
+	buckets := map[string]string{}
+	for i := 0; i < 10; i++ {
+		buckets[fmt.Sprintf("bucket%v", i)] = "eu-west-1"
+	}
+	client := &mockCostClient{buckets: buckets}
+
+	report, err := GetCostReport(context.Background(), client, 30, "name")
+	if err != nil {
+		t.Fatalf("GetCostReport(): FAILED, expected no errors but received '%v'", err)
+	}
+	// 10 buckets, a deleted bucket and the untagged usage make 12 groups, over 2 pages
+	if report.Requests != 2 || client.requests != 2 {
+		t.Errorf("GetCostReport(): FAILED, expected 2 requests but received '%v'", report.Requests)
+	}
+	if len(report.Tagged) != 11 || report.Tagged["bucket9"] != 1.5 || report.Tagged["deleted-bucket"] != 2 || report.Untagged != 0.25 {
+		t.Errorf("GetCostReport(): FAILED, unexpected report '%+v'", report)
+	}
+
+	_, err = GetCostReport(context.Background(), &mockCostClient{err: fmt.Errorf("access denied")}, 30, "name")
+	if err == nil {
+		t.Errorf("GetCostReport(): FAILED, expected an error but received none")
+	}
+}
+
+func TestSetBucketCost(t *testing.T) {
+	report := &CostReport{Tagged: map[string]float64{"bucket1": 1.5, "bucket2": 0}}
+
+	var tests = []struct {
+		name         string
+		cost         float64
+		unattributed bool
+	}{
+		{
+			name:         "bucket1",
+			cost:         1.5,
+			unattributed: false,
+		},
+		{
+			name:         "bucket2",
+			cost:         0,
+			unattributed: false,
+		},
+		{
+			name:         "bucket3",
+			cost:         0,
+			unattributed: true,
+		},
+	}
+
+	for _, test := range tests {
+		bucket := &Bucket{Name: test.name}
+		bucket.SetBucketCost(report)
+		if bucket.Cost != test.cost || bucket.CostUnattributed != test.unattributed {
+			t.Errorf("SetBucketCost(): FAILED, expected a cost of %v (unattributed: %v) for %v but received '%v' (unattributed: %v)", test.cost, test.unattributed, test.name, bucket.Cost, bucket.CostUnattributed)
+		}
+	}
+}
+
+func TestCostReportUnattributed(t *testing.T) {
+	report := &CostReport{Tagged: map[string]float64{"bucket1": 1.5, "old-bucket": 3, "other": 3, "typo": 0.5}}
+	buckets := []*Bucket{{Name: "bucket1"}, {Name: "bucket2"}}
+
+	expected := []TagCost{{Cost: 3, Value: "old-bucket"}, {Cost: 3, Value: "other"}, {Cost: 0.5, Value: "typo"}}
+	if costs := report.Unattributed(buckets); !reflect.DeepEqual(costs, expected) {
+		t.Errorf("Unattributed(): FAILED, expected '%+v' but received '%+v'", expected, costs)
+	}
+}
+
+func TestCostReportLoader(t *testing.T) {
+	fetches := 0
+	var err error
+	loader := &costReportLoader{fetch: func(ctx context.Context) (*CostReport, error) {
+		fetches++
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}}
+
+	// A report that could not be fetched because of the bucket's context is fetched again by the next bucket
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, got := loader.get(ctx); got == nil {
+		t.Errorf("get(): FAILED, expected the context's error but received none")
+	}
+	err = fmt.Errorf("access denied")
+	if _, got := loader.get(context.Background()); got != err || fetches != 2 {
+		t.Errorf("get(): FAILED, expected the report to be fetched again but received '%v' after %v fetches", got, fetches)
+	}
+
+	// Any other error is returned to every bucket without fetching the report again
+	if _, got := loader.get(context.Background()); got != err || fetches != 2 {
+		t.Errorf("get(): FAILED, expected the same error without fetching again but received '%v' after %v fetches", got, fetches)
+	}
+	if loader.fetched() != nil {
+		t.Errorf("fetched(): FAILED, expected no report but received '%+v'", loader.fetched())
+	}
+}
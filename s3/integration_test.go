@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// s3StandIn is a minimal S3 compatible service serving path-style requests, like MinIO or LocalStack would
+// It does not return the buckets' region and does not implement the security settings' operations
+type s3StandIn struct {
+	// objects contains the size of every object, per bucket
+	objects map[string][]int64
+
+	mutex sync.Mutex
+	paths []string
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.paths = append(s.paths, r.URL.Path)
+	s.mutex.Unlock()
+
+	bucket := strings.Trim(r.URL.Path, "/")
+	_, exists := s.objects[bucket]
+	switch {
+	case r.Method == http.MethodGet && bucket == "":
+		var buckets strings.Builder
+		for name := range s.objects {
+			fmt.Fprintf(&buckets, "<Bucket><Name>%v</Name><CreationDate>2020-01-01T00:00:00.000Z</CreationDate></Bucket>", name)
+		}
+		fmt.Fprintf(w, "<ListAllMyBucketsResult><Owner><ID>owner</ID></Owner><Buckets>%v</Buckets></ListAllMyBucketsResult>", buckets.String())
+	case r.Method == http.MethodHead && exists:
+		// Anonymous requests are denied, without the region header AWS would send
+		w.WriteHeader(http.StatusForbidden)
+	case r.Method == http.MethodGet && exists && r.URL.Query().Get("list-type") == "2":
+		var contents strings.Builder
+		for i, size := range s.objects[bucket] {
+			fmt.Fprintf(&contents, "<Contents><Key>object%v</Key><LastModified>2020-06-01T00:00:00.000Z</LastModified><Size>%v</Size><StorageClass>STANDARD</StorageClass></Contents>", i, size)
+		}
+		fmt.Fprintf(w, "<ListBucketResult><Name>%v</Name><IsTruncated>false</IsTruncated>%v</ListBucketResult>", bucket, contents.String())
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprint(w, "<Error><Code>NotImplemented</Code><Message>not implemented</Message></Error>")
+	}
+}
+
+func TestScanCustomEndpoint(t *testing.T) {
+	standIn := &s3StandIn{objects: map[string][]int64{"bucket1": {10, 20}, "bucket2": {}}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	scanner := NewScanner(sess, ScannerOptions{Endpoint: server.URL, PathStyle: true, Security: true, Workers: 2})
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(bucketErrors) != 0 {
+		t.Errorf("Scan(): FAILED, expected no bucket errors but received '%v'", bucketErrors)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Scan(): FAILED, expected 2 buckets but received %v", len(results))
+	}
+
+	for _, bucket := range results {
+		// The region falls back to the session's one, while the cost and account are not fetched
+		if bucket.Region != "us-east-1" || bucket.Cost != -1 || bucket.Account != "" || bucket.Incomplete {
+			t.Errorf("Scan(): FAILED, unexpected region '%v', cost '%v', account '%v' or incomplete '%v' for bucket %v",
+				bucket.Region, bucket.Cost, bucket.Account, bucket.Incomplete, bucket.Name)
+		}
+		// The unsupported security settings are recorded in the bucket without skipping it
+		if len(bucket.SecurityErrors) != 4 {
+			t.Errorf("Scan(): FAILED, expected 4 security errors for bucket %v but received '%v'", bucket.Name, bucket.SecurityErrors)
+		}
+		if bucket.Name == "bucket1" && (bucket.ObjectCount != 2 || bucket.SizeBytes != 30) {
+			t.Errorf("Scan(): FAILED, expected 2 objects of 30 bytes in bucket1 but received %v objects of %v bytes", bucket.ObjectCount, bucket.SizeBytes)
+		}
+	}
+
+	// Every request addressed the bucket in the URL's path
+	for _, path := range standIn.paths {
+		if path != "/" && path != "/bucket1" && path != "/bucket2" {
+			t.Errorf("Scan(): FAILED, unexpected request path '%v'", path)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package s3
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// inventoryManifestFilename is the name of the manifest delivered along with every inventory report
+const inventoryManifestFilename = "manifest.json"
+
+// inventoryReportRegex matches the folder of a single inventory report, named after the report's creation date, e.g. 2020-07-01T00-00Z
+var inventoryReportRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}-\d{2}Z$`)
+
+// InventoryLocation is where the reports of a bucket's inventory configuration are delivered, in the CSV, ORC or Parquet Format
+// Prefix is the common prefix of the reports, i.e. '<destination prefix>/<source bucket>/<configuration ID>/'
+type InventoryLocation struct {
+	Bucket   string
+	Format   string
+	Prefix   string
+	Versions bool
+}
+
+// InventoryFormatError is returned for the inventories in a format that cannot be read, only the CSV format being supported
+type InventoryFormatError struct {
+	Format string
+}
+
+// Error returns the error message, including the unsupported format
+func (e *InventoryFormatError) Error() string {
+	return fmt.Sprintf("unsupported inventory format %v, only %v is supported", e.Format, s3.InventoryFormatCsv)
+}
+
+// InventoryManifest is the manifest.json file describing an inventory report and the data files it is made of
+type InventoryManifest struct {
+	CreationTimestamp string          `json:"creationTimestamp"`
+	DestinationBucket string          `json:"destinationBucket"`
+	FileFormat        string          `json:"fileFormat"`
+	FileSchema        string          `json:"fileSchema"`
+	Files             []InventoryFile `json:"files"`
+	SourceBucket      string          `json:"sourceBucket"`
+}
+
+// InventoryFile is a data file of an inventory report, its key being relative to the destination bucket
+type InventoryFile struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// InventoryStore reads the files of the inventory reports, either from their destination bucket or from a local copy of it
+type InventoryStore interface {
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// S3InventoryStore reads the inventory files from their destination bucket, the client having to be in the bucket's region
+type S3InventoryStore struct {
+	Bucket string
+	Client s3iface.S3API
+}
+
+// Open returns the content of the object with the provided key
+func (s *S3InventoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// LocalInventoryStore reads the inventory files from a local directory holding a copy of the destination bucket
+// e.g. downloaded with 'aws s3 sync s3://destination-bucket dir'
+type LocalInventoryStore struct {
+	Dir string
+}
+
+// Open returns the content of the file matching the provided key
+func (s *LocalInventoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+}
+
+// GetBucketInventoryLocation returns the location of the reports of the bucket's inventory, nil if the bucket has none that can be used
+// Only the enabled inventories of the whole bucket (i.e. without prefix filter) can be used. An inventory in the CSV format is preferred,
+// the ORC and Parquet formats not being supported, and then an inventory including every version of the objects
+func (b *Bucket) GetBucketInventoryLocation(ctx context.Context, client s3iface.S3API) (*InventoryLocation, error) {
+	params := &s3.ListBucketInventoryConfigurationsInput{
+		Bucket: aws.String(b.Name),
+	}
+
+	var location *InventoryLocation
+	for {
+		output, err := client.ListBucketInventoryConfigurationsWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, configuration := range output.InventoryConfigurationList {
+			if !aws.BoolValue(configuration.IsEnabled) || configuration.Filter != nil || configuration.Destination == nil || configuration.Destination.S3BucketDestination == nil {
+				continue
+			}
+			destination := configuration.Destination.S3BucketDestination
+
+			// The reports are delivered under '<destination prefix>/<source bucket>/<configuration ID>/'
+			prefix := path.Join(aws.StringValue(destination.Prefix), b.Name, aws.StringValue(configuration.Id)) + "/"
+			current := &InventoryLocation{
+				Bucket:   strings.TrimPrefix(aws.StringValue(destination.Bucket), "arn:aws:s3:::"),
+				Format:   aws.StringValue(destination.Format),
+				Prefix:   prefix,
+				Versions: aws.StringValue(configuration.IncludedObjectVersions) == s3.InventoryIncludedObjectVersionsAll,
+			}
+			locationCSV, currentCSV := location != nil && location.Format == s3.InventoryFormatCsv, current.Format == s3.InventoryFormatCsv
+			if location == nil || (currentCSV && !locationCSV) || (currentCSV == locationCSV && current.Versions && !location.Versions) {
+				location = current
+			}
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		params.ContinuationToken = output.NextContinuationToken
+	}
+
+	return location, nil
+}
+
+// FindLatestInventoryManifest returns the key of the manifest of the latest report delivered at the provided location
+// found is false if no report has been delivered yet
+func FindLatestInventoryManifest(ctx context.Context, client s3iface.S3API, location *InventoryLocation) (key string, found bool, err error) {
+	params := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(location.Bucket),
+		Delimiter: aws.String("/"),
+		Prefix:    aws.String(location.Prefix),
+	}
+
+	// Every report has its own folder named after its creation date, next to the 'data' and 'hive' folders
+	var latest string
+	err = client.ListObjectsV2PagesWithContext(ctx, params,
+		func(page *s3.ListObjectsV2Output, last bool) bool {
+			for _, commonPrefix := range page.CommonPrefixes {
+				report := strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(commonPrefix.Prefix), location.Prefix), "/")
+				if inventoryReportRegex.MatchString(report) && report > latest {
+					latest = report
+				}
+			}
+			return true
+		},
+	)
+	if err != nil || latest == "" {
+		return "", false, err
+	}
+
+	return location.Prefix + latest + "/" + inventoryManifestFilename, true, nil
+}
+
+// IndexLocalInventoryManifests returns the key, relative to the directory, of the manifest of the latest report of every bucket found in a
+// local copy of the destination bucket, by bucket name. If the directory holds the reports of several inventories of a bucket, the latest
+// report wins
+func IndexLocalInventoryManifests(dir string) (map[string]string, error) {
+	manifests := map[string]string{}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != inventoryManifestFilename {
+			return err
+		}
+
+		// The manifest's path must be '<prefix>/<source bucket>/<configuration ID>/<report>/manifest.json'
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 4 || !inventoryReportRegex.MatchString(parts[len(parts)-2]) {
+			return nil
+		}
+		bucketName := parts[len(parts)-4]
+		if latest, ok := manifests[bucketName]; !ok || parts[len(parts)-2] > path.Base(path.Dir(latest)) {
+			manifests[bucketName] = strings.Join(parts, "/")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifests, nil
+}
+
+// ReadInventoryManifest reads and decodes the manifest with the provided key
+func ReadInventoryManifest(ctx context.Context, store InventoryStore, key string) (*InventoryManifest, error) {
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var manifest InventoryManifest
+	err = json.NewDecoder(r).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory manifest %v: %v", key, err)
+	}
+	return &manifest, nil
+}
+
+// HasVersions returns whether the report includes every version of the objects and the delete markers
+func (m *InventoryManifest) HasVersions() bool {
+	_, ok := m.schema()["IsLatest"]
+	return ok
+}
+
+// schema returns the index of every field of the report's data files
+func (m *InventoryManifest) schema() map[string]int {
+	fields := map[string]int{}
+	for i, field := range strings.Split(m.FileSchema, ",") {
+		fields[strings.TrimSpace(field)] = i
+	}
+	return fields
+}
+
+// SetBucketInventoryMetrics sets the metrics related to a bucket's objects from one of its inventory reports
+// When the report includes every version of the objects, the same fields as SetBucketVersionsMetrics are set, otherwise the same as SetBucketObjectsMetrics
+// The data files are expected to be CSV files, compressed with gzip if their key ends with '.gz'
+func (b *Bucket) SetBucketInventoryMetrics(ctx context.Context, store InventoryStore, manifest *InventoryManifest) error {
+	if manifest.FileFormat != s3.InventoryFormatCsv {
+		return &InventoryFormatError{Format: manifest.FileFormat}
+	}
+
+	schema := manifest.schema()
+	for _, field := range []string{"Size", "LastModifiedDate", "StorageClass"} {
+		if _, ok := schema[field]; !ok {
+			return fmt.Errorf("the inventory does not include the %v field", field)
+		}
+	}
+
+	metrics := newObjectsMetrics()
+	for _, file := range manifest.Files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := readInventoryFile(ctx, store, file.Key, schema, metrics)
+		if err != nil {
+			return fmt.Errorf("unable to read the inventory file %v: %v", file.Key, err)
+		}
+	}
+
+	if manifest.HasVersions() {
+		metrics.setVersions(b)
+	} else {
+		metrics.setObjects(b)
+	}
+
+	return nil
+}
+
+// readInventoryFile adds the objects of an inventory data file to the metrics
+func readInventoryFile(ctx context.Context, store InventoryStore, key string, schema map[string]int, metrics *objectsMetrics) error {
+	f, err := store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	isLatestIndex, hasVersions := schema["IsLatest"]
+	isDeleteMarkerIndex, hasDeleteMarkers := schema["IsDeleteMarker"]
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(record) < len(schema) {
+			return fmt.Errorf("expected %v fields but found %v", len(schema), len(record))
+		}
+
+		if hasDeleteMarkers && record[isDeleteMarkerIndex] == "true" {
+			metrics.deleteMarkerCount++
+			continue
+		}
+
+		size, err := strconv.ParseInt(record[schema["Size"]], 10, 64)
+		if err != nil {
+			return err
+		}
+		lastModified, err := time.Parse(time.RFC3339, record[schema["LastModifiedDate"]])
+		if err != nil {
+			return err
+		}
+		isLatest := !hasVersions || record[isLatestIndex] == "true"
+
+		metrics.addVersion(size, lastModified, record[schema["StorageClass"]], isLatest)
+	}
+}
@@ -0,0 +1,225 @@
+package s3
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// inventoryTestdata is a local copy of the 'inventory' destination bucket, its reports being delivered under the 'inventory' prefix
+const inventoryTestdata = "testdata"
+
+// mockInventoryClient is an S3 client serving the inventory configurations of a bucket, one per page, and the reports of its destination bucket
+type mockInventoryClient struct {
+	s3iface.S3API
+	configurations []*s3.InventoryConfiguration
+	reports        []string
+}
+
+func (m *mockInventoryClient) ListBucketInventoryConfigurationsWithContext(ctx aws.Context, input *s3.ListBucketInventoryConfigurationsInput, opts ...request.Option) (*s3.ListBucketInventoryConfigurationsOutput, error) {
+	page := 0
+	if input.ContinuationToken != nil {
+		page = int(aws.StringValue(input.ContinuationToken)[0] - '0')
+	}
+	output := &s3.ListBucketInventoryConfigurationsOutput{
+		InventoryConfigurationList: m.configurations[page : page+1],
+		IsTruncated:                aws.Bool(page+1 < len(m.configurations)),
+	}
+	if aws.BoolValue(output.IsTruncated) {
+		output.NextContinuationToken = aws.String(string(rune('0' + page + 1)))
+	}
+	return output, nil
+}
+
+func (m *mockInventoryClient) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	output := &s3.ListObjectsV2Output{}
+	for _, report := range m.reports {
+		output.CommonPrefixes = append(output.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(aws.StringValue(input.Prefix) + report)})
+	}
+	fn(output, true)
+	return nil
+}
+
+// newInventoryConfiguration returns an inventory configuration delivering its reports to the 'inventory' bucket
+func newInventoryConfiguration(id, format, versions string, enabled bool, filter *s3.InventoryFilter) *s3.InventoryConfiguration {
+	return &s3.InventoryConfiguration{
+		Destination: &s3.InventoryDestination{
+			S3BucketDestination: &s3.InventoryS3BucketDestination{
+				Bucket: aws.String("arn:aws:s3:::inventory"),
+				Format: aws.String(format),
+				Prefix: aws.String("reports"),
+			},
+		},
+		Filter:                 filter,
+		Id:                     aws.String(id),
+		IncludedObjectVersions: aws.String(versions),
+		IsEnabled:              aws.Bool(enabled),
+	}
+}
+
+func TestGetBucketInventoryLocation(t *testing.T) {
+	client := &mockInventoryClient{configurations: []*s3.InventoryConfiguration{
+		newInventoryConfiguration("disabled", "CSV", "All", false, nil),
+		newInventoryConfiguration("filtered", "CSV", "All", true, &s3.InventoryFilter{Prefix: aws.String("logs/")}),
+		newInventoryConfiguration("orc", "ORC", "All", true, nil),
+		newInventoryConfiguration("current", "CSV", "Current", true, nil),
+		newInventoryConfiguration("all", "CSV", "All", true, nil),
+	}}
+
+	bucket := &Bucket{Name: "bucket1"}
+	location, err := bucket.GetBucketInventoryLocation(context.Background(), client)
+	if err != nil {
+		t.Fatalf("GetBucketInventoryLocation(): FAILED, Expected no error - Received: %v", err)
+	}
+	expected := &InventoryLocation{Bucket: "inventory", Format: "CSV", Prefix: "reports/bucket1/all/", Versions: true}
+	if !reflect.DeepEqual(location, expected) {
+		t.Errorf("GetBucketInventoryLocation(): FAILED, Expected: %+v - Received: %+v", expected, location)
+	}
+
+	// Only an ORC inventory, which is returned for its format to be reported
+	client.configurations = client.configurations[:3]
+	location, err = bucket.GetBucketInventoryLocation(context.Background(), client)
+	expected = &InventoryLocation{Bucket: "inventory", Format: "ORC", Prefix: "reports/bucket1/orc/", Versions: true}
+	if err != nil || !reflect.DeepEqual(location, expected) {
+		t.Errorf("GetBucketInventoryLocation(): FAILED, Expected: %+v - Received: %+v, %v", expected, location, err)
+	}
+
+	// No usable inventory
+	client.configurations = client.configurations[:2]
+	location, err = bucket.GetBucketInventoryLocation(context.Background(), client)
+	if err != nil || location != nil {
+		t.Errorf("GetBucketInventoryLocation(): FAILED, Expected no location - Received: %+v, %v", location, err)
+	}
+}
+
+func TestFindLatestInventoryManifest(t *testing.T) {
+	location := &InventoryLocation{Bucket: "inventory", Prefix: "reports/bucket1/all/"}
+
+	client := &mockInventoryClient{reports: []string{"2020-07-01T00-00Z/", "data/", "2020-07-03T00-00Z/", "hive/", "2020-07-02T00-00Z/"}}
+	key, found, err := FindLatestInventoryManifest(context.Background(), client, location)
+	if err != nil || !found || key != "reports/bucket1/all/2020-07-03T00-00Z/manifest.json" {
+		t.Errorf("FindLatestInventoryManifest(): FAILED, Expected the 2020-07-03 manifest - Received: %v, %v, %v", key, found, err)
+	}
+
+	client = &mockInventoryClient{reports: []string{"data/"}}
+	key, found, err = FindLatestInventoryManifest(context.Background(), client, location)
+	if err != nil || found {
+		t.Errorf("FindLatestInventoryManifest(): FAILED, Expected no manifest - Received: %v, %v, %v", key, found, err)
+	}
+}
+
+func TestIndexLocalInventoryManifests(t *testing.T) {
+	manifests, err := IndexLocalInventoryManifests(inventoryTestdata)
+	if err != nil {
+		t.Fatalf("IndexLocalInventoryManifests(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	// The latest report of bucket1 wins, bucket3 having no report
+	expected := map[string]string{
+		"bucket1": "inventory/bucket1/daily/2020-07-02T00-00Z/manifest.json",
+		"bucket2": "inventory/bucket2/versions/2020-07-02T00-00Z/manifest.json",
+		"bucket4": "inventory/bucket4/parquet/2020-07-02T00-00Z/manifest.json",
+	}
+	if !reflect.DeepEqual(manifests, expected) {
+		t.Errorf("IndexLocalInventoryManifests(): FAILED, Expected: %v - Received: %v", expected, manifests)
+	}
+}
+
+func TestSetBucketInventoryMetrics(t *testing.T) {
+	store := &LocalInventoryStore{Dir: inventoryTestdata}
+
+	// A report of the current versions, made of gzipped files
+	manifest, err := ReadInventoryManifest(context.Background(), store, "inventory/bucket1/daily/2020-07-02T00-00Z/manifest.json")
+	if err != nil {
+		t.Fatalf("ReadInventoryManifest(): FAILED, Expected no error - Received: %v", err)
+	}
+	bucket := &Bucket{Name: "bucket1"}
+	err = bucket.SetBucketInventoryMetrics(context.Background(), store, manifest)
+	if err != nil {
+		t.Fatalf("SetBucketInventoryMetrics(): FAILED, Expected no error - Received: %v", err)
+	}
+	expected := &Bucket{
+		LastModified:            time.Date(2020, time.June, 15, 10, 0, 0, 0, time.UTC),
+		Name:                    "bucket1",
+		ObjectCount:             4,
+		SizeBytes:               2000,
+		StorageClassesBytes:     map[string]int64{"STANDARD": 400, "GLACIER": 1600},
+		StorageClassesSizeStats: map[string]float64{"STANDARD": 20, "GLACIER": 80},
+		StorageClassesStats:     map[string]float64{"STANDARD": 50, "GLACIER": 50},
+	}
+	if !reflect.DeepEqual(bucket, expected) {
+		t.Errorf("SetBucketInventoryMetrics(): FAILED, Expected: %+v - Received: %+v", expected, bucket)
+	}
+
+	// A report of every version, including a delete marker
+	manifest, err = ReadInventoryManifest(context.Background(), store, "inventory/bucket2/versions/2020-07-02T00-00Z/manifest.json")
+	if err != nil {
+		t.Fatalf("ReadInventoryManifest(): FAILED, Expected no error - Received: %v", err)
+	}
+	if !manifest.HasVersions() {
+		t.Errorf("HasVersions(): FAILED, Expected the bucket2 report to include the versions")
+	}
+	bucket = &Bucket{Name: "bucket2"}
+	err = bucket.SetBucketInventoryMetrics(context.Background(), store, manifest)
+	if err != nil {
+		t.Fatalf("SetBucketInventoryMetrics(): FAILED, Expected no error - Received: %v", err)
+	}
+	expected = &Bucket{
+		DeleteMarkerCount:             1,
+		LastModified:                  time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Name:                          "bucket2",
+		NoncurrentObjectCount:         2,
+		NoncurrentSizeBytes:           150,
+		NoncurrentStorageClassesStats: map[string]float64{"STANDARD": 50, "GLACIER": 100},
+		ObjectCount:                   1,
+		SizeBytes:                     200,
+		StorageClassesBytes:           map[string]int64{"STANDARD": 200},
+		StorageClassesSizeStats:       map[string]float64{"STANDARD": 100},
+		StorageClassesStats:           map[string]float64{"STANDARD": 100},
+	}
+	if !reflect.DeepEqual(bucket, expected) {
+		t.Errorf("SetBucketInventoryMetrics(): FAILED, Expected: %+v - Received: %+v", expected, bucket)
+	}
+
+	// The ORC and Parquet formats are not supported
+	manifest.FileFormat = "Parquet"
+	err = bucket.SetBucketInventoryMetrics(context.Background(), store, manifest)
+	if _, ok := err.(*InventoryFormatError); !ok {
+		t.Errorf("SetBucketInventoryMetrics(): FAILED, Expected an unsupported inventory format error for the Parquet format - Received: %v", err)
+	}
+}
+
+func TestScanInventory(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1", "bucket3": "eu-west-1", "bucket4": "eu-west-1"}
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{InventoryDir: inventoryTestdata, MetricsSource: MetricsSourceInventory, Workers: 2})
+
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	// bucket4's Parquet inventory is reported, the bucket being listed instead
+	expectedError := "unable to read the inventory for bucket bucket4: unsupported inventory format Parquet, only CSV is supported"
+	if len(bucketErrors) != 1 || bucketErrors[0].Error() != expectedError {
+		t.Errorf("Scan(): FAILED, expected the '%v' error but received '%v'", expectedError, bucketErrors)
+	}
+
+	// bucket1 is read from its inventory while bucket3, without inventory, and bucket4 are listed
+	objectCounts := map[string]int{}
+	for _, bucket := range results {
+		objectCounts[bucket.Name] = bucket.ObjectCount
+	}
+	expected := map[string]int{"bucket1": 4, "bucket3": 1, "bucket4": 1}
+	if !reflect.DeepEqual(objectCounts, expected) {
+		t.Errorf("Scan(): FAILED, expected the objects counts to be %v but received %v", expected, objectCounts)
+	}
+	if listCalls := scanner.client.(*mockScanClient).listCalls; listCalls != 2 {
+		t.Errorf("Scan(): FAILED, expected 2 objects listings but %v were made", listCalls)
+	}
+}
@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// The sources of the objects metrics
+// MetricsSourceList lists every object, MetricsSourceCloudWatch reads S3's daily storage metrics from CloudWatch and
+// MetricsSourceAuto reads the CloudWatch metrics, listing the objects of the buckets without datapoints, and
+// MetricsSourceInventory reads the buckets' S3 Inventory reports, listing the objects of the buckets without one
+const (
+	MetricsSourceAuto       = "auto"
+	MetricsSourceCloudWatch = "cloudwatch"
+	MetricsSourceInventory  = "inventory"
+	MetricsSourceList       = "list"
+)
+
+// cloudWatchLookback is how far back the CloudWatch metrics are read
+// S3 publishes its storage metrics once a day, usually with a delay of one or two days
+const cloudWatchLookback = 3 * 24 * time.Hour
+
+// cloudWatchStorageTypes maps the StorageType dimension of the BucketSizeBytes metric to its storage class
+// Only the types holding the objects' data are read, the overheads (e.g. GlacierObjectOverhead) not being part of the objects' sizes
+var cloudWatchStorageTypes = map[string]string{
+	"DeepArchiveStorage":             "DEEP_ARCHIVE",
+	"GlacierInstantRetrievalStorage": "GLACIER_IR",
+	"GlacierStorage":                 "GLACIER",
+	"IntelligentTieringAAStorage":    "INTELLIGENT_TIERING",
+	"IntelligentTieringAIAStorage":   "INTELLIGENT_TIERING",
+	"IntelligentTieringDAAStorage":   "INTELLIGENT_TIERING",
+	"IntelligentTieringFAStorage":    "INTELLIGENT_TIERING",
+	"IntelligentTieringIAStorage":    "INTELLIGENT_TIERING",
+	"OneZoneIAStorage":               "ONEZONE_IA",
+	"ReducedRedundancyStorage":       "REDUCED_REDUNDANCY",
+	"StandardIAStorage":              "STANDARD_IA",
+	"StandardStorage":                "STANDARD",
+}
+
+// SetBucketCloudWatchMetrics sets the bucket's objects count, size and storage classes from S3's daily storage metrics in CloudWatch
+// It returns false, leaving the bucket untouched, if CloudWatch has no recent datapoint for the bucket, e.g. for a new bucket
+// The number of objects per storage class being unknown, StorageClassesStats is weighted by the bytes like StorageClassesSizeStats,
+// the last modification date is not available and the metrics include the previous versions of the objects
+func (b *Bucket) SetBucketCloudWatchMetrics(ctx context.Context, client cloudwatchiface.CloudWatchAPI) (bool, error) {
+	storageTypes := make([]string, 0, len(cloudWatchStorageTypes))
+	for storageType := range cloudWatchStorageTypes {
+		storageTypes = append(storageTypes, storageType)
+	}
+	sort.Strings(storageTypes)
+
+	// Query the size of every storage type and the number of objects in a single call, the IDs mapping the results back to their storage type
+	queries := []*cloudwatch.MetricDataQuery{newBucketMetricQuery("objects", b.Name, "NumberOfObjects", "AllStorageTypes")}
+	queryStorageTypes := map[string]string{}
+	for i, storageType := range storageTypes {
+		id := "size" + strconv.Itoa(i)
+		queries = append(queries, newBucketMetricQuery(id, b.Name, "BucketSizeBytes", storageType))
+		queryStorageTypes[id] = storageType
+	}
+
+	now := time.Now()
+	params := &cloudwatch.GetMetricDataInput{
+		EndTime:           aws.Time(now),
+		MetricDataQueries: queries,
+		ScanBy:            aws.String(cloudwatch.ScanByTimestampDescending),
+		StartTime:         aws.Time(now.Add(-cloudWatchLookback)),
+	}
+
+	// Keep the most recent value of every query, the values being sorted from the most recent one
+	latest := map[string]float64{}
+	for {
+		output, err := client.GetMetricDataWithContext(ctx, params)
+		if err != nil {
+			return false, err
+		}
+		for _, result := range output.MetricDataResults {
+			id := aws.StringValue(result.Id)
+			if _, ok := latest[id]; !ok && len(result.Values) > 0 {
+				latest[id] = aws.Float64Value(result.Values[0])
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		params.NextToken = output.NextToken
+	}
+	if len(latest) == 0 {
+		return false, nil
+	}
+
+	var sizeBytes int64
+	storageClassesBytes := map[string]int64{}
+	for id, value := range latest {
+		if storageType, ok := queryStorageTypes[id]; ok && value > 0 {
+			sizeBytes += int64(value)
+			storageClassesBytes[cloudWatchStorageTypes[storageType]] += int64(value)
+		}
+	}
+
+	b.ObjectCount = int(latest["objects"])
+	b.SizeBytes = sizeBytes
+	b.setStorageClassesBytes(storageClassesBytes)
+	b.StorageClassesStats = b.StorageClassesSizeStats
+
+	return true, nil
+}
+
+// newBucketMetricQuery returns the query of the daily average of one of the bucket's S3 metrics for the provided storage type
+func newBucketMetricQuery(id, bucketName, metricName, storageType string) *cloudwatch.MetricDataQuery {
+	return &cloudwatch.MetricDataQuery{
+		Id: aws.String(id),
+		MetricStat: &cloudwatch.MetricStat{
+			Metric: &cloudwatch.Metric{
+				Dimensions: []*cloudwatch.Dimension{
+					{Name: aws.String("BucketName"), Value: aws.String(bucketName)},
+					{Name: aws.String("StorageType"), Value: aws.String(storageType)},
+				},
+				MetricName: aws.String(metricName),
+				Namespace:  aws.String("AWS/S3"),
+			},
+			Period: aws.Int64(int64(24 * time.Hour / time.Second)),
+			Stat:   aws.String("Average"),
+		},
+	}
+}
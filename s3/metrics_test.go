@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// mockMetricsClient is a CloudWatch client serving the latest value of the metrics of a set of buckets, by metric name and storage type
+// Every result is returned on its own page to exercise the pagination. calls counts the GetMetricData calls
+type mockMetricsClient struct {
+	cloudwatchiface.CloudWatchAPI
+	calls   int64
+	metrics map[string]map[string]float64
+}
+
+func (m *mockMetricsClient) GetMetricDataWithContext(ctx aws.Context, input *cloudwatch.GetMetricDataInput, opts ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	atomic.AddInt64(&m.calls, 1)
+
+	page := 0
+	if input.NextToken != nil {
+		page = int(aws.StringValue(input.NextToken)[0] - '0')
+	}
+	query := input.MetricDataQueries[page]
+
+	dimensions := map[string]string{}
+	for _, dimension := range query.MetricStat.Metric.Dimensions {
+		dimensions[aws.StringValue(dimension.Name)] = aws.StringValue(dimension.Value)
+	}
+	result := &cloudwatch.MetricDataResult{Id: query.Id}
+	key := aws.StringValue(query.MetricStat.Metric.MetricName) + "/" + dimensions["StorageType"]
+	if value, ok := m.metrics[dimensions["BucketName"]][key]; ok {
+		// The most recent value comes first, followed by an older one which must be ignored
+		result.Values = []*float64{aws.Float64(value), aws.Float64(value * 2)}
+	}
+
+	output := &cloudwatch.GetMetricDataOutput{MetricDataResults: []*cloudwatch.MetricDataResult{result}}
+	if page+1 < len(input.MetricDataQueries) {
+		output.NextToken = aws.String(string(rune('0' + page + 1)))
+	}
+	return output, nil
+}
+
+func TestSetBucketCloudWatchMetrics(t *testing.T) {
+	client := &mockMetricsClient{metrics: map[string]map[string]float64{
+		"bucket1": {
+			"NumberOfObjects/AllStorageTypes":    11,
+			"BucketSizeBytes/StandardStorage":    100,
+			"BucketSizeBytes/GlacierStorage":     700,
+			"BucketSizeBytes/DeepArchiveStorage": 200,
+		},
+	}}
+
+	bucket := &Bucket{Name: "bucket1"}
+	found, err := bucket.SetBucketCloudWatchMetrics(context.Background(), client)
+	if err != nil || !found {
+		t.Fatalf("SetBucketCloudWatchMetrics(): FAILED, Expected the metrics to be found - Received: %v, %v", found, err)
+	}
+
+	expected := &Bucket{
+		Name:                    "bucket1",
+		ObjectCount:             11,
+		SizeBytes:               1000,
+		StorageClassesBytes:     map[string]int64{"STANDARD": 100, "GLACIER": 700, "DEEP_ARCHIVE": 200},
+		StorageClassesSizeStats: map[string]float64{"STANDARD": 10, "GLACIER": 70, "DEEP_ARCHIVE": 20},
+		StorageClassesStats:     map[string]float64{"STANDARD": 10, "GLACIER": 70, "DEEP_ARCHIVE": 20},
+	}
+	if !reflect.DeepEqual(bucket, expected) {
+		t.Errorf("SetBucketCloudWatchMetrics(): FAILED, Expected: %+v - Received: %+v", expected, bucket)
+	}
+
+	// A bucket without datapoints is left untouched
+	bucket = &Bucket{Name: "bucket2"}
+	found, err = bucket.SetBucketCloudWatchMetrics(context.Background(), client)
+	if err != nil || found {
+		t.Errorf("SetBucketCloudWatchMetrics(): FAILED, Expected no metrics to be found - Received: %v, %v", found, err)
+	}
+	if !reflect.DeepEqual(bucket, &Bucket{Name: "bucket2"}) {
+		t.Errorf("SetBucketCloudWatchMetrics(): FAILED, Expected the bucket to be untouched - Received: %+v", bucket)
+	}
+}
+
+func TestScanMetricsSource(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1", "bucket2": "eu-west-1"}
+	metrics := map[string]map[string]float64{
+		"bucket1": {"NumberOfObjects/AllStorageTypes": 5, "BucketSizeBytes/StandardStorage": 5000},
+	}
+
+	var tests = []struct {
+		metricsSource string
+		objectCounts  map[string]int
+		listCalls     int64
+	}{
+		{
+			metricsSource: MetricsSourceList,
+			objectCounts:  map[string]int{"bucket1": 1, "bucket2": 1},
+			listCalls:     2,
+		},
+		{
+			metricsSource: MetricsSourceCloudWatch,
+			objectCounts:  map[string]int{"bucket1": 5, "bucket2": 0},
+			listCalls:     0,
+		},
+		{
+			metricsSource: MetricsSourceAuto,
+			objectCounts:  map[string]int{"bucket1": 5, "bucket2": 1},
+			listCalls:     1,
+		},
+	}
+
+	for _, test := range tests {
+		metricsClient := &mockMetricsClient{metrics: metrics}
+		scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{MetricsSource: test.metricsSource, Workers: 2})
+		scanner.regionClients = newRegionClients(func(region string) *regionalClients {
+			return &regionalClients{cloudWatch: metricsClient, s3: scanner.client}
+		})
+
+		results, bucketErrors, err := scanner.Scan(context.Background())
+		if err != nil || len(bucketErrors) != 0 {
+			t.Fatalf("Scan(): FAILED, expected no errors but received '%v' and '%v'", err, bucketErrors)
+		}
+
+		objectCounts := map[string]int{}
+		for _, bucket := range results {
+			objectCounts[bucket.Name] = bucket.ObjectCount
+		}
+		if !reflect.DeepEqual(objectCounts, test.objectCounts) {
+			t.Errorf("Scan(): FAILED, expected the %v objects counts to be %v but received %v", test.metricsSource, test.objectCounts, objectCounts)
+		}
+		if listCalls := scanner.client.(*mockScanClient).listCalls; listCalls != test.listCalls {
+			t.Errorf("Scan(): FAILED, expected %v objects listings with the %v source but %v were made", test.listCalls, test.metricsSource, listCalls)
+		}
+		if test.metricsSource == MetricsSourceList && metricsClient.calls != 0 {
+			t.Errorf("Scan(): FAILED, expected CloudWatch not to be called with the %v source but it was called %v times", test.metricsSource, metricsClient.calls)
+		}
+	}
+}
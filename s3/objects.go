@@ -0,0 +1,186 @@
+package s3
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// objectsMetrics accumulates the metrics of a bucket's objects, whatever they are read from (a listing, an inventory)
+// The current versions are counted apart from the previous ones and the delete markers
+type objectsMetrics struct {
+	deleteMarkerCount        int
+	lastModified             time.Time
+	noncurrentObjectCount    int
+	noncurrentSizeBytes      int64
+	noncurrentStorageClasses map[string]float64
+	objectCount              int
+	sizeBytes                int64
+	storageClasses           map[string]float64
+	storageClassesBytes      map[string]int64
+	versionsStorageClasses   map[string]float64
+}
+
+// newObjectsMetrics returns empty metrics
+func newObjectsMetrics() *objectsMetrics {
+	return &objectsMetrics{
+		noncurrentStorageClasses: map[string]float64{},
+		storageClasses:           map[string]float64{},
+		storageClassesBytes:      map[string]int64{},
+		versionsStorageClasses:   map[string]float64{},
+	}
+}
+
+// objectsMetricsJSON is the representation of objectsMetrics saved in the checkpoints
+type objectsMetricsJSON struct {
+	DeleteMarkerCount        int                `json:"delete_marker_count"`
+	LastModified             time.Time          `json:"last_modified"`
+	NoncurrentObjectCount    int                `json:"noncurrent_object_count"`
+	NoncurrentSizeBytes      int64              `json:"noncurrent_size_bytes"`
+	NoncurrentStorageClasses map[string]float64 `json:"noncurrent_storage_classes"`
+	ObjectCount              int                `json:"object_count"`
+	SizeBytes                int64              `json:"size_bytes"`
+	StorageClasses           map[string]float64 `json:"storage_classes"`
+	StorageClassesBytes      map[string]int64   `json:"storage_classes_bytes"`
+	VersionsStorageClasses   map[string]float64 `json:"versions_storage_classes"`
+}
+
+// MarshalJSON encodes the metrics, e.g. to save them in a checkpoint
+func (m *objectsMetrics) MarshalJSON() ([]byte, error) {
+	return json.Marshal(objectsMetricsJSON{
+		DeleteMarkerCount:        m.deleteMarkerCount,
+		LastModified:             m.lastModified,
+		NoncurrentObjectCount:    m.noncurrentObjectCount,
+		NoncurrentSizeBytes:      m.noncurrentSizeBytes,
+		NoncurrentStorageClasses: m.noncurrentStorageClasses,
+		ObjectCount:              m.objectCount,
+		SizeBytes:                m.sizeBytes,
+		StorageClasses:           m.storageClasses,
+		StorageClassesBytes:      m.storageClassesBytes,
+		VersionsStorageClasses:   m.versionsStorageClasses,
+	})
+}
+
+// UnmarshalJSON decodes the metrics encoded by MarshalJSON
+func (m *objectsMetrics) UnmarshalJSON(data []byte) error {
+	var decoded objectsMetricsJSON
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	*m = *newObjectsMetrics()
+	m.deleteMarkerCount = decoded.DeleteMarkerCount
+	m.lastModified = decoded.LastModified
+	m.noncurrentObjectCount = decoded.NoncurrentObjectCount
+	m.noncurrentSizeBytes = decoded.NoncurrentSizeBytes
+	m.objectCount = decoded.ObjectCount
+	m.sizeBytes = decoded.SizeBytes
+	m.merge(&objectsMetrics{
+		noncurrentStorageClasses: decoded.NoncurrentStorageClasses,
+		storageClasses:           decoded.StorageClasses,
+		storageClassesBytes:      decoded.StorageClassesBytes,
+		versionsStorageClasses:   decoded.VersionsStorageClasses,
+	})
+	return nil
+}
+
+// addVersion counts a version of an object, isLatest telling whether it is the current version
+func (m *objectsMetrics) addVersion(size int64, lastModified time.Time, storageClass string, isLatest bool) {
+	m.versionsStorageClasses[storageClass]++
+	if isLatest {
+		m.objectCount++
+		m.sizeBytes += size
+		if lastModified.After(m.lastModified) {
+			m.lastModified = lastModified
+		}
+		m.storageClasses[storageClass]++
+		m.storageClassesBytes[storageClass] += size
+	} else {
+		m.noncurrentObjectCount++
+		m.noncurrentSizeBytes += size
+		m.noncurrentStorageClasses[storageClass]++
+	}
+}
+
+// merge adds the metrics of other, e.g. the ones of a prefix listed apart, to m
+func (m *objectsMetrics) merge(other *objectsMetrics) {
+	m.deleteMarkerCount += other.deleteMarkerCount
+	if other.lastModified.After(m.lastModified) {
+		m.lastModified = other.lastModified
+	}
+	m.noncurrentObjectCount += other.noncurrentObjectCount
+	m.noncurrentSizeBytes += other.noncurrentSizeBytes
+	m.objectCount += other.objectCount
+	m.sizeBytes += other.sizeBytes
+	for class, count := range other.noncurrentStorageClasses {
+		m.noncurrentStorageClasses[class] += count
+	}
+	for class, count := range other.storageClasses {
+		m.storageClasses[class] += count
+	}
+	for class, bytes := range other.storageClassesBytes {
+		m.storageClassesBytes[class] += bytes
+	}
+	for class, count := range other.versionsStorageClasses {
+		m.versionsStorageClasses[class] += count
+	}
+}
+
+// storageClassesStats returns the share of the current versions of the objects in every storage class
+func (m *objectsMetrics) storageClassesStats() map[string]float64 {
+	storageClasses := map[string]float64{}
+	for class, count := range m.storageClasses {
+		storageClasses[class] = count / float64(m.objectCount) * 100
+	}
+	return storageClasses
+}
+
+// setObjects sets the bucket's metrics of the current versions of the objects
+// StorageClassesStats contains the share of the objects in every storage class and StorageClassesSizeStats the share of their bytes
+func (m *objectsMetrics) setObjects(b *Bucket) {
+	b.ObjectCount = m.objectCount
+	b.SizeBytes = m.sizeBytes
+	b.LastModified = m.lastModified
+	b.StorageClassesStats = m.storageClassesStats()
+	b.setStorageClassesBytes(m.storageClassesBytes)
+}
+
+// setVersions sets the bucket's metrics of the current versions of the objects along with the ones of the previous versions and the delete markers
+// NoncurrentStorageClassesStats contains, for every storage class, the share of its versions that are noncurrent
+func (m *objectsMetrics) setVersions(b *Bucket) {
+	m.setObjects(b)
+
+	noncurrentStorageClasses := map[string]float64{}
+	for class, count := range m.versionsStorageClasses {
+		noncurrentStorageClasses[class] = m.noncurrentStorageClasses[class] / count * 100
+	}
+
+	b.NoncurrentObjectCount = m.noncurrentObjectCount
+	b.NoncurrentSizeBytes = m.noncurrentSizeBytes
+	b.NoncurrentStorageClassesStats = noncurrentStorageClasses
+	b.DeleteMarkerCount = m.deleteMarkerCount
+}
+
+// setStorageClassesBytes sets the bytes stored in every storage class along with their share of the bucket's size
+func (b *Bucket) setStorageClassesBytes(storageClassesBytes map[string]int64) {
+	b.StorageClassesBytes = storageClassesBytes
+	b.StorageClassesSizeStats = storageClassesSizeStats(storageClassesBytes)
+}
+
+// storageClassesSizeStats returns the share of the bytes stored in every storage class
+// The classes without any byte (e.g. holding only empty objects) have a share of 0
+func storageClassesSizeStats(storageClassesBytes map[string]int64) map[string]float64 {
+	var sizeBytes int64
+	for _, bytes := range storageClassesBytes {
+		sizeBytes += bytes
+	}
+
+	sizeStats := map[string]float64{}
+	for class, bytes := range storageClassesBytes {
+		sizeStats[class] = 0
+		if sizeBytes > 0 {
+			sizeStats[class] = float64(bytes) / float64(sizeBytes) * 100
+		}
+	}
+	return sizeStats
+}
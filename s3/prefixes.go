@@ -0,0 +1,180 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DrillOptions contains the options used to break a bucket's objects down by prefix
+type DrillOptions struct {
+	// Delimiter is the character separating the levels of the keys, '/' if empty
+	Delimiter string
+	// Depth is the number of levels the objects are broken down to, the objects below the last level being counted in their level's prefix
+	Depth int
+	// Prefix, when set, only breaks down the objects under this prefix, its levels being counted from it
+	Prefix string
+	// Workers is the number of prefixes being listed at the same time
+	Workers int
+}
+
+// Prefix contains the metrics of the current versions of the objects under a prefix of a bucket, the prefix included
+// The metrics of a prefix include the ones of its children, the objects right under it not being under any of them
+type Prefix struct {
+	Prefix                  string
+	Depth                   int
+	ObjectCount             int
+	SizeBytes               int64
+	LastModified            time.Time
+	StorageClassesStats     map[string]float64
+	StorageClassesSizeStats map[string]float64
+	StorageClassesBytes     map[string]int64
+	// Children contains the prefixes of the next level, from the biggest to the smallest
+	Children []*Prefix
+
+	// metrics accumulates the objects listed right under the prefix, or every object under it at the last level
+	metrics *objectsMetrics
+}
+
+// Walk calls fn for the prefix and every prefix below it, depth first, in the order of the children
+func (p *Prefix) Walk(fn func(prefix *Prefix)) {
+	fn(p)
+	for _, child := range p.Children {
+		child.Walk(fn)
+	}
+}
+
+// DrillBucket breaks the bucket's objects down by prefix, up to options.Depth levels below options.Prefix, and returns the prefix it started from
+// Every level is listed with a delimiter to find the prefixes of the next one, the prefixes being listed in parallel, while the prefixes
+// of the last level are listed without delimiter. The client must be in the bucket's region
+func DrillBucket(ctx context.Context, client s3iface.S3API, bucket string, options DrillOptions) (*Prefix, error) {
+	if options.Delimiter == "" {
+		options.Delimiter = "/"
+	}
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+
+	// Stop listing the other prefixes as soon as one of them fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The workers take the prefixes to list from the queue, adding their children to it. pending counts the prefixes queued or being
+	// listed, the workers stopping once it gets to 0. Every prefix is only written to by the worker listing it, before its children are queued
+	root := newPrefix(options.Prefix, 0)
+	queue := []*Prefix{root}
+	pending := 1
+	var drillErr error
+	var mutex sync.Mutex
+	cond := sync.NewCond(&mutex)
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mutex.Lock()
+				for len(queue) == 0 && pending > 0 {
+					cond.Wait()
+				}
+				if len(queue) == 0 {
+					mutex.Unlock()
+					return
+				}
+				prefix := queue[0]
+				queue = queue[1:]
+				failed := drillErr != nil
+				mutex.Unlock()
+
+				var err error
+				if !failed {
+					err = listPrefixObjects(ctx, client, bucket, prefix, options)
+				}
+
+				mutex.Lock()
+				if err != nil && drillErr == nil {
+					drillErr = err
+					cancel()
+				}
+				if err == nil && !failed {
+					queue = append(queue, prefix.Children...)
+					pending += len(prefix.Children)
+				}
+				pending--
+				cond.Broadcast()
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if drillErr != nil {
+		return nil, drillErr
+	}
+
+	root.aggregate()
+	return root, nil
+}
+
+// newPrefix returns an empty prefix
+func newPrefix(prefix string, depth int) *Prefix {
+	return &Prefix{
+		Prefix:  prefix,
+		Depth:   depth,
+		metrics: newObjectsMetrics(),
+	}
+}
+
+// listPrefixObjects adds the objects right under the prefix to its metrics and its next level's prefixes to its children
+// At the last level, every object under the prefix is added to its metrics
+func listPrefixObjects(ctx context.Context, client s3iface.S3API, bucket string, prefix *Prefix, options DrillOptions) error {
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+	if prefix.Prefix != "" {
+		params.Prefix = aws.String(prefix.Prefix)
+	}
+	if prefix.Depth < options.Depth {
+		params.Delimiter = aws.String(options.Delimiter)
+	}
+
+	return client.ListObjectsV2PagesWithContext(ctx, params,
+		func(page *s3.ListObjectsV2Output, last bool) bool {
+			for _, obj := range page.Contents {
+				prefix.metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+			}
+			for _, commonPrefix := range page.CommonPrefixes {
+				prefix.Children = append(prefix.Children, newPrefix(aws.StringValue(commonPrefix.Prefix), prefix.Depth+1))
+			}
+			return true
+		},
+	)
+}
+
+// aggregate adds the metrics of the children to the prefix's, sets its exported metrics and sorts its children by size
+func (p *Prefix) aggregate() {
+	for _, child := range p.Children {
+		child.aggregate()
+		p.metrics.merge(child.metrics)
+	}
+
+	p.ObjectCount = p.metrics.objectCount
+	p.SizeBytes = p.metrics.sizeBytes
+	p.LastModified = p.metrics.lastModified
+	p.StorageClassesStats = p.metrics.storageClassesStats()
+	p.StorageClassesBytes = p.metrics.storageClassesBytes
+	p.StorageClassesSizeStats = storageClassesSizeStats(p.StorageClassesBytes)
+
+	sort.SliceStable(p.Children, func(i, j int) bool {
+		if p.Children[i].SizeBytes != p.Children[j].SizeBytes {
+			return p.Children[i].SizeBytes > p.Children[j].SizeBytes
+		}
+		return p.Children[i].Prefix < p.Children[j].Prefix
+	})
+}
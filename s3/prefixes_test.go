@@ -0,0 +1,177 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// mockPrefixesClient lists its objects the way S3 does, grouping the keys into common prefixes when a delimiter is set
+// Listing the failPrefix returns an error. Every listing takes delay, maxGoroutines being the most goroutines seen while listing
+type mockPrefixesClient struct {
+	s3iface.S3API
+	objects    []*s3.Object
+	failPrefix string
+
+	delay         time.Duration
+	maxGoroutines int32
+}
+
+func (m *mockPrefixesClient) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	for goroutines := int32(runtime.NumGoroutine()); ; {
+		max := atomic.LoadInt32(&m.maxGoroutines)
+		if goroutines <= max || atomic.CompareAndSwapInt32(&m.maxGoroutines, max, goroutines) {
+			break
+		}
+	}
+	time.Sleep(m.delay)
+
+	prefix := aws.StringValue(input.Prefix)
+	delimiter := aws.StringValue(input.Delimiter)
+	if m.failPrefix != "" && prefix == m.failPrefix {
+		return errors.New("AccessDenied")
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	commonPrefixes := map[string]bool{}
+	for _, obj := range m.objects {
+		key := aws.StringValue(obj.Key)
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			commonPrefixes[key[:len(prefix)+i+len(delimiter)]] = true
+			continue
+		}
+		output.Contents = append(output.Contents, obj)
+	}
+
+	names := make([]string, 0, len(commonPrefixes))
+	for name := range commonPrefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output.CommonPrefixes = append(output.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(name)})
+	}
+
+	fn(output, true)
+	return nil
+}
+
+// newMockPrefixesClient returns a client listing a few objects spread over the 'data/' and 'logs/' prefixes
+func newMockPrefixesClient() *mockPrefixesClient {
+	object := func(key string, size int64, class string, day int) *s3.Object {
+		return &s3.Object{Key: aws.String(key), LastModified: aws.Time(time.Date(2020, time.March, day, 0, 0, 0, 0, time.UTC)), Size: aws.Int64(size), StorageClass: aws.String(class)}
+	}
+	return &mockPrefixesClient{
+		objects: []*s3.Object{
+			object("data/deep/y/z", 10, "STANDARD", 1),
+			object("data/x", 1000, "GLACIER", 2),
+			object("logs/2020/a", 100, "STANDARD", 3),
+			object("logs/2020/b", 100, "STANDARD", 4),
+			object("logs/2021/c", 300, "GLACIER", 5),
+			object("root.txt", 5, "STANDARD", 6),
+		},
+	}
+}
+
+// flattenPrefixes returns the prefix, size and object count of every prefix, in the Walk order
+func flattenPrefixes(root *Prefix) []string {
+	var prefixes []string
+	root.Walk(func(prefix *Prefix) {
+		prefixes = append(prefixes, fmt.Sprintf("%v:%v/%v", prefix.Prefix, prefix.SizeBytes, prefix.ObjectCount))
+	})
+	return prefixes
+}
+
+func TestDrillBucket(t *testing.T) {
+	var tests = []struct {
+		options  DrillOptions
+		expected []string
+	}{
+		{
+			options:  DrillOptions{Depth: 1, Workers: 2},
+			expected: []string{":1515/6", "data/:1010/2", "logs/:500/3"},
+		},
+		{
+			options:  DrillOptions{Depth: 2, Workers: 1},
+			expected: []string{":1515/6", "data/:1010/2", "data/deep/:10/1", "logs/:500/3", "logs/2021/:300/1", "logs/2020/:200/2"},
+		},
+		{
+			options:  DrillOptions{Depth: 1, Prefix: "logs/", Workers: 4},
+			expected: []string{"logs/:500/3", "logs/2021/:300/1", "logs/2020/:200/2"},
+		},
+	}
+
+	for _, test := range tests {
+		root, err := DrillBucket(context.Background(), newMockPrefixesClient(), "bucket1", test.options)
+		if err != nil {
+			t.Errorf("DrillBucket(): FAILED, Expected no error - Received: %v", err)
+			continue
+		}
+		prefixes := flattenPrefixes(root)
+		if strings.Join(prefixes, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("DrillBucket(): FAILED, Expected prefixes %v - Received: %v", test.expected, prefixes)
+		}
+	}
+}
+
+func TestDrillBucketMetrics(t *testing.T) {
+	root, err := DrillBucket(context.Background(), newMockPrefixesClient(), "bucket1", DrillOptions{Depth: 1, Workers: 2})
+	if err != nil {
+		t.Fatalf("DrillBucket(): FAILED, Expected no error - Received: %v", err)
+	}
+
+	data := root.Children[0]
+	if !data.LastModified.Equal(time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DrillBucket(): FAILED, Expected data/ last modified on 2020-03-02 - Received: %v", data.LastModified)
+	}
+	if data.StorageClassesStats["GLACIER"] != 50 || data.StorageClassesBytes["GLACIER"] != 1000 || data.StorageClassesBytes["STANDARD"] != 10 {
+		t.Errorf("DrillBucket(): FAILED, Expected data/ to hold half of its objects and 1000 bytes in GLACIER - Received: %v, %v", data.StorageClassesStats, data.StorageClassesBytes)
+	}
+	if !root.LastModified.Equal(time.Date(2020, time.March, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DrillBucket(): FAILED, Expected the bucket last modified on 2020-03-06 - Received: %v", root.LastModified)
+	}
+}
+
+func TestDrillBucketError(t *testing.T) {
+	client := newMockPrefixesClient()
+	client.failPrefix = "logs/2020/"
+
+	_, err := DrillBucket(context.Background(), client, "bucket1", DrillOptions{Depth: 2, Workers: 2})
+	if err == nil {
+		t.Errorf("DrillBucket(): FAILED, Expected an error when a prefix cannot be listed - Received: %v", err)
+	}
+}
+
+func TestDrillBucketWorkers(t *testing.T) {
+	client := &mockPrefixesClient{delay: time.Millisecond}
+	for i := 0; i < 500; i++ {
+		client.objects = append(client.objects, &s3.Object{Key: aws.String(fmt.Sprintf("prefix%v/object", i)), Size: aws.Int64(1)})
+	}
+
+	// The 500 prefixes are listed by the 4 workers, rather than by a goroutine each
+	goroutines := int32(runtime.NumGoroutine())
+	root, err := DrillBucket(context.Background(), client, "bucket1", DrillOptions{Depth: 1, Workers: 4})
+	if err != nil {
+		t.Fatalf("DrillBucket(): FAILED, Expected no error - Received: %v", err)
+	}
+	if root.ObjectCount != 500 || len(root.Children) != 500 {
+		t.Errorf("DrillBucket(): FAILED, Expected 500 objects under 500 prefixes - Received: %v objects under %v prefixes", root.ObjectCount, len(root.Children))
+	}
+	if client.maxGoroutines > goroutines+4 {
+		t.Errorf("DrillBucket(): FAILED, Expected at most %v goroutines - Received: %v", goroutines+4, client.maxGoroutines)
+	}
+}
@@ -0,0 +1,293 @@
+package s3
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	// splitKeyFirst and splitKeyLast bound the characters of the keys the key ranges are split at: the printable ASCII characters, the
+	// keys holding other characters being compared as if they held the closest one
+	splitKeyFirst = ' '
+	splitKeyLast  = '~'
+
+	// minSplitPages is the number of pages a range must be estimated to have left to be split
+	minSplitPages = 2
+)
+
+// rangeListing is the listing of the keys of a bucket greater than after and lower than or equal to end, end being empty for the last
+// range of the bucket. first and after are the first and last keys listed so far and truncated is set once a page of the range was listed
+// with more to come. The range is split at 1/2^splitShift of its remaining keys, see splitKey, parent being the range it was split from
+type rangeListing struct {
+	after      string
+	end        string
+	first      string
+	metrics    *objectsMetrics
+	pages      int
+	parent     *rangeListing
+	splitShift uint
+	truncated  bool
+}
+
+// parallelListing lists the objects of a bucket with a pool of workers, every worker listing a range of keys. A worker without range
+// takes the upper part of the remaining keys of the range estimated to have the most pages left, which gets the workers to share the
+// densest parts of the bucket whatever its keys look like
+// A range is split halfway between its last key and its end. The upper part turning out to be empty, which costs a request, the next
+// split of the range is closer to its last key, the distance being squared every time, so that the keys of a sparse keyspace (e.g.
+// every key starting with 'logs/2020-') are found in a few requests rather than by halving the distance a character at a time
+type parallelListing struct {
+	bucket string
+	client s3iface.S3API
+
+	cond    *sync.Cond
+	err     error
+	listing []*rangeListing
+	mutex   sync.Mutex
+	queue   []*rangeListing
+	ranges  []*rangeListing
+}
+
+// SetBucketObjectsMetricsParallel sets the same metrics as SetBucketObjectsMetrics, listing ranges of keys of the bucket in parallel with
+// the provided number of workers and merging their metrics. The bucket is split into ranges as it is listed, the workers splitting the
+// range with the most pages left, so that even a bucket without prefixes or with a single one is listed in parallel
+// It is much faster on a huge bucket, at the cost of a few dozen more requests
+func (b *Bucket) SetBucketObjectsMetricsParallel(ctx context.Context, client s3iface.S3API, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Stop listing the other ranges as soon as one of them fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	root := &rangeListing{metrics: newObjectsMetrics(), splitShift: 1}
+	l := &parallelListing{bucket: b.Name, client: client, queue: []*rangeListing{root}, ranges: []*rangeListing{root}}
+	l.cond = sync.NewCond(&l.mutex)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// Wait for a range to list, the workers stopping once every range is listed or one of them failed
+				l.mutex.Lock()
+				r := l.next()
+				for r == nil && len(l.listing) > 0 && l.err == nil {
+					l.cond.Wait()
+					r = l.next()
+				}
+				if r == nil {
+					l.mutex.Unlock()
+					return
+				}
+				l.listing = append(l.listing, r)
+				l.mutex.Unlock()
+
+				err := l.list(ctx, r)
+
+				l.mutex.Lock()
+				for i, listing := range l.listing {
+					if listing == r {
+						l.listing = append(l.listing[:i], l.listing[i+1:]...)
+						break
+					}
+				}
+				if err != nil && l.err == nil {
+					l.err = err
+					cancel()
+				}
+				l.cond.Broadcast()
+				l.mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l.err != nil {
+		return l.err
+	}
+
+	metrics := newObjectsMetrics()
+	for _, r := range l.ranges {
+		metrics.merge(r.metrics)
+	}
+	metrics.setObjects(b)
+
+	return nil
+}
+
+// next returns the next range to list: a queued one, or the upper part of the range being listed with the most pages left that can be split
+// It returns nil if there is none for now or if a range failed. The listing's mutex must be held
+func (l *parallelListing) next() *rangeListing {
+	if l.err != nil {
+		return nil
+	}
+	if len(l.queue) > 0 {
+		r := l.queue[0]
+		l.queue = l.queue[1:]
+		return r
+	}
+
+	// Try the ranges from the one with the most pages left, only splitting a range whose halves would each hold a page at least
+	tried := map[*rangeListing]bool{}
+	for {
+		var largest *rangeListing
+		largestPages := 0.0
+		for _, r := range l.listing {
+			if pages := r.remainingPages(); r.truncated && !tried[r] && pages >= minSplitPages && (largest == nil || pages > largestPages) {
+				largest, largestPages = r, pages
+			}
+		}
+		if largest == nil {
+			return nil
+		}
+		tried[largest] = true
+
+		// The new range shares the end of the split one, which may be as far from its keys, but is split halfway sooner
+		if key, ok := splitKey(largest.after, largest.end, largest.splitShift); ok {
+			r := &rangeListing{after: key, end: largest.end, metrics: newObjectsMetrics(), parent: largest, splitShift: (largest.splitShift + 1) / 2}
+			largest.end = key
+			l.ranges = append(l.ranges, r)
+			return r
+		}
+	}
+}
+
+// list lists the keys of the range page by page, until its end which may be lowered by the other workers splitting it meanwhile
+// Every page is listed from the last key of the previous one rather than with a continuation token, so that the range can be split
+func (l *parallelListing) list(ctx context.Context, r *rangeListing) error {
+	for {
+		l.mutex.Lock()
+		params := &s3.ListObjectsV2Input{Bucket: aws.String(l.bucket)}
+		if r.after != "" {
+			params.StartAfter = aws.String(r.after)
+		}
+		l.mutex.Unlock()
+
+		page, err := l.client.ListObjectsV2WithContext(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		l.mutex.Lock()
+		done := !aws.BoolValue(page.IsTruncated) || len(page.Contents) == 0
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			if r.end != "" && key > r.end {
+				done = true
+				break
+			}
+			r.metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+			if r.first == "" {
+				r.first = key
+			}
+			r.after = key
+		}
+		// Split the parent closer to its last key next time if this range split from it is empty, halfway again otherwise since its end
+		// is now known to be followed by keys
+		if r.pages == 0 && r.parent != nil {
+			if r.metrics.objectCount == 0 {
+				r.parent.splitShift = 2 * r.parent.splitShift
+			} else {
+				r.parent.splitShift = 1
+			}
+		}
+		r.pages++
+		r.truncated = !done
+		l.cond.Broadcast()
+		l.mutex.Unlock()
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// remainingPages estimates the number of pages left to list in the range from the distance between its keys covered by the pages listed
+// so far, the keys being seen as numbers as by splitKey. It is infinite if the range did not list two keys yet
+func (r *rangeListing) remainingPages() float64 {
+	if r.first == "" || r.first == r.after {
+		return math.Inf(1)
+	}
+	upper := r.end
+	if upper == "" {
+		upper = string(splitKeyLast)
+	}
+	digits := maxLength(r.first, r.after, upper) + 1
+
+	covered := new(big.Float).SetInt(new(big.Int).Sub(keyNumber(r.after, digits), keyNumber(r.first, digits)))
+	remaining := new(big.Float).SetInt(new(big.Int).Sub(keyNumber(upper, digits), keyNumber(r.after, digits)))
+	pages, _ := remaining.Quo(remaining, covered).Float64()
+	return pages * float64(r.pages)
+}
+
+// splitKey returns a key between after and end, end being empty for no upper bound, at 1/2^shift of the distance between them, or false
+// if there is none
+func splitKey(after, end string, shift uint) (string, bool) {
+	upper := end
+	if upper == "" {
+		upper = string(splitKeyLast)
+	}
+	// Give the numbers enough digits for the shift to be seen, a digit holding a bit more than 6 bits
+	digits := maxLength(after, upper) + int(shift)/6 + 1
+
+	// after + (upper - after) / 2^shift
+	low := keyNumber(after, digits)
+	split := new(big.Int).Sub(keyNumber(upper, digits), low)
+	split.Rsh(split, shift).Add(split, low)
+
+	key := numberKey(split, digits)
+	if key <= after || (end != "" && key >= end) {
+		return "", false
+	}
+	return key, true
+}
+
+// keyNumber returns the key as a number of the provided number of digits, the digits being its characters from splitKeyFirst to
+// splitKeyLast, so that the distance between two keys can be computed
+func keyNumber(key string, digits int) *big.Int {
+	base := big.NewInt(splitKeyLast - splitKeyFirst + 1)
+	n := new(big.Int)
+	for i := 0; i < digits; i++ {
+		digit := 0
+		if i < len(key) && key[i] > splitKeyLast {
+			digit = splitKeyLast - splitKeyFirst
+		} else if i < len(key) && key[i] >= splitKeyFirst {
+			digit = int(key[i] - splitKeyFirst)
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(digit)))
+	}
+	return n
+}
+
+// numberKey returns the key of a number of the provided number of digits, as returned by keyNumber, without its trailing splitKeyFirst
+func numberKey(n *big.Int, digits int) string {
+	base := big.NewInt(splitKeyLast - splitKeyFirst + 1)
+	n = new(big.Int).Set(n)
+	key := make([]byte, digits)
+	digit := new(big.Int)
+	for i := digits - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		key[i] = byte(digit.Int64()) + splitKeyFirst
+	}
+	return strings.TrimRight(string(key), string(splitKeyFirst))
+}
+
+// maxLength returns the length of the longest of the keys
+func maxLength(keys ...string) int {
+	length := 0
+	for _, key := range keys {
+		if len(key) > length {
+			length = len(key)
+		}
+	}
+	return length
+}
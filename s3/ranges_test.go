@@ -0,0 +1,140 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestSetBucketObjectsMetricsParallel(t *testing.T) {
+	// Flat, hashed and nested keys, along with a bucket whose keys are all under a single prefix
+	keyspaces := map[string]func(i int, random *rand.Rand) string{
+		"flat":   func(i int, random *rand.Rand) string { return fmt.Sprintf("object%06d.json", i) },
+		"hashed": func(i int, random *rand.Rand) string { return fmt.Sprintf("%08x", random.Uint32()) },
+		"nested": func(i int, random *rand.Rand) string {
+			return fmt.Sprintf("prefix%v/sub%v/object%v", random.Intn(13), random.Intn(5), i)
+		},
+		"single prefix": func(i int, random *rand.Rand) string {
+			return fmt.Sprintf("logs/2020-01-01T%02d:%02d:%02d", i/3600, i/60%60, i%60)
+		},
+	}
+	classes := []string{"STANDARD", "STANDARD_IA", "GLACIER", "DEEP_ARCHIVE"}
+
+	for name, key := range keyspaces {
+		random := rand.New(rand.NewSource(1))
+		client := &mockKeysClient{delay: time.Millisecond, pageSize: 100}
+		seen := map[string]bool{}
+		for i := 0; i < 5000; i++ {
+			k := key(i, random)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			client.objects = append(client.objects, &s3.Object{
+				Key:          aws.String(k),
+				LastModified: aws.Time(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(random.Intn(10000)) * time.Hour)),
+				Size:         aws.Int64(random.Int63n(1000000)),
+				StorageClass: aws.String(classes[random.Intn(len(classes))]),
+			})
+		}
+		sort.Slice(client.objects, func(i, j int) bool {
+			return aws.StringValue(client.objects[i].Key) < aws.StringValue(client.objects[j].Key)
+		})
+
+		metrics := newObjectsMetrics()
+		for _, obj := range client.objects {
+			metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+		}
+		expected := &Bucket{Name: "bucket1"}
+		metrics.setObjects(expected)
+
+		for _, workers := range []int{1, 8} {
+			client.maxListings, client.requests = 0, 0
+			bucket := &Bucket{Name: "bucket1"}
+			err := bucket.SetBucketObjectsMetricsParallel(context.Background(), client, workers)
+			if err != nil {
+				t.Fatalf("SetBucketObjectsMetricsParallel(): FAILED, expected no errors but received '%v'", err)
+			}
+			if !reflect.DeepEqual(bucket, expected) {
+				t.Errorf("SetBucketObjectsMetricsParallel(): FAILED, expected the same metrics as a sequential listing of the %v keys with %v workers '%+v' but received '%+v'", name, workers, expected, bucket)
+			}
+			// The 50 pages are shared by the workers, a few dozen requests being spent on the ranges turning out to be empty and on the
+			// last pages of the split ranges
+			if workers > 1 && (client.maxListings < 4 || client.requests > 150) {
+				t.Errorf("SetBucketObjectsMetricsParallel(): FAILED, expected the %v keys to be listed in parallel but received '%v' listings at most and '%v' requests", name, client.maxListings, client.requests)
+			}
+		}
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	var tests = []struct {
+		after    string
+		end      string
+		shift    uint
+		expected string
+		ok       bool
+	}{
+		{
+			after:    "a",
+			end:      "c",
+			shift:    1,
+			expected: "b",
+			ok:       true,
+		},
+		{
+			after:    "logs/2020",
+			end:      "logs/2021",
+			shift:    1,
+			expected: "logs/2020O",
+			ok:       true,
+		},
+		{
+			after:    "0",
+			end:      "",
+			shift:    1,
+			expected: "W",
+			ok:       true,
+		},
+		{
+			after:    "a",
+			end:      "q",
+			shift:    4,
+			expected: "b",
+			ok:       true,
+		},
+		{
+			after:    "logs/2020",
+			end:      "",
+			shift:    64,
+			expected: "logs/2020 WbCv9\"7T)k",
+			ok:       true,
+		},
+		{
+			after: "a",
+			end:   "a ",
+			shift: 1,
+			ok:    false,
+		},
+		{
+			after: "~~",
+			end:   "",
+			shift: 1,
+			ok:    false,
+		},
+	}
+
+	for _, test := range tests {
+		result, ok := splitKey(test.after, test.end, test.shift)
+		if result != test.expected || ok != test.ok {
+			t.Errorf("splitKey(): FAILED, expected '%v' (%v) between '%v' and '%v' but received '%v' (%v)", test.expected, test.ok, test.after, test.end, result, ok)
+		}
+	}
+}
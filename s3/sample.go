@@ -0,0 +1,417 @@
+package s3
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// MinSampleRequests is the minimum number of listing requests of SetBucketObjectsMetricsSample
+const MinSampleRequests = 10
+
+// sampleConfidenceZ is the z-score of the 95% confidence intervals of the estimates
+const sampleConfidenceZ = 1.96
+
+// sampleMaxSuffix is appended to a key range to skip every key in it when listing with StartAfter, U+10FFFF being the biggest character
+// a key can hold. The keys holding it right after the range's prefix, a noncharacter, are assumed not to exist
+const sampleMaxSuffix = "\U0010FFFF"
+
+// ObjectsEstimate describes how the objects metrics of a bucket were extrapolated from a sample of its objects by SetBucketObjectsMetricsSample
+// The *Low and *High fields bound the 95% confidence intervals of the ObjectCount and SizeBytes
+// LowerBound is set when the requests ran out before the bucket could be sampled twice, the metrics then only counting the objects seen so
+// far and the *High fields being 0
+type ObjectsEstimate struct {
+	LowerBound      bool
+	ObjectCountHigh int
+	ObjectCountLow  int
+	Probes          int
+	Requests        int
+	SampledObjects  int
+	SizeBytesHigh   int64
+	SizeBytesLow    int64
+}
+
+// sampleMetrics is the metrics of the current versions of a set of objects, estimated or counted
+type sampleMetrics struct {
+	objectCount         float64
+	sizeBytes           float64
+	storageClasses      map[string]float64
+	storageClassesBytes map[string]float64
+}
+
+// newSampleMetrics returns empty metrics
+func newSampleMetrics() *sampleMetrics {
+	return &sampleMetrics{
+		storageClasses:      map[string]float64{},
+		storageClassesBytes: map[string]float64{},
+	}
+}
+
+// addObject counts a listed object
+func (m *sampleMetrics) addObject(obj *s3.Object) {
+	size := float64(aws.Int64Value(obj.Size))
+	class := aws.StringValue(obj.StorageClass)
+
+	m.objectCount++
+	m.sizeBytes += size
+	m.storageClasses[class]++
+	m.storageClassesBytes[class] += size
+}
+
+// add adds other to m, weight times
+func (m *sampleMetrics) add(other *sampleMetrics, weight float64) {
+	m.objectCount += weight * other.objectCount
+	m.sizeBytes += weight * other.sizeBytes
+	for class, count := range other.storageClasses {
+		m.storageClasses[class] += weight * count
+	}
+	for class, bytes := range other.storageClassesBytes {
+		m.storageClassesBytes[class] += weight * bytes
+	}
+}
+
+// keyRange is the range of the keys starting with prefix. Once expanded, exact holds the metrics of the key equal to the extended prefix
+// and of the ranges below it small enough to be fully listed, while children holds the bigger ones, which are sampled
+// firstPage, when set, is the first page of the range, listed while expanding its parent
+type keyRange struct {
+	children  []*keyRange
+	exact     *sampleMetrics
+	expanded  bool
+	firstPage *s3.ListObjectsV2Output
+	prefix    string
+	total     *sampleMetrics
+}
+
+// totalMetrics returns the metrics of every object of the range, or nil if some of the ranges below it were not expanded yet
+func (r *keyRange) totalMetrics() *sampleMetrics {
+	if r.total != nil || !r.expanded {
+		return r.total
+	}
+	total := newSampleMetrics()
+	total.add(r.exact, 1)
+	for _, child := range r.children {
+		childTotal := child.totalMetrics()
+		if childTotal == nil {
+			return nil
+		}
+		total.add(childTotal, 1)
+	}
+	r.total = total
+	return total
+}
+
+// listedMetrics returns the metrics of the objects of the range counted so far
+func (r *keyRange) listedMetrics() *sampleMetrics {
+	listed := newSampleMetrics()
+	if !r.expanded {
+		return listed
+	}
+	listed.add(r.exact, 1)
+	for _, child := range r.children {
+		listed.add(child.listedMetrics(), 1)
+	}
+	return listed
+}
+
+// sampler estimates the objects metrics of a bucket from at most maxRequests listing requests
+type sampler struct {
+	bucket       string
+	client       s3iface.S3API
+	lastModified time.Time
+	maxRequests  int
+	objects      int
+	random       *rand.Rand
+	requests     int
+}
+
+// SetBucketObjectsMetricsSample sets the same metrics as SetBucketObjectsMetrics, extrapolated from at most maxRequests listing requests,
+// along with the bucket's Estimate. The Estimate is left to nil if every object could be listed within maxRequests
+//
+// The keys are split into ranges by the character following their common prefix, the ranges fully listed along the way being counted as
+// is while the bigger ones are split the same way when sampled. Every probe goes down the ranges from the bucket's root, picking one of the
+// ranges not fully known yet at random at every level and multiplying its estimate by the number of ranges it was picked from, which makes
+// every probe an unbiased estimate of the whole bucket. The ranges split by a probe are kept for the next ones, which get cheaper, and the
+// probes go on until the requests run out. The metrics are the average of the probes and the confidence intervals come from their variance
+// The LastModified date is the latest one of the listed objects
+func (b *Bucket) SetBucketObjectsMetricsSample(ctx context.Context, client s3iface.S3API, maxRequests int, random *rand.Rand) error {
+	s := &sampler{bucket: b.Name, client: client, maxRequests: maxRequests, random: random}
+	root := &keyRange{}
+	var probes []*sampleMetrics
+	for root.totalMetrics() == nil {
+		probe, err := s.probe(ctx, root)
+		if err != nil {
+			return err
+		}
+		if probe == nil {
+			break
+		}
+		probes = append(probes, probe)
+	}
+
+	b.LastModified = s.lastModified
+	if total := root.totalMetrics(); total != nil {
+		b.setSampleMetrics(total)
+		b.Estimate = nil
+		return nil
+	}
+
+	listed := root.listedMetrics()
+	b.Estimate = &ObjectsEstimate{
+		LowerBound:     true,
+		ObjectCountLow: int(listed.objectCount),
+		Probes:         len(probes),
+		Requests:       s.requests,
+		SampledObjects: s.objects,
+		SizeBytesLow:   int64(listed.sizeBytes),
+	}
+	if len(probes) < 2 {
+		b.setSampleMetrics(listed)
+		return nil
+	}
+
+	// Average the probes, the margins of the confidence intervals being the standard errors of the averages times the Student's quantile
+	n := float64(len(probes))
+	mean := newSampleMetrics()
+	for _, probe := range probes {
+		mean.add(probe, 1/n)
+	}
+	var countSquares, sizeSquares float64
+	for _, probe := range probes {
+		countSquares += (probe.objectCount - mean.objectCount) * (probe.objectCount - mean.objectCount)
+		sizeSquares += (probe.sizeBytes - mean.sizeBytes) * (probe.sizeBytes - mean.sizeBytes)
+	}
+	quantile := studentQuantile(len(probes) - 1)
+	countMargin := quantile * math.Sqrt(countSquares/(n-1)/n)
+	sizeMargin := quantile * math.Sqrt(sizeSquares/(n-1)/n)
+
+	b.setSampleMetrics(mean)
+	b.Estimate.LowerBound = false
+	b.Estimate.ObjectCountLow = int(math.Floor(math.Max(mean.objectCount-countMargin, listed.objectCount)))
+	b.Estimate.ObjectCountHigh = int(math.Ceil(mean.objectCount + countMargin))
+	b.Estimate.SizeBytesLow = int64(math.Floor(math.Max(mean.sizeBytes-sizeMargin, listed.sizeBytes)))
+	b.Estimate.SizeBytesHigh = int64(math.Ceil(mean.sizeBytes + sizeMargin))
+
+	return nil
+}
+
+// setSampleMetrics sets the objects metrics of the bucket from the estimated or counted metrics
+func (b *Bucket) setSampleMetrics(metrics *sampleMetrics) {
+	b.ObjectCount = int(math.Round(metrics.objectCount))
+	b.SizeBytes = int64(math.Round(metrics.sizeBytes))
+	b.StorageClassesStats = map[string]float64{}
+	storageClassesBytes := map[string]int64{}
+	for class, count := range metrics.storageClasses {
+		b.StorageClassesStats[class] = count / metrics.objectCount * 100
+		storageClassesBytes[class] = int64(math.Round(metrics.storageClassesBytes[class]))
+	}
+	b.setStorageClassesBytes(storageClassesBytes)
+}
+
+// probe returns an estimate of the metrics of the range's objects, going down one of the ranges below it not fully known yet, picked at
+// random, and expanding the ranges it goes through. It returns nil if the requests ran out before the probe could be completed
+func (s *sampler) probe(ctx context.Context, r *keyRange) (*sampleMetrics, error) {
+	if !r.expanded {
+		expanded, err := s.expand(ctx, r)
+		if err != nil || !expanded {
+			return nil, err
+		}
+	}
+
+	estimate := newSampleMetrics()
+	estimate.add(r.exact, 1)
+	var unknown []*keyRange
+	for _, child := range r.children {
+		if total := child.totalMetrics(); total != nil {
+			estimate.add(total, 1)
+		} else {
+			unknown = append(unknown, child)
+		}
+	}
+	if len(unknown) == 0 {
+		return estimate, nil
+	}
+
+	probe, err := s.probe(ctx, unknown[s.random.Intn(len(unknown))])
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	estimate.add(probe, float64(len(unknown)))
+	return estimate, nil
+}
+
+// expand lists the range page by page to split it into the ranges sharing the character following its common prefix, counting the ones
+// fully listed and keeping the others as its children. It returns false if the requests ran out before the range could be expanded
+func (s *sampler) expand(ctx context.Context, r *keyRange) (bool, error) {
+	page := r.firstPage
+	var err error
+	if page == nil {
+		if s.requests >= s.maxRequests {
+			return false, nil
+		}
+		page, err = s.list(ctx, r.prefix, "", 0)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// An empty page ends the range even if truncated, the way some S3 compatible services end their listings
+	exact := newSampleMetrics()
+	if !aws.BoolValue(page.IsTruncated) || len(page.Contents) == 0 {
+		for _, obj := range page.Contents {
+			exact.addObject(obj)
+		}
+		r.exact, r.expanded, r.firstPage = exact, true, nil
+		return true, nil
+	}
+
+	prefix, err := s.commonPrefix(ctx, r.prefix, page.Contents)
+	if err != nil {
+		return false, err
+	}
+
+	// A range filling a whole page is too big to be listed: it is skipped, the next page being listed from its end, and becomes a child,
+	// its first page being kept if it is the one it filled. carried holds the objects of the range the previous page ended with
+	var children []*keyRange
+	var carried []*s3.Object
+	var current string
+	for {
+		last, objects := current, carried
+		inPage := 0
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			if key == prefix {
+				exact.addObject(obj)
+				continue
+			}
+			if keyRange := childKeyRange(prefix, key); keyRange != last {
+				for _, obj := range objects {
+					exact.addObject(obj)
+				}
+				last, objects, inPage = keyRange, nil, 0
+			}
+			objects = append(objects, obj)
+			inPage++
+		}
+		if !aws.BoolValue(page.IsTruncated) || len(page.Contents) == 0 {
+			for _, obj := range objects {
+				exact.addObject(obj)
+			}
+			break
+		}
+
+		startAfter := aws.StringValue(page.Contents[len(page.Contents)-1].Key)
+		current, carried = last, objects
+		if last != "" && inPage == len(page.Contents) {
+			child := &keyRange{prefix: last}
+			if len(objects) == inPage {
+				child.firstPage = page
+			}
+			children = append(children, child)
+			startAfter = last + sampleMaxSuffix
+			current, carried = "", nil
+		}
+		if s.requests >= s.maxRequests {
+			return false, nil
+		}
+		page, err = s.list(ctx, prefix, startAfter, 0)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	r.children, r.exact, r.expanded, r.firstPage = children, exact, true, nil
+	return true, nil
+}
+
+// commonPrefix returns the longest prefix shared by every key starting with prefix, objects being the first ones, prefix being returned as
+// is without any
+// Checking that the keys after the objects share their common prefix takes a request, prefix being returned as is once the requests run out
+func (s *sampler) commonPrefix(ctx context.Context, prefix string, objects []*s3.Object) (string, error) {
+	if len(objects) == 0 {
+		return prefix, nil
+	}
+	common := aws.StringValue(objects[0].Key)
+	for _, obj := range objects[1:] {
+		common = longestCommonPrefix(common, aws.StringValue(obj.Key))
+	}
+
+	for len(common) > len(prefix) && s.requests < s.maxRequests {
+		next, err := s.list(ctx, prefix, common+sampleMaxSuffix, 1)
+		if err != nil {
+			return "", err
+		}
+		if len(next.Contents) == 0 {
+			return common, nil
+		}
+		common = longestCommonPrefix(common, aws.StringValue(next.Contents[0].Key))
+	}
+	return prefix, nil
+}
+
+// list lists a page of the objects whose key starts with prefix, after startAfter if set, up to maxKeys objects if set
+func (s *sampler) list(ctx context.Context, prefix string, startAfter string, maxKeys int64) (*s3.ListObjectsV2Output, error) {
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	}
+	if prefix != "" {
+		params.Prefix = aws.String(prefix)
+	}
+	if startAfter != "" {
+		params.StartAfter = aws.String(startAfter)
+	}
+	if maxKeys > 0 {
+		params.MaxKeys = aws.Int64(maxKeys)
+	}
+
+	s.requests++
+	page, err := s.client.ListObjectsV2WithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys == 0 {
+		s.objects += len(page.Contents)
+	}
+	for _, obj := range page.Contents {
+		if lastModified := aws.TimeValue(obj.LastModified); lastModified.After(s.lastModified) {
+			s.lastModified = lastModified
+		}
+	}
+	return page, nil
+}
+
+// studentQuantiles contains the 97.5% quantiles of the Student's t-distribution by degrees of freedom, up to 30
+var studentQuantiles = []float64{0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228, 2.201, 2.179, 2.160, 2.145, 2.131,
+	2.120, 2.110, 2.101, 2.093, 2.086, 2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+
+// studentQuantile returns the 97.5% quantile of the Student's t-distribution with the degrees of freedom, the normal distribution's
+// beyond 30 of them
+func studentQuantile(degrees int) float64 {
+	if degrees < len(studentQuantiles) {
+		return studentQuantiles[degrees]
+	}
+	return sampleConfidenceZ
+}
+
+// childKeyRange returns the prefix of the key range key belongs to below prefix, i.e. prefix followed by the next character of the key
+func childKeyRange(prefix, key string) string {
+	_, size := utf8.DecodeRuneInString(key[len(prefix):])
+	return key[:len(prefix)+size]
+}
+
+// longestCommonPrefix returns the longest prefix of a and b, without splitting a multi-byte character
+func longestCommonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+	return a[:i]
+}
@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// mockKeysClient lists its objects sorted by key the way S3 does, pageSize objects at most per page, and counts the requests
+// Every listing takes delay, maxListings being the most listings seen at the same time
+// truncatedEmpty reports the empty pages as truncated, the way some S3 compatible services end their listings
+type mockKeysClient struct {
+	s3iface.S3API
+	objects        []*s3.Object
+	pageSize       int
+	truncatedEmpty bool
+
+	delay       time.Duration
+	listings    int
+	maxListings int
+	mutex       sync.Mutex
+	requests    int
+}
+
+func (m *mockKeysClient) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	m.mutex.Lock()
+	m.requests++
+	m.listings++
+	if m.listings > m.maxListings {
+		m.maxListings = m.listings
+	}
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		m.listings--
+		m.mutex.Unlock()
+	}()
+	time.Sleep(m.delay)
+
+	maxKeys := m.pageSize
+	if input.MaxKeys != nil && int(*input.MaxKeys) < maxKeys {
+		maxKeys = int(*input.MaxKeys)
+	}
+
+	// Start from the first key after StartAfter and the prefix, the objects being sorted
+	prefix := aws.StringValue(input.Prefix)
+	start := sort.Search(len(m.objects), func(i int) bool {
+		key := aws.StringValue(m.objects[i].Key)
+		return key > aws.StringValue(input.StartAfter) && key >= prefix
+	})
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	for _, obj := range m.objects[start:] {
+		if !strings.HasPrefix(aws.StringValue(obj.Key), prefix) {
+			break
+		}
+		if len(output.Contents) == maxKeys {
+			output.IsTruncated = aws.Bool(true)
+			break
+		}
+		output.Contents = append(output.Contents, obj)
+	}
+	if m.truncatedEmpty && len(output.Contents) == 0 {
+		output.IsTruncated = aws.Bool(true)
+	}
+	return output, nil
+}
+
+// newMockKeysClient returns a client listing count objects of random sizes, storage classes and dates, their keys being random
+// hexadecimal names under a few prefixes
+func newMockKeysClient(count, pageSize int) *mockKeysClient {
+	random := rand.New(rand.NewSource(1))
+	prefixes := []string{"backups/", "images/", "logs/2020/", "logs/2021/"}
+	classes := []string{"STANDARD", "STANDARD_IA", "GLACIER"}
+
+	client := &mockKeysClient{pageSize: pageSize}
+	for i := 0; i < count; i++ {
+		client.objects = append(client.objects, &s3.Object{
+			Key:          aws.String(fmt.Sprintf("%v%08x", prefixes[random.Intn(len(prefixes))], random.Uint32())),
+			LastModified: aws.Time(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(random.Intn(10000)) * time.Hour)),
+			Size:         aws.Int64(random.Int63n(1000000)),
+			StorageClass: aws.String(classes[random.Intn(len(classes))]),
+		})
+	}
+	sort.Slice(client.objects, func(i, j int) bool {
+		return aws.StringValue(client.objects[i].Key) < aws.StringValue(client.objects[j].Key)
+	})
+	return client
+}
+
+func TestSetBucketObjectsMetricsSampleExact(t *testing.T) {
+	client := newMockKeysClient(500, 100)
+	metrics := newObjectsMetrics()
+	for _, obj := range client.objects {
+		metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+	}
+	expected := &Bucket{Name: "bucket1"}
+	metrics.setObjects(expected)
+
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetricsSample(context.Background(), client, 1000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected no errors but received '%v'", err)
+	}
+	if !reflect.DeepEqual(bucket, expected) {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected the exact metrics '%+v' with enough requests but received '%+v'", expected, bucket)
+	}
+}
+
+func TestSetBucketObjectsMetricsSampleTruncatedEmpty(t *testing.T) {
+	var tests = []struct {
+		count int
+	}{
+		{count: 0},
+		{count: 500},
+	}
+
+	for _, test := range tests {
+		client := newMockKeysClient(test.count, 100)
+		client.truncatedEmpty = true
+		metrics := newObjectsMetrics()
+		for _, obj := range client.objects {
+			metrics.addVersion(aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass), true)
+		}
+		expected := &Bucket{Name: "bucket1"}
+		metrics.setObjects(expected)
+
+		bucket := &Bucket{Name: "bucket1"}
+		err := bucket.SetBucketObjectsMetricsSample(context.Background(), client, 1000, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected no errors but received '%v'", err)
+		}
+		if !reflect.DeepEqual(bucket, expected) {
+			t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected the exact metrics '%+v' of %v objects with truncated empty pages but received '%+v'", expected, test.count, bucket)
+		}
+	}
+}
+
+func TestSetBucketObjectsMetricsSample(t *testing.T) {
+	client := newMockKeysClient(20000, 100)
+	var sizeBytes int64
+	for _, obj := range client.objects {
+		sizeBytes += aws.Int64Value(obj.Size)
+	}
+
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetricsSample(context.Background(), client, 150, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	estimate := bucket.Estimate
+	if estimate == nil || estimate.LowerBound {
+		t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected an estimate with confidence intervals but received '%+v'", estimate)
+	}
+	if client.requests > 150 || estimate.Requests != client.requests {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected at most 150 requests but received '%v', '%v' being reported", client.requests, estimate.Requests)
+	}
+	if estimate.Probes < 2 {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected at least 2 probes but received '%v'", estimate.Probes)
+	}
+	if estimate.SampledObjects >= len(client.objects) {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected only a sample of the objects to be listed but received '%v' objects", estimate.SampledObjects)
+	}
+	if len(client.objects) < estimate.ObjectCountLow || len(client.objects) > estimate.ObjectCountHigh {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected %v objects to be in the confidence interval but received '%+v'", len(client.objects), estimate)
+	}
+	if sizeBytes < estimate.SizeBytesLow || sizeBytes > estimate.SizeBytesHigh {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected %v bytes to be in the confidence interval but received '%+v'", sizeBytes, estimate)
+	}
+	if bucket.ObjectCount < estimate.ObjectCountLow || bucket.ObjectCount > estimate.ObjectCountHigh {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected the estimated count %v to be in its confidence interval '%+v'", bucket.ObjectCount, estimate)
+	}
+	if len(bucket.StorageClassesStats) != 3 {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected the 3 storage classes to be estimated but received '%v'", bucket.StorageClassesStats)
+	}
+}
+
+func TestSetBucketObjectsMetricsSampleLowerBound(t *testing.T) {
+	client := newMockKeysClient(20000, 100)
+
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetricsSample(context.Background(), client, 2, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.Estimate == nil || !bucket.Estimate.LowerBound {
+		t.Fatalf("SetBucketObjectsMetricsSample(): FAILED, expected a lower bound estimate with 2 requests but received '%+v'", bucket.Estimate)
+	}
+	if bucket.ObjectCount != bucket.Estimate.ObjectCountLow || bucket.ObjectCount > 200 {
+		t.Errorf("SetBucketObjectsMetricsSample(): FAILED, expected the objects of the listed page only but received '%v', '%+v'", bucket.ObjectCount, bucket.Estimate)
+	}
+}
+
+func TestLongestCommonPrefix(t *testing.T) {
+	var tests = []struct {
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			a:        "logs/2020/a",
+			b:        "logs/2021/b",
+			expected: "logs/202",
+		},
+		{
+			a:        "logs/",
+			b:        "logs/2020",
+			expected: "logs/",
+		},
+		{
+			a:        "data/é",
+			b:        "data/è",
+			expected: "data/",
+		},
+		{
+			a:        "data",
+			b:        "logs",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		if prefix := longestCommonPrefix(test.a, test.b); prefix != test.expected {
+			t.Errorf("longestCommonPrefix(): FAILED, expected '%v' for '%v' and '%v' but received '%v'", test.expected, test.a, test.b, prefix)
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// ScannerOptions contains the options used by a Scanner to fetch and filter the buckets
+type ScannerOptions struct {
+	// AccountFilter, when set, only keeps the buckets of an account ID matching it. No bucket is listed if the account does not match
+	AccountFilter *regexp.Regexp
+	// BucketTimeout, when set, is the maximum time spent fetching a single bucket's information
+	BucketTimeout time.Duration
+	// BucketWorkers, when bigger than 1, is the number of ranges of keys of a single bucket whose objects are listed at the same time
+	// The listings in progress are then not recorded in the Checkpoint, only the buckets fully processed
+	BucketWorkers int
+	// Checkpoint, when set, records the progress of the scan, the buckets it already holds not being scanned again and the objects listings
+	// it holds being resumed from their continuation token
+	Checkpoint *Checkpoint
+	// Configuration, when set, fetches the summary of the lifecycle and replication configurations of the buckets
+	Configuration bool
+	// CostPeriod is the period (in days) over which to calculate the cost of the buckets
+	CostPeriod int
+	// CostTag is the cost allocation tag holding the bucket's name
+	CostTag string
+	// DisableSSL, when set, uses HTTP instead of HTTPS to reach S3
+	DisableSSL bool
+	// Endpoint, when set, is the URL of an S3 compatible service (e.g. MinIO, Ceph, LocalStack) used instead of AWS S3
+	// Since such services do not have a cost explorer nor STS, the buckets' cost and account are not fetched
+	Endpoint string
+	// InventoryDir, when set, reads the inventory reports of the MetricsSourceInventory source from this local copy of their destination bucket
+	InventoryDir string
+	// MetricsSource is where the objects metrics come from: MetricsSourceList (the default), MetricsSourceCloudWatch, MetricsSourceAuto or MetricsSourceInventory
+	// When Versions is set, the previous versions of the objects are listed unless read from an inventory including them, CloudWatch not telling them apart
+	MetricsSource string
+	// MultipartUploads, when set, fetches the metrics related to the incomplete multipart uploads of the buckets
+	MultipartUploads bool
+	// NameFilter, when set, only keeps the buckets with a name matching it
+	NameFilter *regexp.Regexp
+	// PathStyle, when set, addresses the buckets in the URL's path (e.g. http://endpoint/bucket) instead of its host
+	PathStyle bool
+	// Profile is the name of the shared config profile the config provider was created from, if any. It is set on every bucket
+	Profile string
+	// PublicOnly, when set, only keeps the public buckets. It implies Security
+	PublicOnly bool
+	// Sample, when bigger than 0, estimates the objects metrics of the buckets listed from at most this number of listing requests per bucket
+	// instead of listing every object, the sampled listings not being recorded in the Checkpoint. It is ignored with Versions
+	Sample int
+	// SkipCost, when set, does not fetch the cost of the buckets unless the Where expression uses it
+	SkipCost bool
+	// SkipObjects, when set, does not list the objects of the buckets unless Versions, the StorageClassFilter or the Where expression needs them
+	SkipObjects bool
+	// Security, when set, fetches the security settings of the buckets (encryption, public access block, policy status, ACL)
+	Security bool
+	// StorageClassFilter, when set, only keeps the buckets having at least one storage class matching it
+	StorageClassFilter *regexp.Regexp
+	// UnencryptedOnly, when set, only keeps the buckets without default encryption. It implies Security
+	UnencryptedOnly bool
+	// UploadsOlderThan, when set, only keeps the buckets having an incomplete multipart upload initiated before that long ago
+	// It implies MultipartUploads
+	UploadsOlderThan time.Duration
+	// Where, when set, only keeps the buckets matching the expression. Its conditions are evaluated as soon as the fields they use are known,
+	// the information they need being fetched even if not requested (e.g. the security settings for 'public')
+	Where *Where
+	// Throttler, when set, limits the rate of the requests sent to every service and region and retries the failed requests, the SDK's
+	// default retries being used otherwise. It can be shared by several Scanners
+	Throttler *Throttler
+	// Versions, when set, takes into account every version of the objects and the delete markers in the objects metrics
+	Versions bool
+	// Workers is the number of buckets being worked on at the same time
+	Workers int
+}
+
+// s3Config returns the configuration of the S3 clients, overriding their endpoint if needed
+func (o ScannerOptions) s3Config() *aws.Config {
+	config := aws.NewConfig()
+	if o.Endpoint != "" {
+		config.WithEndpoint(o.Endpoint)
+	}
+	if o.PathStyle {
+		config.WithS3ForcePathStyle(true)
+	}
+	if o.DisableSSL {
+		config.WithDisableSSL(true)
+	}
+	return config
+}
+
+// ListsObjects returns whether the objects metrics of the buckets are fetched, either requested or needed by the filters
+func (o ScannerOptions) ListsObjects() bool {
+	return !o.SkipObjects || o.Versions || o.StorageClassFilter != nil || o.Where.needs(phaseObjects) || o.Where.needs(phaseVersions)
+}
+
+// BucketError is an error that happened while fetching a bucket's information
+type BucketError struct {
+	Bucket string
+	Op     string
+	Err    error
+}
+
+// Error returns the error message, including the bucket's name and the operation that failed
+func (e *BucketError) Error() string {
+	return fmt.Sprintf("unable to %v for bucket %v: %v", e.Op, e.Bucket, e.Err)
+}
+
+// regionalClients are the clients of a single region
+// We need to use a client with the same region as the bucket's region to be able to fetch the bucket's objects, S3 publishing the
+// storage metrics of a bucket in CloudWatch in the bucket's region as well
+type regionalClients struct {
+	cloudWatch cloudwatchiface.CloudWatchAPI
+	s3         s3iface.S3API
+}
+
+// regionClients is a cache of the clients of every region, safe for concurrent use
+type regionClients struct {
+	clients    map[string]*regionalClients
+	mutex      sync.Mutex
+	newClients func(region string) *regionalClients
+}
+
+// newRegionClients returns an empty cache creating the clients of a region with newClients
+func newRegionClients(newClients func(region string) *regionalClients) *regionClients {
+	return &regionClients{
+		clients:    make(map[string]*regionalClients),
+		newClients: newClients,
+	}
+}
+
+// get returns the clients of the provided region, creating them the first time the region is requested
+func (c *regionClients) get(region string) *regionalClients {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	clients, ok := c.clients[region]
+	if !ok {
+		clients = c.newClients(region)
+		c.clients[region] = clients
+	}
+	return clients
+}
+
+// scanResult is the outcome of a worker processing a single bucket
+type scanResult struct {
+	bucket *Bucket
+	errors []*BucketError
+	keep   bool
+}
+
+// Scanner lists the buckets of an account and fetches their information (region, objects metrics, cost)
+// A Scanner is safe for concurrent use and reuses its regional clients between scans
+type Scanner struct {
+	client        s3iface.S3API
+	costClient    costexploreriface.CostExplorerAPI
+	costsMutex    sync.Mutex
+	options       ScannerOptions
+	region        string
+	regionClients *regionClients
+	stsClient     stsiface.STSAPI
+
+	unattributedCosts []TagCost
+	untaggedCost      float64
+}
+
+// NewScanner returns a Scanner using the provided config provider (e.g. an AWS session) to create its clients
+// The config provider's region is used to list the buckets and to query the cost explorer
+// The options' endpoint settings only apply to the S3 clients
+// Every client is attached to the options' Throttler, if any
+func NewScanner(configProvider client.ConfigProvider, options ScannerOptions) *Scanner {
+	newS3Client := func(config *aws.Config) *s3.S3 {
+		svc := s3.New(configProvider, config)
+		options.Throttler.attach(svc.Client)
+		return svc
+	}
+	costClient := costexplorer.New(configProvider)
+	options.Throttler.attach(costClient.Client)
+	stsClient := sts.New(configProvider)
+	options.Throttler.attach(stsClient.Client)
+
+	return &Scanner{
+		client:     newS3Client(options.s3Config()),
+		costClient: costClient,
+		options:    options,
+		region:     aws.StringValue(configProvider.ClientConfig(s3.EndpointsID).Config.Region),
+		stsClient:  stsClient,
+		regionClients: newRegionClients(func(region string) *regionalClients {
+			cloudWatchClient := cloudwatch.New(configProvider, aws.NewConfig().WithRegion(region))
+			options.Throttler.attach(cloudWatchClient.Client)
+			return &regionalClients{
+				cloudWatch: cloudWatchClient,
+				s3:         newS3Client(options.s3Config().WithRegion(region)),
+			}
+		}),
+	}
+}
+
+// Scan lists all the buckets, fetches their information and returns the ones matching the filters
+// The errors that happened for a specific bucket are returned alongside the buckets, a bucket being skipped
+// unless only its cost or its inventory could not be fetched
+// When ctx is cancelled, the buckets already processed are returned as is while the others are marked as incomplete
+func (s *Scanner) Scan(ctx context.Context) ([]*Bucket, []*BucketError, error) {
+	// Get the account the buckets belong to, which is unknown when using a custom endpoint
+	var account string
+	if s.options.Endpoint == "" {
+		identity, err := s.stsClient.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return nil, nil, err
+		}
+		account = aws.StringValue(identity.Account)
+	}
+
+	if s.options.AccountFilter != nil && !s.options.AccountFilter.MatchString(account) {
+		return []*Bucket{}, nil, nil
+	}
+
+	// List all the S3 buckets, setting the account and profile they were found with
+	buckets, err := ListBuckets(s.client)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, bucket := range buckets {
+		bucket.Account = account
+		bucket.Profile = s.options.Profile
+	}
+
+	// Index the inventory manifests of the local copy of their destination bucket once for all the buckets
+	var manifests map[string]string
+	if s.options.InventoryDir != "" {
+		manifests, err = IndexLocalInventoryManifests(s.options.InventoryDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Fetch the cost of every bucket in a single query grouped by the cost allocation tag, once a bucket needs it
+	costs := &costReportLoader{fetch: func(ctx context.Context) (*CostReport, error) {
+		return GetCostReport(ctx, s.costClient, s.options.CostPeriod, s.options.CostTag)
+	}}
+
+	// Make the channel from which the workers will fetch the butckets they need to process
+	bucketChan := make(chan *Bucket, len(buckets))
+	// Make the channel on which the workers will send the outcome of every bucket
+	resultChan := make(chan scanResult)
+
+	// Initialize a waitgroup that will wait for all the workers to be done working
+	var wg sync.WaitGroup
+
+	// Start all the workers
+	for i := 1; i <= s.options.Workers; i++ {
+		// Increment the waitgroup and launch a worker into its own goroutine
+		wg.Add(1)
+		go func() {
+			// Decrement the waitgroup when the worker is done working
+			defer wg.Done()
+
+			// Loop over the bucket (job) channel to get the buckets to process, reusing the outcome of the buckets already in the checkpoint
+			for bucket := range bucketChan {
+				if completed, ok := s.options.Checkpoint.completed(bucket); ok {
+					resultChan <- scanResult{bucket: completed.Bucket, keep: completed.Keep}
+					continue
+				}
+				result := s.scanBucket(ctx, bucket, costs, manifests)
+				s.options.Checkpoint.complete(result)
+				resultChan <- result
+			}
+		}()
+	}
+
+	// Add the buckets to the bucket (job) channel
+	for _, bucket := range buckets {
+		bucketChan <- bucket
+	}
+	// Close the bucket (job) channel to let the workers know no more job will be added to it
+	close(bucketChan)
+
+	// Close the result channel once all the workers are done working
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	// Collect the results, this goroutine being the only one writing to the slices
+	filteredBuckets := make([]*Bucket, 0)
+	bucketErrors := make([]*BucketError, 0)
+	for result := range resultChan {
+		bucketErrors = append(bucketErrors, result.errors...)
+		if result.keep {
+			filteredBuckets = append(filteredBuckets, result.bucket)
+		}
+	}
+
+	// Keep the costs tagged with the name of none of the account's buckets, to report them
+	s.costsMutex.Lock()
+	s.unattributedCosts, s.untaggedCost = nil, 0
+	if report := costs.fetched(); report != nil {
+		s.unattributedCosts, s.untaggedCost = report.Unattributed(buckets), report.Untagged
+	}
+	s.costsMutex.Unlock()
+
+	return filteredBuckets, bucketErrors, nil
+}
+
+// scanBucket fetches a single bucket's information, skipping the bucket as soon as it does not match the filters
+// Its cost comes from the cost report of the scan, fetched by the first bucket needing it, and its inventory from the manifests of the
+// scan's InventoryDir, if any
+func (s *Scanner) scanBucket(ctx context.Context, bucket *Bucket, costs *costReportLoader, manifests map[string]string) scanResult {
+	result := scanResult{bucket: bucket}
+
+	// Check if the name filter's regex matches the current bucket's name
+	// Skip the bucket if it does not
+	if s.options.NameFilter != nil && !s.options.NameFilter.MatchString(bucket.Name) {
+		return result
+	}
+	if !s.options.Where.match(bucket, phaseList) {
+		return result
+	}
+
+	// Keep the bucket as incomplete if the scan was cancelled before it could be processed
+	if ctx.Err() != nil {
+		bucket.Incomplete = true
+		result.keep = true
+		return result
+	}
+
+	// Limit the time spent on the bucket if a bucket timeout is set
+	bucketCtx := ctx
+	if s.options.BucketTimeout > 0 {
+		var cancel context.CancelFunc
+		bucketCtx, cancel = context.WithTimeout(ctx, s.options.BucketTimeout)
+		defer cancel()
+	}
+
+	// fail records the error of an operation
+	// If the operation was interrupted by the bucket timeout or the scan being cancelled, the bucket is kept and marked as incomplete
+	// The error is not recorded when the whole scan was cancelled, since every bucket being processed would report it
+	fail := func(op string, err error) scanResult {
+		if bucketCtx.Err() != nil {
+			bucket.Incomplete = true
+			result.keep = true
+			if ctx.Err() != nil {
+				return result
+			}
+		}
+		result.errors = append(result.errors, &BucketError{Bucket: bucket.Name, Op: op, Err: err})
+		return result
+	}
+
+	// Set the bucket's region attribute
+	// Skip the bucket if an error is returned. This is because without its region, we might not be able to fetch its objects and will end up with bad informations
+	// S3 compatible services often do not return the bucket's region, the scanner's region being used instead
+	err := bucket.SetBucketRegion(bucketCtx, s.client)
+	if err != nil && s.options.Endpoint != "" && bucketCtx.Err() == nil {
+		bucket.Region = s.region
+		err = nil
+	}
+	if err != nil {
+		return fail("get the region", err)
+	}
+	if !s.options.Where.match(bucket, phaseRegion) {
+		return result
+	}
+
+	// Set the bucket's security settings, the errors fetching a specific setting being recorded in the bucket itself
+	// Skip the bucket if it does not match the PublicOnly and UnencryptedOnly filters
+	if s.options.Security || s.options.PublicOnly || s.options.UnencryptedOnly || s.options.Where.needs(phaseSecurity) {
+		err = bucket.SetBucketSecurity(bucketCtx, s.regionClients.get(bucket.Region).s3)
+		if err != nil {
+			return fail("get the security settings", err)
+		}
+
+		if (s.options.PublicOnly && !bucket.IsPublic()) || (s.options.UnencryptedOnly && !bucket.IsUnencrypted()) {
+			return result
+		}
+		if !s.options.Where.match(bucket, phaseSecurity) {
+			return result
+		}
+	}
+
+	// Set the summary of the bucket's lifecycle and replication configurations, the errors fetching a specific configuration
+	// being recorded in the bucket itself
+	if s.options.Configuration || s.options.Where.needs(phaseConfiguration) {
+		err = bucket.SetBucketConfiguration(bucketCtx, s.regionClients.get(bucket.Region).s3)
+		if err != nil {
+			return fail("get the lifecycle and replication configurations", err)
+		}
+		if !s.options.Where.match(bucket, phaseConfiguration) {
+			return result
+		}
+	}
+
+	// Set the bucket's incomplete multipart uploads metrics, before its objects metrics since listing the uploads is usually cheaper
+	// Skip the bucket if it does not have an upload older than the UploadsOlderThan filter
+	if s.options.MultipartUploads || s.options.UploadsOlderThan > 0 || s.options.Where.needs(phaseMultipart) {
+		err = bucket.SetBucketMultipartUploadsMetrics(bucketCtx, s.regionClients.get(bucket.Region).s3)
+		if err != nil {
+			return fail("get the multipart uploads metrics", err)
+		}
+
+		if s.options.UploadsOlderThan > 0 {
+			if bucket.OldestUploadInitiated.IsZero() || bucket.OldestUploadInitiated.After(time.Now().Add(-s.options.UploadsOlderThan)) {
+				return result
+			}
+		}
+		if !s.options.Where.match(bucket, phaseMultipart) {
+			return result
+		}
+	}
+
+	// Set the bucket objects metrics (e.g. objects count, total size) using a client in the bucket's region
+	// The previous versions of the objects are only listed if requested, since it is more expensive
+	// The bucket is kept if only its inventory cannot be read, its objects being listed instead
+	if s.options.Versions || s.options.Where.needs(phaseVersions) {
+		err = s.setVersionsMetrics(bucketCtx, bucket, manifests)
+	} else if s.options.ListsObjects() {
+		err = s.setObjectsMetrics(bucketCtx, bucket, manifests)
+	}
+	if _, ok := err.(*InventoryFormatError); ok {
+		fail("read the inventory", err)
+	} else if err != nil {
+		return fail("get the objects metrics", err)
+	}
+
+	// Check if the current bucket has a storage class matching the regex used to filter the buckets
+	// Skip the bucket if it does not
+	if s.options.StorageClassFilter != nil {
+		hasStorageClass := false
+		for class := range bucket.StorageClassesStats {
+			if s.options.StorageClassFilter.MatchString(class) {
+				hasStorageClass = true
+			}
+		}
+		if !hasStorageClass {
+			return result
+		}
+	}
+	if !s.options.Where.match(bucket, phaseObjects, phaseVersions) {
+		return result
+	}
+
+	// Set the bucket's cost over the provided period (e.g. 30 days) from the scan's cost report, unless using a custom endpoint which has
+	// no cost explorer. The bucket is kept even if its cost cannot be fetched
+	if s.options.Endpoint != "" || (s.options.SkipCost && !s.options.Where.needs(phaseCost)) {
+		bucket.Cost = -1
+	} else {
+		var report *CostReport
+		report, err = costs.get(bucketCtx)
+		if err != nil {
+			bucket.Cost = -1
+			fail("get the cost", err)
+		} else {
+			bucket.SetBucketCost(report)
+		}
+	}
+	if !s.options.Where.match(bucket, phaseCost) {
+		return result
+	}
+
+	result.keep = true
+	return result
+}
+
+// UnattributedCosts returns the costs of the last Scan tagged with a value matching none of the account's buckets, sorted by decreasing
+// cost, along with the cost of the S3 usage without the cost allocation tag. Both are empty if the scan did not fetch the costs
+func (s *Scanner) UnattributedCosts() ([]TagCost, float64) {
+	s.costsMutex.Lock()
+	defer s.costsMutex.Unlock()
+	return s.unattributedCosts, s.untaggedCost
+}
+
+// setObjectsMetrics sets the bucket's objects metrics from the options' metrics source
+// With MetricsSourceAuto and MetricsSourceInventory, the objects of the buckets without CloudWatch datapoints or inventory are listed
+// The objects of the buckets whose inventory is in an unsupported format are listed as well, the InventoryFormatError being returned
+// once they are listed
+func (s *Scanner) setObjectsMetrics(ctx context.Context, bucket *Bucket, manifests map[string]string) error {
+	switch s.options.MetricsSource {
+	case MetricsSourceCloudWatch, MetricsSourceAuto:
+		found, err := bucket.SetBucketCloudWatchMetrics(ctx, s.regionClients.get(bucket.Region).cloudWatch)
+		if err != nil || found || s.options.MetricsSource == MetricsSourceCloudWatch {
+			return err
+		}
+	case MetricsSourceInventory:
+		found, err := s.setInventoryMetrics(ctx, bucket, false, manifests)
+		if _, ok := err.(*InventoryFormatError); ok {
+			return listedInstead(err, s.listObjectsMetrics(ctx, bucket))
+		} else if err != nil || found {
+			return err
+		}
+	}
+	return s.listObjectsMetrics(ctx, bucket)
+}
+
+// listObjectsMetrics lists the bucket's objects, a sample of them if Sample is set, in parallel if BucketWorkers is set, or resuming the listing recorded in the checkpoint,
+// if any, and recording its progress
+// The listing is only kept in the checkpoint if it was interrupted, the ones that completed or failed (e.g. on an expired continuation
+// token) being forgotten to start over on the next run
+func (s *Scanner) listObjectsMetrics(ctx context.Context, bucket *Bucket) error {
+	if s.options.Sample > 0 {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return bucket.SetBucketObjectsMetricsSample(ctx, s.regionClients.get(bucket.Region).s3, s.options.Sample, random)
+	}
+	if s.options.BucketWorkers > 1 {
+		return bucket.SetBucketObjectsMetricsParallel(ctx, s.regionClients.get(bucket.Region).s3, s.options.BucketWorkers)
+	}
+
+	checkpoint := s.options.Checkpoint
+	err := bucket.listObjectsMetrics(ctx, s.regionClients.get(bucket.Region).s3, checkpoint.listing(bucket), func(listing *objectsListing) {
+		checkpoint.updateListing(bucket, listing)
+	})
+	if ctx.Err() == nil {
+		checkpoint.updateListing(bucket, nil)
+	}
+	return err
+}
+
+// setVersionsMetrics sets the bucket's objects metrics, taking into account every version of the objects
+// They are read from the bucket's inventory with MetricsSourceInventory if it includes every version, and listed otherwise, the same
+// way as setObjectsMetrics for the inventories in an unsupported format
+func (s *Scanner) setVersionsMetrics(ctx context.Context, bucket *Bucket, manifests map[string]string) error {
+	if s.options.MetricsSource == MetricsSourceInventory {
+		found, err := s.setInventoryMetrics(ctx, bucket, true, manifests)
+		if _, ok := err.(*InventoryFormatError); ok {
+			return listedInstead(err, bucket.SetBucketVersionsMetrics(ctx, s.regionClients.get(bucket.Region).s3))
+		} else if err != nil || found {
+			return err
+		}
+	}
+	return bucket.SetBucketVersionsMetrics(ctx, s.regionClients.get(bucket.Region).s3)
+}
+
+// listedInstead returns the error of the listing of a bucket whose inventory could not be read, or the inventory's error if the listing
+// succeeded
+func listedInstead(inventoryErr, listErr error) error {
+	if listErr != nil {
+		return listErr
+	}
+	return inventoryErr
+}
+
+// setInventoryMetrics sets the bucket's objects metrics from its latest inventory report, read from the InventoryDir, whose manifests are
+// indexed by bucket name, or from its destination bucket
+// It returns false if the bucket has no report, or none including every version of the objects when versions is set, and an
+// InventoryFormatError if its report is in an unsupported format
+func (s *Scanner) setInventoryMetrics(ctx context.Context, bucket *Bucket, versions bool, manifests map[string]string) (bool, error) {
+	var store InventoryStore
+	var key string
+	var found bool
+	var err error
+	if s.options.InventoryDir != "" {
+		store = &LocalInventoryStore{Dir: s.options.InventoryDir}
+		key, found = manifests[bucket.Name]
+	} else {
+		var location *InventoryLocation
+		location, err = bucket.GetBucketInventoryLocation(ctx, s.regionClients.get(bucket.Region).s3)
+		if err != nil || location == nil || (versions && !location.Versions) {
+			return false, err
+		}
+		if location.Format != s3.InventoryFormatCsv {
+			return false, &InventoryFormatError{Format: location.Format}
+		}
+
+		// The destination bucket can be in another region than the source bucket
+		var region string
+		region, err = s3manager.GetBucketRegionWithClient(ctx, s.client, location.Bucket)
+		if err != nil {
+			return false, err
+		}
+		client := s.regionClients.get(region).s3
+		store = &S3InventoryStore{Bucket: location.Bucket, Client: client}
+		key, found, err = FindLatestInventoryManifest(ctx, client, location)
+	}
+	if err != nil || !found {
+		return false, err
+	}
+
+	manifest, err := ReadInventoryManifest(ctx, store, key)
+	if err != nil {
+		return false, err
+	}
+	if versions && !manifest.HasVersions() {
+		return false, nil
+	}
+	if manifest.FileFormat != s3.InventoryFormatCsv {
+		return false, &InventoryFormatError{Format: manifest.FileFormat}
+	}
+	return true, bucket.SetBucketInventoryMetrics(ctx, store, manifest)
+}
+
+// Drill breaks the objects of a single bucket down by prefix, see DrillBucket
+// The bucket is listed with a client in its region, the scanner's region being used for the S3 compatible services not returning it
+func (s *Scanner) Drill(ctx context.Context, bucketName string, options DrillOptions) (*Prefix, error) {
+	bucket := &Bucket{Name: bucketName}
+	err := bucket.SetBucketRegion(ctx, s.client)
+	if err != nil && s.options.Endpoint != "" && ctx.Err() == nil {
+		bucket.Region = s.region
+		err = nil
+	}
+	if err != nil {
+		return nil, &BucketError{Bucket: bucketName, Op: "get the region", Err: err}
+	}
+
+	prefix, err := DrillBucket(ctx, s.regionClients.get(bucket.Region).s3, bucketName, options)
+	if err != nil {
+		return nil, &BucketError{Bucket: bucketName, Op: "list the prefixes", Err: err}
+	}
+	return prefix, nil
+}
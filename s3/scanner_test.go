@@ -0,0 +1,432 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// mockScanClient is an S3 client serving a set of fake buckets, each bucket containing a single object
+// When block is set, listing the objects blocks until the context is done. listCalls counts the objects listings
+type mockScanClient struct {
+	s3iface.S3API
+	block     bool
+	buckets   map[string]string
+	listCalls int64
+}
+
+func (m *mockScanClient) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	creationDate := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	output := &s3.ListBucketsOutput{}
+	for name := range m.buckets {
+		output.Buckets = append(output.Buckets, &s3.Bucket{
+			CreationDate: aws.Time(creationDate),
+			Name:         aws.String(name),
+		})
+	}
+	return output, nil
+}
+
+// HeadBucketRequest returns a request that, once sent, responds with the bucket's region header
+func (m *mockScanClient) HeadBucketRequest(input *s3.HeadBucketInput) (*request.Request, *s3.HeadBucketOutput) {
+	output := &s3.HeadBucketOutput{}
+	req := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{Name: "HeadBucket"}, input, output)
+
+	region, ok := m.buckets[aws.StringValue(input.Bucket)]
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+		if !ok {
+			r.Error = awserr.New("NotFound", "bucket not found", nil)
+			return
+		}
+		r.HTTPResponse.Header.Set("X-Amz-Bucket-Region", region)
+	})
+
+	return req, output
+}
+
+func (m *mockScanClient) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	atomic.AddInt64(&m.listCalls, 1)
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	fn(&s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{
+				Key:          aws.String("object"),
+				LastModified: aws.Time(time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)),
+				Size:         aws.Int64(100),
+				StorageClass: aws.String("STANDARD"),
+			},
+		},
+	}, true)
+	return nil
+}
+
+// ListMultipartUploadsPagesWithContext returns an upload initiated in 2020 for the buckets with a name starting with 'uploads-'
+func (m *mockScanClient) ListMultipartUploadsPagesWithContext(ctx aws.Context, input *s3.ListMultipartUploadsInput, fn func(*s3.ListMultipartUploadsOutput, bool) bool, opts ...request.Option) error {
+	output := &s3.ListMultipartUploadsOutput{}
+	if strings.HasPrefix(aws.StringValue(input.Bucket), "uploads-") {
+		output.Uploads = []*s3.MultipartUpload{
+			{Initiated: aws.Time(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)), Key: aws.String("object"), UploadId: aws.String("upload")},
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func (m *mockScanClient) ListPartsPagesWithContext(ctx aws.Context, input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool, opts ...request.Option) error {
+	fn(&s3.ListPartsOutput{Parts: []*s3.Part{{PartNumber: aws.Int64(1), Size: aws.Int64(10)}}}, true)
+	return nil
+}
+
+// mockCostClient is a cost explorer client returning the same cost for every bucket, grouped by the value of the tag and split into pages
+// of costPageSize groups, along with the cost of a deleted bucket and of the untagged usage. requests counts the queries
+type mockCostClient struct {
+	costexploreriface.CostExplorerAPI
+	buckets  map[string]string
+	err      error
+	requests int32
+}
+
+// costPageSize is the number of groups per page of the mockCostClient
+const costPageSize = 8
+
+func (m *mockCostClient) GetCostAndUsageWithContext(ctx aws.Context, input *costexplorer.GetCostAndUsageInput, opts ...request.Option) (*costexplorer.GetCostAndUsageOutput, error) {
+	atomic.AddInt32(&m.requests, 1)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	values := make([]string, 0, len(m.buckets)+2)
+	for name := range m.buckets {
+		values = append(values, name)
+	}
+	sort.Strings(values)
+
+	tag := aws.StringValue(input.GroupBy[0].Key)
+	var groups []*costexplorer.Group
+	for _, value := range append(values, "deleted-bucket", "") {
+		amount := "1.5"
+		if value == "deleted-bucket" {
+			amount = "2"
+		} else if value == "" {
+			amount = "0.25"
+		}
+		groups = append(groups, &costexplorer.Group{
+			Keys:    []*string{aws.String(tag + "$" + value)},
+			Metrics: map[string]*costexplorer.MetricValue{"AmortizedCost": {Amount: aws.String(amount)}},
+		})
+	}
+
+	start, _ := strconv.Atoi(aws.StringValue(input.NextPageToken))
+	end := start + costPageSize
+	output := &costexplorer.GetCostAndUsageOutput{}
+	if end < len(groups) {
+		output.NextPageToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(groups)
+	}
+	output.ResultsByTime = []*costexplorer.ResultByTime{{Groups: groups[start:end]}}
+	return output, nil
+}
+
+// mockSTSClient is an STS client returning the same account for every caller
+type mockSTSClient struct {
+	stsiface.STSAPI
+}
+
+func (m *mockSTSClient) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}, nil
+}
+
+// newMockScanner returns a Scanner using mocked clients serving the provided buckets
+func newMockScanner(buckets map[string]string, costClient *mockCostClient, options ScannerOptions) *Scanner {
+	client := &mockScanClient{buckets: buckets}
+	costClient.buckets = buckets
+	return &Scanner{
+		client:     client,
+		costClient: costClient,
+		options:    options,
+		regionClients: newRegionClients(func(region string) *regionalClients {
+			return &regionalClients{cloudWatch: &mockMetricsClient{}, s3: client}
+		}),
+		stsClient: &mockSTSClient{},
+	}
+}
+
+func TestScan(t *testing.T) {
+	buckets := map[string]string{}
+	for i := 0; i < 20; i++ {
+		buckets[fmt.Sprintf("bucket%v", i)] = "eu-west-1"
+	}
+
+	costClient := &mockCostClient{}
+	scanner := newMockScanner(buckets, costClient, ScannerOptions{CostPeriod: 30, CostTag: "name", Profile: "prod", Workers: 5})
+	results, bucketErrors, err := scanner.Scan(context.Background())
+
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(bucketErrors) != 0 {
+		t.Errorf("Scan(): FAILED, expected no bucket errors but received '%v'", bucketErrors)
+	}
+	if len(results) != len(buckets) {
+		t.Fatalf("Scan(): FAILED, expected %v buckets but received '%v'", len(buckets), len(results))
+	}
+	for _, bucket := range results {
+		if bucket.Region != "eu-west-1" || bucket.ObjectCount != 1 || bucket.SizeBytes != 100 || bucket.Cost != 1.5 || bucket.Account != "123456789012" || bucket.Profile != "prod" {
+			t.Errorf("Scan(): FAILED, unexpected bucket '%+v'", bucket)
+		}
+	}
+
+	// The costs of the 20 buckets, of a deleted bucket and of the untagged usage are 3 pages of a single query
+	if costClient.requests != 3 {
+		t.Errorf("Scan(): FAILED, expected 3 cost explorer requests but received '%v'", costClient.requests)
+	}
+	unattributed, untagged := scanner.UnattributedCosts()
+	if !reflect.DeepEqual(unattributed, []TagCost{{Cost: 2, Value: "deleted-bucket"}}) || untagged != 0.25 {
+		t.Errorf("UnattributedCosts(): FAILED, expected the cost of deleted-bucket and 0.25 untagged but received '%+v' and '%v'", unattributed, untagged)
+	}
+}
+
+// TestScanConcurrency is meant to be run with 'go test -race', many workers processing hundreds of buckets spread across regions
+func TestScanConcurrency(t *testing.T) {
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1", "eu-central-1", "ap-southeast-2", "sa-east-1"}
+	buckets := map[string]string{}
+	for i := 0; i < 500; i++ {
+		buckets[fmt.Sprintf("bucket%v", i)] = regions[i%len(regions)]
+	}
+
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{Workers: 50})
+
+	// Count the clients created for every region, they must only be created once
+	var mutex sync.Mutex
+	created := map[string]int{}
+	scanner.regionClients = newRegionClients(func(region string) *regionalClients {
+		mutex.Lock()
+		defer mutex.Unlock()
+		created[region]++
+		return &regionalClients{cloudWatch: &mockMetricsClient{}, s3: scanner.client}
+	})
+
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(bucketErrors) != 0 {
+		t.Errorf("Scan(): FAILED, expected no bucket errors but received '%v'", bucketErrors)
+	}
+	if len(results) != len(buckets) {
+		t.Errorf("Scan(): FAILED, expected %v buckets but received '%v'", len(buckets), len(results))
+	}
+
+	seen := map[string]bool{}
+	for _, bucket := range results {
+		if seen[bucket.Name] {
+			t.Errorf("Scan(): FAILED, bucket '%v' returned more than once", bucket.Name)
+		}
+		seen[bucket.Name] = true
+		if bucket.Region != buckets[bucket.Name] {
+			t.Errorf("Scan(): FAILED, expected region '%v' for bucket '%v' but received '%v'", buckets[bucket.Name], bucket.Name, bucket.Region)
+		}
+	}
+
+	if len(created) != len(regions) {
+		t.Errorf("Scan(): FAILED, expected a client for %v regions but received '%v'", len(regions), created)
+	}
+	for region, count := range created {
+		if count != 1 {
+			t.Errorf("Scan(): FAILED, expected a single client for region '%v' but %v were created", region, count)
+		}
+	}
+}
+
+func TestScanFilters(t *testing.T) {
+	buckets := map[string]string{"keep-me": "us-east-1", "drop-me": "us-east-1"}
+
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{NameFilter: regexp.MustCompile("^keep"), Workers: 2})
+	results, _, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || results[0].Name != "keep-me" {
+		t.Errorf("Scan(): FAILED, expected only bucket 'keep-me' but received '%v'", results)
+	}
+
+	scanner = newMockScanner(buckets, &mockCostClient{}, ScannerOptions{StorageClassFilter: regexp.MustCompile("GLACIER"), Workers: 2})
+	results, _, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Scan(): FAILED, expected no buckets but received '%v'", results)
+	}
+
+	scanner = newMockScanner(buckets, &mockCostClient{}, ScannerOptions{AccountFilter: regexp.MustCompile("^999"), Workers: 2})
+	results, _, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Scan(): FAILED, expected no buckets for another account but received '%v'", results)
+	}
+}
+
+func TestScanWhere(t *testing.T) {
+	buckets := map[string]string{"logs-eu": "eu-west-1", "logs-us": "us-east-1", "data-eu": "eu-west-1", "uploads-eu": "eu-west-1"}
+
+	// The name and region conditions are evaluated before listing the objects, which is only done for the matching buckets
+	where, err := ParseWhere(`name =~ "^logs-" && region == "eu-west-1" && size >= 100B && modified > 30d`)
+	if err != nil {
+		t.Fatalf("ParseWhere(): FAILED, expected no errors but received '%v'", err)
+	}
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{Where: where, Workers: 2})
+	results, _, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || results[0].Name != "logs-eu" {
+		t.Errorf("Scan(): FAILED, expected only bucket 'logs-eu' but received '%v'", results)
+	}
+	if listCalls := scanner.client.(*mockScanClient).listCalls; listCalls != 1 {
+		t.Errorf("Scan(): FAILED, expected the objects of a single bucket to be listed but %v were", listCalls)
+	}
+
+	// The fields of the phases that were not requested are fetched
+	where, _ = ParseWhere(`uploads > 0`)
+	scanner = newMockScanner(buckets, &mockCostClient{}, ScannerOptions{Where: where, Workers: 2})
+	results, _, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || results[0].Name != "uploads-eu" {
+		t.Errorf("Scan(): FAILED, expected only bucket 'uploads-eu' but received '%v'", results)
+	}
+}
+
+func TestScanSkip(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1", "bucket2": "eu-west-1"}
+
+	// Neither the objects nor the cost are fetched, the failing cost client not being called
+	scanner := newMockScanner(buckets, &mockCostClient{err: fmt.Errorf("access denied")}, ScannerOptions{SkipCost: true, SkipObjects: true, Workers: 2})
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 2 || len(bucketErrors) != 0 {
+		t.Errorf("Scan(): FAILED, expected 2 buckets without errors but received '%v' and '%v'", results, bucketErrors)
+	}
+	for _, bucket := range results {
+		if bucket.Cost != -1 || bucket.ObjectCount != 0 {
+			t.Errorf("Scan(): FAILED, expected bucket %v to have no cost nor objects but received '%v' and %v objects", bucket.Name, bucket.Cost, bucket.ObjectCount)
+		}
+	}
+	if listCalls := scanner.client.(*mockScanClient).listCalls; listCalls != 0 {
+		t.Errorf("Scan(): FAILED, expected no objects listing but %v were made", listCalls)
+	}
+
+	// The objects are still listed when the where expression needs them
+	where, _ := ParseWhere(`files > 0`)
+	scanner = newMockScanner(buckets, &mockCostClient{}, ScannerOptions{SkipCost: true, SkipObjects: true, Where: where, Workers: 2})
+	results, _, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Scan(): FAILED, expected 2 buckets but received '%v'", results)
+	}
+}
+
+func TestScanUploadsOlderThan(t *testing.T) {
+	buckets := map[string]string{"uploads-bucket": "us-east-1", "clean-bucket": "us-east-1"}
+
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{UploadsOlderThan: 7 * 24 * time.Hour, Workers: 2})
+	results, _, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || results[0].Name != "uploads-bucket" || results[0].IncompleteUploadCount != 1 {
+		t.Errorf("Scan(): FAILED, expected only bucket 'uploads-bucket' with 1 upload but received '%v'", results)
+	}
+}
+
+func TestScanCostError(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1"}
+
+	scanner := newMockScanner(buckets, &mockCostClient{err: fmt.Errorf("access denied")}, ScannerOptions{Workers: 1})
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || results[0].Cost != -1 {
+		t.Errorf("Scan(): FAILED, expected the bucket to be kept without a cost but received '%v'", results)
+	}
+	if len(bucketErrors) != 1 || bucketErrors[0].Bucket != "bucket1" {
+		t.Errorf("Scan(): FAILED, expected a single error for bucket1 but received '%v'", bucketErrors)
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1", "bucket2": "us-east-1"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{Workers: 2})
+	results, bucketErrors, err := scanner.Scan(ctx)
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(bucketErrors) != 0 {
+		t.Errorf("Scan(): FAILED, expected no bucket errors but received '%v'", bucketErrors)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Scan(): FAILED, expected 2 buckets but received '%v'", len(results))
+	}
+	for _, bucket := range results {
+		if !bucket.Incomplete {
+			t.Errorf("Scan(): FAILED, expected bucket '%v' to be incomplete", bucket.Name)
+		}
+	}
+}
+
+func TestScanBucketTimeout(t *testing.T) {
+	buckets := map[string]string{"bucket1": "us-east-1"}
+
+	scanner := newMockScanner(buckets, &mockCostClient{}, ScannerOptions{BucketTimeout: 10 * time.Millisecond, Workers: 1})
+	scanner.client.(*mockScanClient).block = true
+
+	results, bucketErrors, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan(): FAILED, expected no errors but received '%v'", err)
+	}
+	if len(results) != 1 || !results[0].Incomplete {
+		t.Errorf("Scan(): FAILED, expected bucket1 to be kept as incomplete but received '%v'", results)
+	}
+	if len(bucketErrors) != 1 || bucketErrors[0].Bucket != "bucket1" {
+		t.Errorf("Scan(): FAILED, expected a single timeout error for bucket1 but received '%v'", bucketErrors)
+	}
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"context"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// The keys of a bucket's SecurityErrors, one for every security setting fetched by SetBucketSecurity
+const (
+	SecurityFieldACL               = "acl"
+	SecurityFieldEncryption        = "encryption"
+	SecurityFieldPolicyStatus      = "policystatus"
+	SecurityFieldPublicAccessBlock = "publicaccessblock"
+)
+
+// publicGroups contains the grantee groups making a bucket public when granted any permission
+var publicGroups = map[string]bool{
+	"http://acs.amazonaws.com/groups/global/AllUsers":           true,
+	"http://acs.amazonaws.com/groups/global/AuthenticatedUsers": true,
+}
+
+// SetBucketSecurity sets the bucket's security settings: its default encryption, public access block, policy status and ACL grants
+// An error fetching one of the settings (e.g. access denied) is recorded in SecurityErrors under the setting's key instead of being returned,
+// the other settings still being fetched. An error is only returned if ctx is done
+func (b *Bucket) SetBucketSecurity(ctx context.Context, client s3iface.S3API) error {
+	b.SecurityErrors = map[string]string{}
+
+	// recordError records the error of a setting, returning the context's error if it is done
+	recordError := func(field string, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.SecurityErrors[field] = err.Error()
+		return nil
+	}
+
+	// Set the default encryption, a bucket without encryption configuration being unencrypted
+	encryption, err := client.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(b.Name)})
+	if err != nil && !isErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		if err := recordError(SecurityFieldEncryption, err); err != nil {
+			return err
+		}
+	} else {
+		b.Encryption = ""
+		if encryption != nil && encryption.ServerSideEncryptionConfiguration != nil {
+			for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+				if rule.ApplyServerSideEncryptionByDefault != nil {
+					b.Encryption = aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+				}
+			}
+		}
+	}
+
+	// Set the public access block, which is only considered enabled if all of its settings are
+	accessBlock, err := client.GetPublicAccessBlockWithContext(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(b.Name)})
+	if err != nil && !isErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		if err := recordError(SecurityFieldPublicAccessBlock, err); err != nil {
+			return err
+		}
+	} else {
+		b.PublicAccessBlocked = false
+		if accessBlock != nil && accessBlock.PublicAccessBlockConfiguration != nil {
+			config := accessBlock.PublicAccessBlockConfiguration
+			b.PublicAccessBlocked = aws.BoolValue(config.BlockPublicAcls) && aws.BoolValue(config.BlockPublicPolicy) &&
+				aws.BoolValue(config.IgnorePublicAcls) && aws.BoolValue(config.RestrictPublicBuckets)
+		}
+	}
+
+	// Set the policy status, a bucket without policy not being public
+	policyStatus, err := client.GetBucketPolicyStatusWithContext(ctx, &s3.GetBucketPolicyStatusInput{Bucket: aws.String(b.Name)})
+	if err != nil && !isErrorCode(err, "NoSuchBucketPolicy") {
+		if err := recordError(SecurityFieldPolicyStatus, err); err != nil {
+			return err
+		}
+	} else {
+		b.PolicyIsPublic = false
+		if policyStatus != nil && policyStatus.PolicyStatus != nil {
+			b.PolicyIsPublic = aws.BoolValue(policyStatus.PolicyStatus.IsPublic)
+		}
+	}
+
+	// Set the ACL grants, formatted as 'grantee:PERMISSION'
+	acl, err := client.GetBucketAclWithContext(ctx, &s3.GetBucketAclInput{Bucket: aws.String(b.Name)})
+	if err != nil {
+		if err := recordError(SecurityFieldACL, err); err != nil {
+			return err
+		}
+	} else {
+		b.ACLGrants = []string{}
+		b.ACLIsPublic = false
+		for _, grant := range acl.Grants {
+			if grant.Grantee == nil {
+				continue
+			}
+			if publicGroups[aws.StringValue(grant.Grantee.URI)] {
+				b.ACLIsPublic = true
+			}
+			b.ACLGrants = append(b.ACLGrants, formatGrantee(grant.Grantee, acl.Owner)+":"+aws.StringValue(grant.Permission))
+		}
+	}
+
+	return nil
+}
+
+// IsPublic returns true if the bucket's policy or ACL makes it public and its public access block does not prevent it
+func (b *Bucket) IsPublic() bool {
+	return (b.PolicyIsPublic || b.ACLIsPublic) && !b.PublicAccessBlocked
+}
+
+// IsPublicUnknown returns whether IsPublic cannot be trusted, one of the settings it depends on (the policy status, the ACL or the
+// public access block) failing to be fetched
+func (b *Bucket) IsPublicUnknown() bool {
+	for _, field := range []string{SecurityFieldACL, SecurityFieldPolicyStatus, SecurityFieldPublicAccessBlock} {
+		if _, failed := b.SecurityErrors[field]; failed {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnencrypted returns true if the bucket is known to have no default encryption
+func (b *Bucket) IsUnencrypted() bool {
+	_, failed := b.SecurityErrors[SecurityFieldEncryption]
+	return b.SecurityErrors != nil && !failed && b.Encryption == ""
+}
+
+// formatGrantee returns a short name for an ACL grantee: 'owner' for the bucket's owner, the group name for groups
+// (e.g. 'AllUsers') and the display name, email or ID of the other users
+func formatGrantee(grantee *s3.Grantee, owner *s3.Owner) string {
+	switch {
+	case grantee.URI != nil:
+		return path.Base(aws.StringValue(grantee.URI))
+	case owner != nil && grantee.ID != nil && aws.StringValue(grantee.ID) == aws.StringValue(owner.ID):
+		return "owner"
+	case grantee.DisplayName != nil:
+		return aws.StringValue(grantee.DisplayName)
+	case grantee.EmailAddress != nil:
+		return aws.StringValue(grantee.EmailAddress)
+	default:
+		return aws.StringValue(grantee.ID)
+	}
+}
+
+// isErrorCode returns true if err is an AWS error with the provided code
+func isErrorCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
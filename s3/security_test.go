@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// mockSecurityClient is an S3 client serving the security settings of a bucket without encryption configuration,
+// fully blocked from public access, with a public policy and for which the ACL cannot be read
+type mockSecurityClient struct {
+	s3iface.S3API
+}
+
+func (m *mockSecurityClient) GetBucketEncryptionWithContext(ctx aws.Context, input *s3.GetBucketEncryptionInput, opts ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
+	return &s3.GetBucketEncryptionOutput{}, awserr.New("ServerSideEncryptionConfigurationNotFoundError", "not found", nil)
+}
+
+func (m *mockSecurityClient) GetPublicAccessBlockWithContext(ctx aws.Context, input *s3.GetPublicAccessBlockInput, opts ...request.Option) (*s3.GetPublicAccessBlockOutput, error) {
+	return &s3.GetPublicAccessBlockOutput{
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}, nil
+}
+
+func (m *mockSecurityClient) GetBucketPolicyStatusWithContext(ctx aws.Context, input *s3.GetBucketPolicyStatusInput, opts ...request.Option) (*s3.GetBucketPolicyStatusOutput, error) {
+	return &s3.GetBucketPolicyStatusOutput{PolicyStatus: &s3.PolicyStatus{IsPublic: aws.Bool(true)}}, nil
+}
+
+func (m *mockSecurityClient) GetBucketAclWithContext(ctx aws.Context, input *s3.GetBucketAclInput, opts ...request.Option) (*s3.GetBucketAclOutput, error) {
+	return nil, awserr.New("AccessDenied", "access denied", nil)
+}
+
+func TestSetBucketSecurity(t *testing.T) {
+	bucket := &Bucket{Name: "bucket1"}
+
+	err := bucket.SetBucketSecurity(context.Background(), &mockSecurityClient{})
+	if err != nil {
+		t.Fatalf("SetBucketSecurity(): FAILED, expected no errors but received '%v'", err)
+	}
+
+	if bucket.Encryption != "" || !bucket.IsUnencrypted() {
+		t.Errorf("SetBucketSecurity(): FAILED, expected the bucket to be unencrypted but received '%v'", bucket.Encryption)
+	}
+	if !bucket.PublicAccessBlocked || !bucket.PolicyIsPublic {
+		t.Errorf("SetBucketSecurity(): FAILED, expected a blocked bucket with a public policy but received '%+v'", bucket)
+	}
+	if bucket.IsPublic() {
+		t.Errorf("SetBucketSecurity(): FAILED, expected the public access block to prevent the bucket from being public")
+	}
+	if _, ok := bucket.SecurityErrors[SecurityFieldACL]; !ok || len(bucket.SecurityErrors) != 1 {
+		t.Errorf("SetBucketSecurity(): FAILED, expected a single ACL error but received '%v'", bucket.SecurityErrors)
+	}
+}
+
+func TestFormatGrantee(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-id")}
+	var tests = []struct {
+		grantee  *s3.Grantee
+		expected string
+	}{
+		{
+			grantee:  &s3.Grantee{URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+			expected: "AllUsers",
+		},
+		{
+			grantee:  &s3.Grantee{ID: aws.String("owner-id"), DisplayName: aws.String("me")},
+			expected: "owner",
+		},
+		{
+			grantee:  &s3.Grantee{ID: aws.String("other-id"), DisplayName: aws.String("someone")},
+			expected: "someone",
+		},
+	}
+
+	for _, test := range tests {
+		result := formatGrantee(test.grantee, owner)
+		if result != test.expected {
+			t.Errorf("formatGrantee(): FAILED, expected '%v' but received '%v'", test.expected, result)
+		}
+	}
+}
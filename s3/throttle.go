@@ -0,0 +1,268 @@
+package s3
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// DefaultMaxRetries is the default number of times a failed request is retried by a Throttler
+const DefaultMaxRetries = 5
+
+// DefaultRequestRates contains the maximum number of requests per second sent to a service in a region, by service name
+// The services missing from it are limited to defaultRequestRate requests per second
+var DefaultRequestRates = map[string]float64{
+	"ce":         5,
+	"monitoring": 20,
+	"s3":         200,
+	"sts":        10,
+}
+
+const (
+	// defaultRequestRate is the maximum number of requests per second sent to the services missing from DefaultRequestRates
+	defaultRequestRate = 50
+	// minRequestRateDivisor bounds how much the request rate of a throttled service is lowered, down to its maximum divided by it
+	minRequestRateDivisor = 32
+	// requestRateSteps is the number of requests succeeding in a row needed to get a throttled service back to its maximum rate from 0
+	requestRateSteps = 100
+)
+
+// throttleCodes contains the error codes of the throttled requests which the SDK does not retry as such: the SlowDown of S3, sent
+// with a 503 status code, and the LimitExceededException of the cost explorer
+var throttleCodes = map[string]bool{
+	"LimitExceededException": true,
+	"SlowDown":               true,
+}
+
+// APIStats counts the requests of an API (e.g. s3 ListObjectsV2) that were retried and the ones that were throttled
+type APIStats struct {
+	API       string
+	Retries   int
+	Throttles int
+}
+
+// Throttler limits the rate of the requests sent to AWS with a token bucket per service and region, shared by every client it is attached
+// to, and retries the failed requests with an exponential backoff and jitter. The rate of a service is halved every time it throttles a
+// request and raised back little by little as the requests succeed
+// A nil Throttler leaves the clients to the SDK's default retries. A Throttler is safe for concurrent use
+type Throttler struct {
+	// MaxRetries is the number of times a failed request is retried
+	MaxRetries int
+	// Rates contains the maximum number of requests per second sent to a service in a region, by service name
+	Rates map[string]float64
+
+	// retryDelay and throttleDelay are the delays before the first retry of a failed and of a throttled request, doubled on every retry
+	// up to maxDelay
+	maxDelay      time.Duration
+	retryDelay    time.Duration
+	throttleDelay time.Duration
+
+	limiters map[string]*rateLimiter
+	mutex    sync.Mutex
+	stats    map[string]*APIStats
+}
+
+// NewThrottler returns a Throttler retrying the failed requests up to maxRetries times, with the DefaultRequestRates
+func NewThrottler(maxRetries int) *Throttler {
+	return &Throttler{
+		MaxRetries:    maxRetries,
+		Rates:         DefaultRequestRates,
+		maxDelay:      20 * time.Second,
+		retryDelay:    50 * time.Millisecond,
+		throttleDelay: 500 * time.Millisecond,
+		limiters:      map[string]*rateLimiter{},
+		stats:         map[string]*APIStats{},
+	}
+}
+
+// Stats returns the number of retries and throttles of every API that had any, sorted by API
+func (t *Throttler) Stats() []APIStats {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := make([]APIStats, 0, len(t.stats))
+	for _, apiStats := range t.stats {
+		stats = append(stats, *apiStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].API < stats[j].API })
+	return stats
+}
+
+// attach makes the client's requests wait for the token bucket of its service and region, feeding the outcome of the requests back
+// to it, and retry as configured
+func (t *Throttler) attach(c *client.Client) {
+	if t == nil {
+		return
+	}
+	region := c.SigningRegion
+	if region == "" {
+		region = aws.StringValue(c.Config.Region)
+	}
+	limiter := t.limiter(c.ServiceName, region)
+
+	c.Retryer = &throttleRetryer{limiter: limiter, throttler: t}
+	c.Handlers.Sign.PushFrontNamed(request.NamedHandler{Name: "bucketdigger.RateLimitHandler", Fn: func(r *request.Request) {
+		if err := limiter.wait(r.Context()); err != nil {
+			r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+		}
+	}})
+	c.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: "bucketdigger.RateRecoveryHandler", Fn: func(r *request.Request) {
+		if r.Error == nil {
+			limiter.succeeded()
+		}
+	}})
+}
+
+// limiter returns the token bucket of the service in the region, creating it the first time it is requested
+func (t *Throttler) limiter(service, region string) *rateLimiter {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := service + "/" + region
+	limiter, ok := t.limiters[key]
+	if !ok {
+		rate, ok := t.Rates[service]
+		if !ok {
+			rate = defaultRequestRate
+		}
+		limiter = newRateLimiter(rate)
+		t.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// count records a failed request of the API, which is retried if retried is set
+func (t *Throttler) count(api string, retried, throttled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	apiStats, ok := t.stats[api]
+	if !ok {
+		apiStats = &APIStats{API: api}
+		t.stats[api] = apiStats
+	}
+	if retried {
+		apiStats.Retries++
+	}
+	if throttled {
+		apiStats.Throttles++
+	}
+}
+
+// retryDelayFor returns how long to wait before the retry number retryCount (starting at 0) of a request, exponentially growing and
+// jittered between half of it and itself so that the requests throttled together are not retried together
+func (t *Throttler) retryDelayFor(retryCount int, throttled bool) time.Duration {
+	delay := t.retryDelay
+	if throttled {
+		delay = t.throttleDelay
+	}
+	delay = time.Duration(math.Min(float64(delay)*math.Pow(2, float64(retryCount)), float64(t.maxDelay)))
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// throttleRetryer is the request.Retryer of the clients attached to a Throttler
+type throttleRetryer struct {
+	limiter   *rateLimiter
+	throttler *Throttler
+}
+
+// MaxRetries returns the Throttler's MaxRetries
+func (r *throttleRetryer) MaxRetries() int {
+	return r.throttler.MaxRetries
+}
+
+// ShouldRetry returns whether the failed request can be retried, lowering the rate of its service if it was throttled
+func (r *throttleRetryer) ShouldRetry(req *request.Request) bool {
+	throttled := isThrottle(req)
+	if throttled {
+		r.limiter.throttled()
+	}
+	retry := throttled || req.IsErrorRetryable()
+	r.throttler.count(req.ClientInfo.ServiceName+" "+req.Operation.Name, retry && req.RetryCount < r.MaxRetries(), throttled)
+	return retry
+}
+
+// RetryRules returns how long to wait before retrying the request, at least as long as the Retry-After header asks if any
+func (r *throttleRetryer) RetryRules(req *request.Request) time.Duration {
+	delay := r.throttler.retryDelayFor(req.RetryCount, isThrottle(req))
+	if req.HTTPResponse != nil {
+		if seconds, err := strconv.Atoi(req.HTTPResponse.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > delay {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+	return delay
+}
+
+// isThrottle returns whether the request failed because it was throttled
+func isThrottle(r *request.Request) bool {
+	if err, ok := r.Error.(awserr.Error); ok && throttleCodes[err.Code()] {
+		return true
+	}
+	return r.IsErrorThrottle()
+}
+
+// rateLimiter is a token bucket holding up to a second of requests, refilled at rate requests per second, which is lowered down to
+// maxRate/minRequestRateDivisor when the requests are throttled and raised back up to maxRate as they succeed
+type rateLimiter struct {
+	last    time.Time
+	maxRate float64
+	mutex   sync.Mutex
+	rate    float64
+	tokens  float64
+}
+
+// newRateLimiter returns a full token bucket sending up to rate requests per second
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{maxRate: rate, rate: rate, tokens: math.Max(rate, 1)}
+}
+
+// wait waits until a request can be sent, or until ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	delay := l.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	return aws.SleepWithContext(ctx, delay)
+}
+
+// reserve takes a token from the bucket at now and returns how long to wait until it is actually available
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.rate, math.Max(l.rate, 1))
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// throttled halves the rate of the requests
+func (l *rateLimiter) throttled() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate = math.Max(l.rate/2, l.maxRate/minRequestRateDivisor)
+}
+
+// succeeded raises the rate of the requests back towards its maximum
+func (l *rateLimiter) succeeded() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate = math.Min(l.rate+l.maxRate/requestRateSteps, l.maxRate)
+}
@@ -0,0 +1,259 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// throttlingService throttles the first throttled requests it receives with the response of the service, answering the next ones with
+// the response
+type throttlingService struct {
+	throttled int
+	status    int
+	headers   map[string]string
+	throttle  string
+	response  string
+
+	mutex    sync.Mutex
+	requests int
+}
+
+func (s *throttlingService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests++
+	throttled := s.requests <= s.throttled
+	s.mutex.Unlock()
+
+	if throttled {
+		for key, value := range s.headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(s.status)
+		w.Write([]byte(s.throttle))
+		return
+	}
+	w.Write([]byte(s.response))
+}
+
+// newThrottlingS3Service returns an S3 stand-in throttling the first throttled requests with a SlowDown error
+func newThrottlingS3Service(throttled int) *throttlingService {
+	return &throttlingService{
+		throttled: throttled,
+		status:    http.StatusServiceUnavailable,
+		throttle:  "<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>",
+		response:  "<ListBucketResult><Name>bucket1</Name><IsTruncated>false</IsTruncated><Contents><Key>object1</Key><Size>10</Size></Contents></ListBucketResult>",
+	}
+}
+
+// newTestThrottler returns a Throttler retrying right away, for the tests not to wait
+func newTestThrottler(maxRetries int) *Throttler {
+	throttler := NewThrottler(maxRetries)
+	throttler.retryDelay = time.Millisecond
+	throttler.throttleDelay = time.Millisecond
+	return throttler
+}
+
+// newTestSession returns a session sending its requests to the server
+func newTestSession(server *httptest.Server) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+}
+
+func TestThrottlerRetries(t *testing.T) {
+	service := newThrottlingS3Service(3)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	throttler := newTestThrottler(5)
+	client := s3.New(newTestSession(server))
+	throttler.attach(client.Client)
+
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetrics(context.Background(), client)
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetrics(): FAILED, expected the throttled requests to be retried but received '%v'", err)
+	}
+	if bucket.ObjectCount != 1 || service.requests != 4 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected 1 object after 4 requests but received '%v' after '%v'", bucket.ObjectCount, service.requests)
+	}
+
+	expected := []APIStats{{API: "s3 ListObjectsV2", Retries: 3, Throttles: 3}}
+	if stats := throttler.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats(): FAILED, expected '%+v' but received '%+v'", expected, stats)
+	}
+	if limiter := throttler.limiter("s3", "us-east-1"); limiter.rate >= DefaultRequestRates["s3"] {
+		t.Errorf("attach(): FAILED, expected the rate to be lowered after the throttles but received '%v'", limiter.rate)
+	}
+}
+
+func TestThrottlerMaxRetries(t *testing.T) {
+	service := newThrottlingS3Service(10)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	throttler := newTestThrottler(2)
+	client := s3.New(newTestSession(server))
+	throttler.attach(client.Client)
+
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetrics(context.Background(), client)
+	if err == nil {
+		t.Fatalf("SetBucketObjectsMetrics(): FAILED, expected an error once the retries ran out but received none")
+	}
+	if service.requests != 3 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected 3 requests but received '%v'", service.requests)
+	}
+
+	expected := []APIStats{{API: "s3 ListObjectsV2", Retries: 2, Throttles: 3}}
+	if stats := throttler.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats(): FAILED, expected '%+v' but received '%+v'", expected, stats)
+	}
+}
+
+func TestThrottlerCostExplorer(t *testing.T) {
+	service := &throttlingService{
+		throttled: 2,
+		status:    http.StatusBadRequest,
+		headers:   map[string]string{"Content-Type": "application/x-amz-json-1.1"},
+		throttle:  `{"__type":"LimitExceededException","Message":"Rate exceeded"}`,
+		response:  `{"ResultsByTime":[{"Groups":[{"Keys":["name$bucket1"],"Metrics":{"AmortizedCost":{"Amount":"1.5","Unit":"USD"}}}]}]}`,
+	}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	throttler := newTestThrottler(5)
+	client := costexplorer.New(newTestSession(server))
+	throttler.attach(client.Client)
+
+	// The report is fetched by the first bucket needing it, as during a scan
+	costs := &costReportLoader{fetch: func(ctx context.Context) (*CostReport, error) {
+		return GetCostReport(ctx, client, 30, "name")
+	}}
+	report, err := costs.get(context.Background())
+	if err != nil {
+		t.Fatalf("GetCostReport(): FAILED, expected the throttled requests to be retried but received '%v'", err)
+	}
+	bucket := &Bucket{Name: "bucket1"}
+	bucket.SetBucketCost(report)
+	if bucket.Cost != 1.5 || bucket.CostUnattributed || report.Requests != 1 {
+		t.Errorf("GetCostReport(): FAILED, expected a cost of 1.5 from a single query but received '%v' from '%v'", bucket.Cost, report.Requests)
+	}
+
+	expected := []APIStats{{API: "ce GetCostAndUsage", Retries: 2, Throttles: 2}}
+	if stats := throttler.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats(): FAILED, expected '%+v' but received '%+v'", expected, stats)
+	}
+}
+
+func TestThrottlerCancelled(t *testing.T) {
+	service := newThrottlingS3Service(0)
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	throttler := newTestThrottler(5)
+	throttler.Rates = map[string]float64{"s3": 1}
+	client := s3.New(newTestSession(server))
+	throttler.attach(client.Client)
+
+	// The token bucket holding a single request, the second one waits for a second unless cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	bucket := &Bucket{Name: "bucket1"}
+	err := bucket.SetBucketObjectsMetrics(ctx, client)
+	if err != nil {
+		t.Fatalf("SetBucketObjectsMetrics(): FAILED, expected no errors but received '%v'", err)
+	}
+	err = bucket.SetBucketObjectsMetrics(ctx, client)
+	if err == nil || service.requests != 1 {
+		t.Errorf("SetBucketObjectsMetrics(): FAILED, expected the waiting request to be cancelled but received '%v' after '%v' requests", err, service.requests)
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := newRateLimiter(10)
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// The bucket holds 10 requests, the next ones being spread over the following seconds
+	for i := 0; i < 10; i++ {
+		if delay := limiter.reserve(now); delay != 0 {
+			t.Fatalf("reserve(): FAILED, expected the request %v to be sent right away but received '%v'", i, delay)
+		}
+	}
+	if delay := limiter.reserve(now); delay != 100*time.Millisecond {
+		t.Errorf("reserve(): FAILED, expected a delay of 100ms but received '%v'", delay)
+	}
+	if delay := limiter.reserve(now.Add(time.Second)); delay != 0 {
+		t.Errorf("reserve(): FAILED, expected the bucket to be refilled after a second but received '%v'", delay)
+	}
+
+	limiter.throttled()
+	limiter.throttled()
+	if limiter.rate != 2.5 {
+		t.Errorf("throttled(): FAILED, expected the rate to be halved twice but received '%v'", limiter.rate)
+	}
+	for i := 0; i < 10; i++ {
+		limiter.throttled()
+	}
+	if limiter.rate != 10.0/minRequestRateDivisor {
+		t.Errorf("throttled(): FAILED, expected the rate to stop at %v but received '%v'", 10.0/minRequestRateDivisor, limiter.rate)
+	}
+	for i := 0; i < requestRateSteps; i++ {
+		limiter.succeeded()
+	}
+	if limiter.rate != 10 {
+		t.Errorf("succeeded(): FAILED, expected the rate to be back to 10 but received '%v'", limiter.rate)
+	}
+}
+
+func TestRetryDelayFor(t *testing.T) {
+	throttler := NewThrottler(DefaultMaxRetries)
+
+	var tests = []struct {
+		retryCount int
+		throttled  bool
+		min        time.Duration
+		max        time.Duration
+	}{
+		{
+			retryCount: 0,
+			throttled:  false,
+			min:        25 * time.Millisecond,
+			max:        50 * time.Millisecond,
+		},
+		{
+			retryCount: 2,
+			throttled:  true,
+			min:        time.Second,
+			max:        2 * time.Second,
+		},
+		{
+			retryCount: 20,
+			throttled:  true,
+			min:        10 * time.Second,
+			max:        20 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if delay := throttler.retryDelayFor(test.retryCount, test.throttled); delay < test.min || delay > test.max {
+				t.Fatalf("retryDelayFor(): FAILED, expected a delay between %v and %v for the retry %v but received '%v'", test.min, test.max, test.retryCount, delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,703 @@
+package s3
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// wherePhase is the step of a bucket's scan after which a field's value is known
+// The phases are ordered the same way as the scan's steps
+type wherePhase int
+
+const (
+	phaseList wherePhase = iota
+	phaseRegion
+	phaseSecurity
+	phaseConfiguration
+	phaseMultipart
+	phaseObjects
+	phaseVersions
+	phaseCost
+)
+
+// whereType is the type of a value in a where expression
+type whereType int
+
+const (
+	typeBool whereType = iota
+	typeNumber
+	typeString
+	typeTime
+	typeDuration
+)
+
+// String returns the name of the type used in the error messages
+func (t whereType) String() string {
+	return [...]string{"boolean", "number", "string", "time", "duration"}[t]
+}
+
+// whereField is a bucket field that can be used in a where expression
+// Its value is nil when unknown, e.g. the cost could not be fetched, a comparison with an unknown value being unknown and never matching
+type whereField struct {
+	typ   whereType
+	phase wherePhase
+	value func(b *Bucket) interface{}
+}
+
+// whereFields contains the bucket fields that can be used in a where expression
+var whereFields = map[string]whereField{
+	"account": {typeString, phaseList, func(b *Bucket) interface{} { return optionalString(b.Account) }},
+	"created": {typeTime, phaseList, func(b *Bucket) interface{} { return optionalTime(b.CreationDate) }},
+	"name":    {typeString, phaseList, func(b *Bucket) interface{} { return b.Name }},
+	"profile": {typeString, phaseList, func(b *Bucket) interface{} { return b.Profile }},
+	"region":  {typeString, phaseRegion, func(b *Bucket) interface{} { return b.Region }},
+	"encryption": {typeString, phaseSecurity, func(b *Bucket) interface{} {
+		if _, failed := b.SecurityErrors[SecurityFieldEncryption]; failed {
+			return nil
+		}
+		return b.Encryption
+	}},
+	"public": {typeBool, phaseSecurity, func(b *Bucket) interface{} {
+		if b.IsPublicUnknown() {
+			return nil
+		}
+		return b.IsPublic()
+	}},
+	"lifecyclerules": {typeNumber, phaseConfiguration, func(b *Bucket) interface{} {
+		if _, failed := b.ConfigurationErrors[ConfigurationFieldLifecycle]; failed {
+			return nil
+		}
+		return float64(b.LifecycleRuleCount)
+	}},
+	"replicated": {typeBool, phaseConfiguration, func(b *Bucket) interface{} {
+		if _, failed := b.ConfigurationErrors[ConfigurationFieldReplication]; failed {
+			return nil
+		}
+		return len(b.ReplicationDestinations) > 0
+	}},
+	"uploads":    {typeNumber, phaseMultipart, func(b *Bucket) interface{} { return float64(b.IncompleteUploadCount) }},
+	"uploadsize": {typeNumber, phaseMultipart, func(b *Bucket) interface{} { return float64(b.IncompleteUploadSizeBytes) }},
+	"files": {typeNumber, phaseObjects, func(b *Bucket) interface{} {
+		if b.Incomplete {
+			return nil
+		}
+		return float64(b.ObjectCount)
+	}},
+	"modified": {typeTime, phaseObjects, func(b *Bucket) interface{} { return optionalTime(b.LastModified) }},
+	"size": {typeNumber, phaseObjects, func(b *Bucket) interface{} {
+		if b.Incomplete {
+			return nil
+		}
+		return float64(b.SizeBytes)
+	}},
+	"deletemarkers":   {typeNumber, phaseVersions, func(b *Bucket) interface{} { return float64(b.DeleteMarkerCount) }},
+	"noncurrentfiles": {typeNumber, phaseVersions, func(b *Bucket) interface{} { return float64(b.NoncurrentObjectCount) }},
+	"noncurrentsize":  {typeNumber, phaseVersions, func(b *Bucket) interface{} { return float64(b.NoncurrentSizeBytes) }},
+	"cost": {typeNumber, phaseCost, func(b *Bucket) interface{} {
+		if b.Cost < 0 || b.CostUnattributed {
+			return nil
+		}
+		return b.Cost
+	}},
+}
+
+// whereSizeUnits contains the power of 1000 of the size literals' units, e.g. 500GB
+var whereSizeUnits = map[string]float64{
+	"b":  math.Pow(1000, 0),
+	"kb": math.Pow(1000, 1),
+	"mb": math.Pow(1000, 2),
+	"gb": math.Pow(1000, 3),
+	"tb": math.Pow(1000, 4),
+	"pb": math.Pow(1000, 5),
+	"eb": math.Pow(1000, 6),
+}
+
+// whereDurationUnits contains the duration of the duration literals' units, e.g. 90d
+var whereDurationUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// Where is a parsed and type-checked where expression, e.g. 'region == "eu-west-1" && size > 500GB'
+// Its top-level conditions (the operands of the top-level '&&') are evaluated separately, as soon as the fields they use are known
+type Where struct {
+	conditions []whereNode
+	// phases contains the phases of every field used in the expression
+	phases map[wherePhase]bool
+}
+
+// ParseWhere parses and type-checks a where expression
+func ParseWhere(expr string) (*Where, error) {
+	tokens, err := lexWhere(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &whereParser{tokens: tokens, phases: map[wherePhase]bool{}}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%v' at position %v", token.text, token.pos)
+	}
+	if node.valueType() != typeBool {
+		return nil, fmt.Errorf("the expression must be a condition (e.g. size > 1GB), not a %v", node.valueType())
+	}
+
+	w := &Where{phases: p.phases}
+	w.addConditions(node)
+	return w, nil
+}
+
+// addConditions splits the top-level '&&' into separate conditions
+func (w *Where) addConditions(node whereNode) {
+	if and, ok := node.(*logicalNode); ok && and.op == "&&" {
+		w.addConditions(and.left)
+		w.addConditions(and.right)
+		return
+	}
+	w.conditions = append(w.conditions, node)
+}
+
+// WhereFieldUnknown returns whether the bucket's value of the where field is unknown, a comparison using it never matching
+// It returns false for a name that is not a where field
+func WhereFieldUnknown(b *Bucket, name string) bool {
+	field, ok := whereFields[name]
+	return ok && field.value(b) == nil
+}
+
+// needs returns true if the expression uses a field only known after the phase, which must then be run
+func (w *Where) needs(phase wherePhase) bool {
+	return w != nil && w.phases[phase]
+}
+
+// match returns false if the bucket does not match one of the conditions known after the provided phases, an unknown condition
+// not matching
+func (w *Where) match(b *Bucket, phases ...wherePhase) bool {
+	if w == nil {
+		return true
+	}
+	for _, condition := range w.conditions {
+		for _, phase := range phases {
+			if condition.phase() == phase && condition.eval(b) != true {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// whereNode is a node of a parsed where expression
+type whereNode interface {
+	valueType() whereType
+	phase() wherePhase
+	// eval returns the node's value for the bucket, nil if it is unknown
+	eval(b *Bucket) interface{}
+}
+
+// literalNode is a constant value, e.g. "eu-west-1", 500GB or 90d
+type literalNode struct {
+	typ   whereType
+	value interface{}
+}
+
+func (n *literalNode) valueType() whereType     { return n.typ }
+func (n *literalNode) phase() wherePhase        { return phaseList }
+func (n *literalNode) eval(*Bucket) interface{} { return n.value }
+
+// fieldNode is the value of a bucket's field, e.g. size
+type fieldNode struct {
+	field whereField
+}
+
+func (n *fieldNode) valueType() whereType       { return n.field.typ }
+func (n *fieldNode) phase() wherePhase          { return n.field.phase }
+func (n *fieldNode) eval(b *Bucket) interface{} { return n.field.value(b) }
+
+// storageClassFunctions contains, for every storage class function, the value it returns for a storage class
+// storageclass("GLACIER") is the share, in percent, of the objects in the class, storageclasssize("GLACIER") the share of
+// the bytes and storageclassbytes("GLACIER") the bytes stored in the class
+var storageClassFunctions = map[string]func(b *Bucket, class string) float64{
+	"storageclass":      func(b *Bucket, class string) float64 { return b.StorageClassesStats[class] },
+	"storageclassbytes": func(b *Bucket, class string) float64 { return float64(b.StorageClassesBytes[class]) },
+	"storageclasssize":  func(b *Bucket, class string) float64 { return b.StorageClassesSizeStats[class] },
+}
+
+// storageClassNode is a storage class function applied to a storage class, e.g. storageclass("GLACIER")
+type storageClassNode struct {
+	class    string
+	function string
+}
+
+func (n *storageClassNode) valueType() whereType { return typeNumber }
+func (n *storageClassNode) phase() wherePhase    { return phaseObjects }
+func (n *storageClassNode) eval(b *Bucket) interface{} {
+	return storageClassFunctions[n.function](b, strings.ToUpper(n.class))
+}
+
+// notNode negates a condition, the negation of an unknown condition being unknown
+type notNode struct {
+	operand whereNode
+}
+
+func (n *notNode) valueType() whereType { return typeBool }
+func (n *notNode) phase() wherePhase    { return n.operand.phase() }
+func (n *notNode) eval(b *Bucket) interface{} {
+	operand := n.operand.eval(b)
+	if operand == nil {
+		return nil
+	}
+	return operand != true
+}
+
+// logicalNode combines two conditions with '&&' or '||'
+// An unknown condition is unknown unless the other one decides the result, e.g. false && unknown is false and true || unknown is true
+type logicalNode struct {
+	op          string
+	left, right whereNode
+}
+
+func (n *logicalNode) valueType() whereType { return typeBool }
+func (n *logicalNode) phase() wherePhase    { return maxPhase(n.left, n.right) }
+func (n *logicalNode) eval(b *Bucket) interface{} {
+	// decisive is the value deciding the result whatever the other condition, false for '&&' and true for '||'
+	decisive := n.op == "||"
+	left, right := n.left.eval(b), n.right.eval(b)
+	if left == decisive || right == decisive {
+		return decisive
+	}
+	if left == nil || right == nil {
+		return nil
+	}
+	return !decisive
+}
+
+// compareNode compares two values, a time compared with a duration being compared using its age
+// A comparison with an unknown value is unknown, which never matches, even when negated
+type compareNode struct {
+	op          string
+	left, right whereNode
+	regex       *regexp.Regexp
+}
+
+func (n *compareNode) valueType() whereType { return typeBool }
+func (n *compareNode) phase() wherePhase    { return maxPhase(n.left, n.right) }
+func (n *compareNode) eval(b *Bucket) interface{} {
+	left, right := n.left.eval(b), n.right.eval(b)
+	if left == nil || right == nil {
+		return nil
+	}
+	if n.regex != nil {
+		return n.regex.MatchString(left.(string)) == (n.op == "=~")
+	}
+
+	// Compare the age of a time with a duration
+	if t, ok := left.(time.Time); ok && n.right.valueType() == typeDuration {
+		left = time.Since(t)
+	}
+	if t, ok := right.(time.Time); ok && n.left.valueType() == typeDuration {
+		right = time.Since(t)
+	}
+
+	var c int
+	switch l := left.(type) {
+	case bool:
+		if l != right.(bool) {
+			c = 1
+		}
+	case string:
+		c = strings.Compare(l, right.(string))
+	case float64:
+		c = compareFloats(l, right.(float64))
+	case time.Duration:
+		c = compareFloats(float64(l), float64(right.(time.Duration)))
+	case time.Time:
+		c = compareFloats(float64(l.UnixNano()), float64(right.(time.Time).UnixNano()))
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// whereTokenKind is the kind of a where expression's token
+type whereTokenKind int
+
+const (
+	tokenEOF whereTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+// whereToken is a token of a where expression, pos being its position (starting at 1) in the expression
+type whereToken struct {
+	kind whereTokenKind
+	text string
+	pos  int
+}
+
+// whereOperators contains the operators and punctuation of the where expressions, the longest ones first
+var whereOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", ","}
+
+// lexWhere splits a where expression into tokens
+func lexWhere(expr string) ([]whereToken, error) {
+	var tokens []whereToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, whereToken{tokenIdent, string(runes[start:i]), start + 1})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '%') {
+				i++
+			}
+			tokens = append(tokens, whereToken{tokenNumber, string(runes[start:i]), start + 1})
+		case r == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %v", start+1)
+			}
+			i++
+			tokens = append(tokens, whereToken{tokenString, string(runes[start:i]), start + 1})
+		default:
+			operator := ""
+			for _, op := range whereOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at position %v", r, start+1)
+			}
+			i += len([]rune(operator))
+			tokens = append(tokens, whereToken{tokenOperator, operator, start + 1})
+		}
+	}
+
+	return append(tokens, whereToken{tokenEOF, "end of expression", len(runes) + 1}), nil
+}
+
+// whereParser is a recursive descent parser of where expressions, type-checking the nodes as it builds them
+// The operators' precedence, from the lowest: '||', '&&', '!', the comparisons
+type whereParser struct {
+	tokens []whereToken
+	i      int
+	phases map[wherePhase]bool
+}
+
+// peek returns the current token without consuming it
+func (p *whereParser) peek() whereToken {
+	return p.tokens[p.i]
+}
+
+// next consumes the current token
+func (p *whereParser) next() whereToken {
+	token := p.tokens[p.i]
+	if token.kind != tokenEOF {
+		p.i++
+	}
+	return token
+}
+
+// expect consumes the current token, returning an error if it is not the provided operator
+func (p *whereParser) expect(operator string) error {
+	if token := p.next(); token.kind != tokenOperator || token.text != operator {
+		return fmt.Errorf("expected '%v' at position %v but found '%v'", operator, token.pos, token.text)
+	}
+	return nil
+}
+
+// isOperator returns true if the current token is one of the provided operators
+func (p *whereParser) isOperator(operators ...string) bool {
+	token := p.peek()
+	if token.kind != tokenOperator {
+		return false
+	}
+	for _, operator := range operators {
+		if token.text == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+// parseLogical parses the operands, parsed with parseOperand, joined by the logical operator
+func (p *whereParser) parseLogical(op string, parseOperand func() (whereNode, error)) (whereNode, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(op) {
+		token := p.next()
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if left.valueType() != typeBool || right.valueType() != typeBool {
+			return nil, fmt.Errorf("'%v' at position %v expects a condition on both sides, found a %v and a %v", op, token.pos, left.valueType(), right.valueType())
+		}
+		left = &logicalNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseNot() (whereNode, error) {
+	if !p.isOperator("!") {
+		return p.parseComparison()
+	}
+	token := p.next()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.valueType() != typeBool {
+		return nil, fmt.Errorf("'!' at position %v expects a condition, found a %v", token.pos, operand.valueType())
+	}
+	return &notNode{operand: operand}, nil
+}
+
+func (p *whereParser) parseComparison() (whereNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("==", "!=", "<", "<=", ">", ">=", "=~", "!~") {
+		return left, nil
+	}
+	token := p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return checkComparison(token, left, right)
+}
+
+// checkComparison returns the comparison of the two values, after checking they can be compared using the operator
+func checkComparison(token whereToken, left, right whereNode) (whereNode, error) {
+	op := token.text
+	node := &compareNode{op: op, left: left, right: right}
+	invalid := fmt.Errorf("cannot compare a %v with a %v using '%v' at position %v", left.valueType(), right.valueType(), op, token.pos)
+
+	// A time can be compared with a date, written as a string literal
+	if left.valueType() == typeTime && right.valueType() == typeString {
+		date, err := parseWhereDate(right)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date at position %v: %v", token.pos, err)
+		}
+		node.right = date
+	}
+	if right.valueType() == typeTime && left.valueType() == typeString {
+		date, err := parseWhereDate(left)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date at position %v: %v", token.pos, err)
+		}
+		node.left = date
+	}
+	leftType, rightType := node.left.valueType(), node.right.valueType()
+
+	switch {
+	case op == "=~" || op == "!~":
+		literal, ok := right.(*literalNode)
+		if leftType != typeString || !ok || literal.typ != typeString {
+			return nil, fmt.Errorf("'%v' at position %v expects a string on its left and a regex string on its right", op, token.pos)
+		}
+		regex, err := regexp.Compile(literal.value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at position %v: %v", token.pos, err)
+		}
+		node.regex = regex
+	case leftType == typeTime && rightType == typeDuration, leftType == typeDuration && rightType == typeTime:
+		if op == "==" || op == "!=" {
+			return nil, fmt.Errorf("the age of a time can only be compared using '<', '<=', '>' or '>=' at position %v", token.pos)
+		}
+	case leftType != rightType:
+		return nil, invalid
+	case leftType == typeBool && op != "==" && op != "!=":
+		return nil, invalid
+	}
+
+	return node, nil
+}
+
+// parseWhereDate converts a string literal into a time literal, the date being formatted as 2006-01-02 or RFC 3339
+func parseWhereDate(node whereNode) (whereNode, error) {
+	literal, ok := node.(*literalNode)
+	if !ok {
+		return nil, fmt.Errorf("a time can only be compared with a date literal")
+	}
+	value := literal.value.(string)
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not formatted as 2006-01-02 or 2006-01-02T15:04:05Z07:00", value)
+	}
+	return &literalNode{typ: typeTime, value: date}, nil
+}
+
+func (p *whereParser) parsePrimary() (whereNode, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenNumber:
+		return parseWhereNumber(token)
+	case tokenString:
+		value, err := strconv.Unquote(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %v at position %v", token.text, token.pos)
+		}
+		return &literalNode{typ: typeString, value: value}, nil
+	case tokenIdent:
+		name := strings.ToLower(token.text)
+		switch {
+		case name == "true" || name == "false":
+			return &literalNode{typ: typeBool, value: name == "true"}, nil
+		case storageClassFunctions[name] != nil:
+			p.phases[phaseObjects] = true
+			return p.parseStorageClass(name)
+		}
+		field, ok := whereFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%v' at position %v, valid fields: %v, storageclass(\"CLASS\"), storageclassbytes(\"CLASS\"), storageclasssize(\"CLASS\")", token.text, token.pos, strings.Join(whereFieldNames(), ", "))
+		}
+		p.phases[field.phase] = true
+		return &fieldNode{field: field}, nil
+	case tokenOperator:
+		if token.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%v' at position %v", token.text, token.pos)
+}
+
+// parseStorageClass parses the argument of a storage class function, a storage class name string
+func (p *whereParser) parseStorageClass(function string) (whereNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	token := p.next()
+	class, err := strconv.Unquote(token.text)
+	if token.kind != tokenString || err != nil {
+		return nil, fmt.Errorf("%v() expects a storage class name string at position %v, e.g. %v(\"GLACIER\")", function, token.pos, function)
+	}
+	return &storageClassNode{class: class, function: function}, p.expect(")")
+}
+
+// parseWhereNumber parses a number literal along with its unit, if any: a size (e.g. 500GB), a duration (e.g. 90d) or a percentage (e.g. 20%)
+func parseWhereNumber(token whereToken) (whereNode, error) {
+	end := strings.IndexFunc(token.text, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if end < 0 {
+		end = len(token.text)
+	}
+	value, err := strconv.ParseFloat(token.text[:end], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number '%v' at position %v", token.text, token.pos)
+	}
+
+	unit := strings.ToLower(token.text[end:])
+	if unit == "" || unit == "%" {
+		return &literalNode{typ: typeNumber, value: value}, nil
+	}
+	if size, ok := whereSizeUnits[unit]; ok {
+		return &literalNode{typ: typeNumber, value: value * size}, nil
+	}
+	if duration, ok := whereDurationUnits[unit]; ok {
+		return &literalNode{typ: typeDuration, value: time.Duration(value * float64(duration))}, nil
+	}
+	return nil, fmt.Errorf("invalid unit '%v' in '%v' at position %v, valid units: b, kb, mb, gb, tb, pb, eb, h, d, w, %%", token.text[end:], token.text, token.pos)
+}
+
+// whereFieldNames returns the sorted names of the fields that can be used in a where expression
+func whereFieldNames() []string {
+	names := make([]string, 0, len(whereFields))
+	for name := range whereFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxPhase returns the latest phase of the two nodes
+func maxPhase(left, right whereNode) wherePhase {
+	if left.phase() > right.phase() {
+		return left.phase()
+	}
+	return right.phase()
+}
+
+// compareFloats returns -1, 0 or 1 depending on a being lower, equal or greater than b
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// optionalString returns nil for an empty string
+func optionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// optionalTime returns nil for a zero time
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhereErrors(t *testing.T) {
+	var tests = []struct {
+		expr     string
+		expected string
+	}{
+		{expr: `sise > 1GB`, expected: "unknown field 'sise' at position 1"},
+		{expr: `size > "big"`, expected: "cannot compare a number with a string using '>' at position 6"},
+		{expr: `size > 10XB`, expected: "invalid unit 'XB' in '10XB' at position 8"},
+		{expr: `size`, expected: "the expression must be a condition"},
+		{expr: `region == "eu-west-1" &&`, expected: "unexpected 'end of expression' at position 25"},
+		{expr: `(size > 1GB`, expected: "expected ')' at position 12"},
+		{expr: `name == "unterminated`, expected: "unterminated string at position 9"},
+		{expr: `name =~ "("`, expected: "invalid regex at position 6"},
+		{expr: `name =~ region`, expected: "expects a string on its left and a regex string on its right"},
+		{expr: `modified == 90d`, expected: "the age of a time can only be compared using"},
+		{expr: `created < "yesterday"`, expected: "invalid date at position 9"},
+		{expr: `public > false`, expected: "cannot compare a boolean with a boolean using '>'"},
+		{expr: `size > 1GB || 2`, expected: "'||' at position 12 expects a condition on both sides"},
+		{expr: `storageclass(GLACIER) > 20%`, expected: "storageclass() expects a storage class name string at position 14"},
+		{expr: `storageclassbytes() > 1TB`, expected: "storageclassbytes() expects a storage class name string at position 19"},
+		{expr: `size > 1GB ; files > 1`, expected: "unexpected character ';' at position 12"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseWhere(test.expr)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("ParseWhere(): FAILED, Expected error '%v' for '%v' - Received '%v'", test.expected, test.expr, err)
+		}
+	}
+}
+
+func TestWhereMatch(t *testing.T) {
+	bucket := &Bucket{
+		Account:                 "123456789012",
+		Cost:                    -1,
+		CreationDate:            time.Now().Add(-400 * 24 * time.Hour),
+		LastModified:            time.Now().Add(-100 * 24 * time.Hour),
+		Name:                    "my-bucket",
+		ObjectCount:             10,
+		Region:                  "eu-west-1",
+		SecurityErrors:          map[string]string{SecurityFieldACL: "access denied"},
+		SizeBytes:               600 * 1000 * 1000 * 1000,
+		StorageClassesBytes:     map[string]int64{"GLACIER": 540 * 1000 * 1000 * 1000, "STANDARD": 60 * 1000 * 1000 * 1000},
+		StorageClassesSizeStats: map[string]float64{"GLACIER": 90, "STANDARD": 10},
+		StorageClassesStats:     map[string]float64{"GLACIER": 30, "STANDARD": 70},
+	}
+
+	var tests = []struct {
+		expr     string
+		expected bool
+	}{
+		{expr: `region == "eu-west-1" && size > 500GB && modified > 90d && storageclass("GLACIER") > 20%`, expected: true},
+		{expr: `region == "eu-west-1" && modified < 90d`, expected: false},
+		{expr: `REGION != "eu-west-1" || (files >= 10 && name =~ "^my-")`, expected: true},
+		{expr: `!(name !~ "bucket$")`, expected: true},
+		{expr: `created < "2000-01-01" || created > 1w`, expected: true},
+		{expr: `storageclass("deep_archive") == 0 && account == "123456789012"`, expected: true},
+		{expr: `encryption == "" && !(encryption != "")`, expected: true},
+		{expr: `public == false || public == true`, expected: false},
+		{expr: `storageclasssize("GLACIER") > 80% && storageclassbytes("glacier") > 500GB`, expected: true},
+		{expr: `storageclassbytes("STANDARD") > 100GB`, expected: false},
+		{expr: `1.5TB > size && 5 < files`, expected: true},
+		// A comparison with an unknown value, the cost here, is false
+		{expr: `cost >= 0`, expected: false},
+		{expr: `cost < 10`, expected: false},
+		// Negating it, or combining it with a condition not deciding the result, is unknown too
+		{expr: `!(cost > 5)`, expected: false},
+		{expr: `!(cost > 5) && files == 10`, expected: false},
+		{expr: `!(cost > 5) || files == 10`, expected: true},
+		{expr: `!(cost > 5 && files == 0)`, expected: true},
+	}
+
+	for _, test := range tests {
+		where, err := ParseWhere(test.expr)
+		if err != nil {
+			t.Errorf("ParseWhere(): FAILED, Unexpected error '%v' for '%v'", err, test.expr)
+			continue
+		}
+		result := where.match(bucket, phaseList, phaseRegion, phaseSecurity, phaseConfiguration, phaseMultipart, phaseObjects, phaseVersions, phaseCost)
+		if result != test.expected {
+			t.Errorf("match(): FAILED, Expected '%v' for '%v' - Received '%v'", test.expected, test.expr, result)
+		}
+	}
+}
+
+func TestWherePhases(t *testing.T) {
+	where, err := ParseWhere(`name =~ "^logs" && region == "eu-west-1" && (public || noncurrentsize > 0)`)
+	if err != nil {
+		t.Fatalf("ParseWhere(): FAILED, Unexpected error '%v'", err)
+	}
+
+	// Every top-level condition is evaluated at the phase of its latest field
+	if len(where.conditions) != 3 {
+		t.Fatalf("ParseWhere(): FAILED, Expected 3 conditions - Received %v", len(where.conditions))
+	}
+	for i, expected := range []wherePhase{phaseList, phaseRegion, phaseVersions} {
+		if phase := where.conditions[i].phase(); phase != expected {
+			t.Errorf("phase(): FAILED, Expected '%v' for condition %v - Received '%v'", expected, i, phase)
+		}
+	}
+
+	// Every phase used by a field must be run, even if its condition is evaluated later
+	for phase, expected := range map[wherePhase]bool{phaseSecurity: true, phaseVersions: true, phaseConfiguration: false, phaseObjects: false} {
+		if result := where.needs(phase); result != expected {
+			t.Errorf("needs(): FAILED, Expected '%v' for phase '%v' - Received '%v'", expected, phase, result)
+		}
+	}
+
+	// A bucket not matching the name condition is rejected before its region is known
+	if where.match(&Bucket{Name: "data"}, phaseList) {
+		t.Errorf("match(): FAILED, Expected bucket 'data' to be rejected at the list phase")
+	}
+	if !where.match(&Bucket{Name: "logs"}, phaseList) {
+		t.Errorf("match(): FAILED, Expected bucket 'logs' to be kept at the list phase")
+	}
+
+	// A nil expression matches every bucket and needs nothing
+	var none *Where
+	if !none.match(&Bucket{}, phaseList) || none.needs(phaseSecurity) {
+		t.Errorf("match(): FAILED, Expected a nil expression to match every bucket")
+	}
+}
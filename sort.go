@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+// bucketComparators contains, for every field of validSortFlags, the function comparing two buckets on that field
+// A comparator returns a negative number if a comes before b in ascending order, a positive number if it comes after and 0 on a tie
+var bucketComparators = map[string]func(a, b *s3.Bucket) int{
+	"name":            func(a, b *s3.Bucket) int { return strings.Compare(a.Name, b.Name) },
+	"region":          func(a, b *s3.Bucket) int { return strings.Compare(a.Region, b.Region) },
+	"size":            func(a, b *s3.Bucket) int { return compareInt64(a.SizeBytes, b.SizeBytes) },
+	"files":           func(a, b *s3.Bucket) int { return compareInt(a.ObjectCount, b.ObjectCount) },
+	"created":         func(a, b *s3.Bucket) int { return compareTime(a.CreationDate, b.CreationDate) },
+	"modified":        func(a, b *s3.Bucket) int { return compareTime(a.LastModified, b.LastModified) },
+	"cost":            func(a, b *s3.Bucket) int { return compareFloat64(a.Cost, b.Cost) },
+	"noncurrentsize":  func(a, b *s3.Bucket) int { return compareInt64(a.NoncurrentSizeBytes, b.NoncurrentSizeBytes) },
+	"noncurrentfiles": func(a, b *s3.Bucket) int { return compareInt(a.NoncurrentObjectCount, b.NoncurrentObjectCount) },
+	"deletemarkers":   func(a, b *s3.Bucket) int { return compareInt(a.DeleteMarkerCount, b.DeleteMarkerCount) },
+	"encryption":      func(a, b *s3.Bucket) int { return strings.Compare(a.Encryption, b.Encryption) },
+	"public":          func(a, b *s3.Bucket) int { return compareBool(a.IsPublic(), b.IsPublic()) },
+	"account":         func(a, b *s3.Bucket) int { return strings.Compare(a.Account, b.Account) },
+	"profile":         func(a, b *s3.Bucket) int { return strings.Compare(a.Profile, b.Profile) },
+}
+
+// unknownSortValues contains, for the sort fields whose value can be unknown, the function returning whether a bucket's value is unknown
+// The buckets whose value is unknown are sorted last whatever the direction, the same way they never match a '-where' comparison
+var unknownSortValues = map[string]func(b *s3.Bucket) bool{
+	"account":  func(b *s3.Bucket) bool { return b.Account == "" },
+	"created":  func(b *s3.Bucket) bool { return b.CreationDate.IsZero() },
+	"size":     func(b *s3.Bucket) bool { return b.Incomplete },
+	"files":    func(b *s3.Bucket) bool { return b.Incomplete },
+	"modified": func(b *s3.Bucket) bool { return b.LastModified.IsZero() },
+	"cost":     func(b *s3.Bucket) bool { return b.Cost < 0 || b.CostUnattributed },
+	"encryption": func(b *s3.Bucket) bool {
+		_, failed := b.SecurityErrors[s3.SecurityFieldEncryption]
+		return failed
+	},
+	"public": func(b *s3.Bucket) bool { return b.IsPublicUnknown() },
+}
+
+// sortFetches contains the information the sort fields need to be fetched, the other fields being always known
+var sortFetches = map[string]fetchGroup{
+	"size":                     fetchObjects,
+	"files":                    fetchObjects,
+	"modified":                 fetchObjects,
+	"cost":                     fetchCost,
+	"noncurrentsize":           fetchVersions,
+	"noncurrentfiles":          fetchVersions,
+	"deletemarkers":            fetchVersions,
+	"encryption":               fetchSecurity,
+	"public":                   fetchSecurity,
+	storageClassBytesSortField: fetchObjects,
+}
+
+// storageClassBytesSortField sorts the buckets by the bytes stored in a storage class, passed as 'storageclassbytes:CLASS' (e.g. storageclassbytes:GLACIER)
+const storageClassBytesSortField = "storageclassbytes"
+
+// tieBreakers are the fields used, ascending, to order the buckets that are equal on every requested sort key
+// A bucket's name being unique within an account, the order does not depend on the order the buckets were scanned in
+var tieBreakers = []sortKey{{field: "name"}, {field: "account"}, {field: "profile"}}
+
+// sortKey is a field to sort the buckets by, along with its direction
+// class is the storage class of the storageClassBytesSortField field
+type sortKey struct {
+	class      string
+	field      string
+	descending bool
+}
+
+// comparator returns the function comparing two buckets on the key's field
+func (k sortKey) comparator() func(a, b *s3.Bucket) int {
+	if k.field == storageClassBytesSortField {
+		return func(a, b *s3.Bucket) int {
+			return compareInt64(a.StorageClassesBytes[k.class], b.StorageClassesBytes[k.class])
+		}
+	}
+	return bucketComparators[k.field]
+}
+
+// parseSortFlag parses a comma separated list of sort fields, each field being prefixed with '-' to sort it in descending order (e.g. 'region,-cost')
+func parseSortFlag(sortFlag string) ([]sortKey, error) {
+	var keys []sortKey
+	seen := map[string]bool{}
+	for _, field := range strings.Split(sortFlag, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		key := sortKey{field: strings.TrimPrefix(field, "-"), descending: strings.HasPrefix(field, "-")}
+		name := key.field
+		if strings.HasPrefix(key.field, storageClassBytesSortField+":") {
+			key.class = strings.ToUpper(strings.TrimPrefix(key.field, storageClassBytesSortField+":"))
+			key.field = storageClassBytesSortField
+			if key.class == "" {
+				return nil, fmt.Errorf("Error - the '%v' sort field expects a storage class, e.g. %v:GLACIER", key.field, key.field)
+			}
+		} else if err := validateSortFlag(key.field); err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Error - the '%v' field is used more than once in '-sort'", name)
+		}
+		seen[name] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortBuckets sorts the buckets by the provided keys, the first key being the most significant one
+// The buckets whose value of a key is unknown come after the others, and tie with each other on that key
+// The ties are broken using the tieBreakers so that the order is deterministic
+func sortBuckets(buckets []*s3.Bucket, keys []sortKey) {
+	keys = append(keys[:len(keys):len(keys)], tieBreakers...)
+	sort.SliceStable(buckets, func(i, j int) bool {
+		for _, key := range keys {
+			if unknown, ok := unknownSortValues[key.field]; ok {
+				unknownI, unknownJ := unknown(buckets[i]), unknown(buckets[j])
+				if unknownI != unknownJ {
+					return unknownJ
+				}
+				if unknownI {
+					continue
+				}
+			}
+			c := key.comparator()(buckets[i], buckets[j])
+			if key.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// compareInt64 returns -1, 0 or 1 depending on a being lower, equal or greater than b
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareInt returns -1, 0 or 1 depending on a being lower, equal or greater than b
+func compareInt(a, b int) int {
+	return compareInt64(int64(a), int64(b))
+}
+
+// compareFloat64 returns -1, 0 or 1 depending on a being lower, equal or greater than b
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareTime returns -1, 0 or 1 depending on a being before, equal or after b
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareBool returns -1, 0 or 1 depending on a being false and b true, both being equal or a being true and b false
+func compareBool(a, b bool) int {
+	switch {
+	case !a && b:
+		return -1
+	case a && !b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
+
+func TestParseSortFlag(t *testing.T) {
+	var tests = []struct {
+		sortFlag string
+		expected []sortKey
+		err      bool
+	}{
+		{
+			sortFlag: "region,-cost,name",
+			expected: []sortKey{{field: "region"}, {field: "cost", descending: true}, {field: "name"}},
+			err:      false,
+		},
+		{
+			sortFlag: " -Size ",
+			expected: []sortKey{{field: "size", descending: true}},
+			err:      false,
+		},
+		{
+			sortFlag: "region,-colour",
+			expected: nil,
+			err:      true,
+		},
+		{
+			sortFlag: "cost,-cost",
+			expected: nil,
+			err:      true,
+		},
+		{
+			sortFlag: "region,",
+			expected: nil,
+			err:      true,
+		},
+		{
+			sortFlag: "-storageclassbytes:glacier,storageclassbytes:STANDARD",
+			expected: []sortKey{{class: "GLACIER", field: "storageclassbytes", descending: true}, {class: "STANDARD", field: "storageclassbytes"}},
+			err:      false,
+		},
+		{
+			sortFlag: "storageclassbytes:",
+			expected: nil,
+			err:      true,
+		},
+		{
+			sortFlag: "storageclassbytes",
+			expected: nil,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := parseSortFlag(test.sortFlag)
+		if err != nil && test.err == false {
+			t.Errorf("parseSortFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("parseSortFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseSortFlag(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestSortBuckets(t *testing.T) {
+	buckets := []*s3.Bucket{
+		{Name: "d", Region: "us-east-1", Cost: 5},
+		{Name: "c", Region: "eu-west-1", Cost: 1},
+		{Name: "b", Region: "eu-west-1", Cost: 10, Account: "222222222222"},
+		{Name: "b", Region: "eu-west-1", Cost: 10, Account: "111111111111"},
+		{Name: "a", Region: "us-east-1", Cost: 5},
+	}
+
+	// The buckets are grouped by region, then sorted by descending cost, the ties being broken by name and account
+	sortBuckets(buckets, []sortKey{{field: "region"}, {field: "cost", descending: true}})
+	expected := []string{"b/111111111111", "b/222222222222", "c/", "a/", "d/"}
+	var result []string
+	for _, bucket := range buckets {
+		result = append(result, bucket.Name+"/"+bucket.Account)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("sortBuckets(): FAILED, Expected '%v' - Received '%v'", expected, result)
+	}
+}
+
+func TestSortBucketsUnknownCost(t *testing.T) {
+	var tests = []struct {
+		keys     []sortKey
+		expected []string
+	}{
+		{
+			keys:     []sortKey{{field: "cost"}},
+			expected: []string{"e", "b", "a", "c", "d"},
+		},
+		{
+			keys:     []sortKey{{field: "cost", descending: true}},
+			expected: []string{"a", "b", "e", "c", "d"},
+		},
+	}
+
+	for _, test := range tests {
+		// The costs that could not be fetched or that are unattributed come last, whatever the direction
+		buckets := []*s3.Bucket{
+			{Name: "d", Cost: 0, CostUnattributed: true},
+			{Name: "a", Cost: 10},
+			{Name: "c", Cost: -1},
+			{Name: "b", Cost: 5},
+			{Name: "e", Cost: 0},
+		}
+		sortBuckets(buckets, test.keys)
+		var result []string
+		for _, bucket := range buckets {
+			result = append(result, bucket.Name)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("sortBuckets(): FAILED, Expected '%v' - Received '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestSortBucketsUnknownModified(t *testing.T) {
+	// An empty bucket and a bucket read from CloudWatch have no last modification date, and are not the oldest ones
+	buckets := []*s3.Bucket{
+		{Name: "empty"},
+		{Name: "new", LastModified: time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "cloudwatch", ObjectCount: 10, SizeBytes: 1000},
+		{Name: "old", LastModified: time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	sortBuckets(buckets, []sortKey{{field: "modified"}})
+	expected := []string{"old", "new", "cloudwatch", "empty"}
+	var result []string
+	for _, bucket := range buckets {
+		result = append(result, bucket.Name)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("sortBuckets(): FAILED, Expected '%v' - Received '%v'", expected, result)
+	}
+}
+
+func TestUnknownSortValuesMatchWhere(t *testing.T) {
+	created := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	buckets := []*s3.Bucket{
+		{Name: "known", Account: "123456789012", CreationDate: created, LastModified: created, Cost: 1, SecurityErrors: map[string]string{}},
+		{Name: "endpoint", Cost: -1},
+		{Name: "incomplete", Account: "123456789012", CreationDate: created, Incomplete: true},
+		{Name: "unattributed", Account: "123456789012", CreationDate: created, CostUnattributed: true},
+		{Name: "encryption", Account: "123456789012", CreationDate: created, SecurityErrors: map[string]string{s3.SecurityFieldEncryption: "AccessDenied"}},
+		{Name: "acl", Account: "123456789012", CreationDate: created, SecurityErrors: map[string]string{s3.SecurityFieldACL: "AccessDenied"}},
+		{Name: "policy", Account: "123456789012", CreationDate: created, SecurityErrors: map[string]string{s3.SecurityFieldPolicyStatus: "AccessDenied"}},
+	}
+
+	// Every sort field that is also a where field must be unknown for the same buckets, which sort last and never match a comparison
+	for field := range bucketComparators {
+		for _, bucket := range buckets {
+			unknown := false
+			if isUnknown, ok := unknownSortValues[field]; ok {
+				unknown = isUnknown(bucket)
+			}
+			if whereUnknown := s3.WhereFieldUnknown(bucket, field); unknown != whereUnknown {
+				t.Errorf("unknownSortValues(): FAILED, Expected the %v of the %v bucket to be unknown: %v - Received: %v", field, bucket.Name, whereUnknown, unknown)
+			}
+		}
+	}
+}
+
+func TestSortBucketsByStorageClassBytes(t *testing.T) {
+	buckets := []*s3.Bucket{
+		{Name: "a", StorageClassesBytes: map[string]int64{"STANDARD": 100}},
+		{Name: "b", StorageClassesBytes: map[string]int64{"GLACIER": 50, "STANDARD": 10}},
+		{Name: "c", StorageClassesBytes: map[string]int64{"GLACIER": 500}},
+	}
+
+	sortBuckets(buckets, []sortKey{{class: "GLACIER", field: "storageclassbytes", descending: true}})
+	expected := []string{"c", "b", "a"}
+	var result []string
+	for _, bucket := range buckets {
+		result = append(result, bucket.Name)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("sortBuckets(): FAILED, Expected '%v' - Received '%v'", expected, result)
+	}
+}
+
+func TestBucketComparators(t *testing.T) {
+	// Every valid sort field must have a comparator
+	for _, field := range validSortFlags {
+		if _, ok := bucketComparators[field]; !ok {
+			t.Errorf("bucketComparators: FAILED, Expected a comparator for the '%v' sort field", field)
+		}
+	}
+	if len(bucketComparators) != len(validSortFlags) {
+		t.Errorf("bucketComparators: FAILED, Expected %v comparators - Received %v", len(validSortFlags), len(bucketComparators))
+	}
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
 )
 
 // sizeMap contains the power of 1000 used to convert a byte value into another format, for example a kilobyte
@@ -20,10 +25,27 @@ var sizeMap = map[string]float64{
 }
 
 // validFilterFlags is a slice containing the valid filter flags that can be passed as cli arguments with '-filter'
-var validFilterFlags = []string{"name", "storageclasses"}
+var validFilterFlags = []string{"account", "name", "storageclasses"}
+
+// validMetricsSourceFlags is a slice containing the valid objects metrics sources that can be passed as cli arguments with '-metrics-source'
+var validMetricsSourceFlags = []string{"list", "cloudwatch", "auto", "inventory"}
+
+// storageClassBasisCount and storageClassBasisBytes are what the storage classes shares can be computed on with '-storage-class-basis'
+const (
+	storageClassBasisCount = "count"
+	storageClassBasisBytes = "bytes"
+)
+
+// validStorageClassBasisFlags is a slice containing the valid storage classes shares basis that can be passed as cli arguments with '-storage-class-basis'
+var validStorageClassBasisFlags = []string{storageClassBasisCount, storageClassBasisBytes}
+
+// validOutputFlags is a slice containing the valid output formats that can be passed as cli arguments with '-output'
+var validOutputFlags = []string{"table", "json", "ndjson", "csv", "markdown"}
 
 // validSortFlags is a slice containing the valid sorting flags that can be passed as cli auguments with '-sort'
-var validSortFlags = []string{"name", "region", "size", "files", "created", "modified", "cost"}
+// The noncurrentsize, noncurrentfiles and deletemarkers fields are only set when using '-versions'
+// and the encryption and public fields are only set when using '-security'
+var validSortFlags = []string{"name", "region", "size", "files", "created", "modified", "cost", "noncurrentsize", "noncurrentfiles", "deletemarkers", "encryption", "public", "account", "profile"}
 
 // exitErrorf receives an error string as well as any additional arguments, prints them all to Stderr and exit with code 1
 func exitErrorf(msg string, args ...interface{}) {
@@ -36,6 +58,42 @@ func printErrorf(msg string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, msg+"\n", args...)
 }
 
+// printRetriesSummary prints the number of requests retried and throttled per API, if any
+func printRetriesSummary(w io.Writer, stats []s3.APIStats) {
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Retries and throttles per API:")
+	for _, apiStats := range stats {
+		fmt.Fprintf(w, "  %v: %v retries, %v throttles\n", apiStats.API, apiStats.Retries, apiStats.Throttles)
+	}
+}
+
+// maxUnattributedValues is the number of tag values listed by printUnattributedCosts, the most costly ones
+const maxUnattributedValues = 5
+
+// printUnattributedCosts warns about the S3 costs of the target that could not be attributed to any of its buckets: the ones tagged with
+// values matching none of the buckets' names (e.g. a deleted bucket) and the ones without the cost allocation tag
+func printUnattributedCosts(w io.Writer, target, tag string, costs []s3.TagCost, untagged float64) {
+	if len(costs) > 0 {
+		total := 0.0
+		values := make([]string, 0, maxUnattributedValues+1)
+		for i, cost := range costs {
+			total += cost.Cost
+			if i < maxUnattributedValues {
+				values = append(values, fmt.Sprintf("%v ($%.2f)", cost.Value, cost.Cost))
+			}
+		}
+		if len(costs) > maxUnattributedValues {
+			values = append(values, fmt.Sprintf("%v more", len(costs)-maxUnattributedValues))
+		}
+		fmt.Fprintf(w, "Warning - $%.2f of the S3 costs of %v are tagged with values of the '%v' cost allocation tag matching none of its buckets: %v\n", total, target, tag, strings.Join(values, ", "))
+	}
+	if untagged > 0 {
+		fmt.Fprintf(w, "Warning - $%.2f of the S3 costs of %v are not tagged with the '%v' cost allocation tag\n", untagged, target, tag)
+	}
+}
+
 // convertSize converts a byte size into another format, for example a kilobyte, returning only the value and not the format code
 func convertSize(sizeBytes int64, sizeUnit string) float64 {
 	return float64(sizeBytes) / sizeMap[sizeUnit]
@@ -78,6 +136,36 @@ func validateSortFlag(sortFlag string) error {
 	return fmt.Errorf("Error - '%v' is not a valid '-sort' value", sortFlag)
 }
 
+// validateOutputFlag validates that the provided output format exists in the validOutputFlags slice
+func validateOutputFlag(output string) error {
+	for _, validOutput := range validOutputFlags {
+		if strings.ToLower(output) == validOutput {
+			return nil
+		}
+	}
+	return fmt.Errorf("Error - '%v' is not a valid '-output' value", output)
+}
+
+// validateMetricsSourceFlag validates that the provided metrics source exists in the validMetricsSourceFlags slice
+func validateMetricsSourceFlag(metricsSource string) error {
+	for _, validMetricsSource := range validMetricsSourceFlags {
+		if strings.ToLower(metricsSource) == validMetricsSource {
+			return nil
+		}
+	}
+	return fmt.Errorf("Error - '%v' is not a valid '-metrics-source' value", metricsSource)
+}
+
+// validateStorageClassBasisFlag validates that the provided basis exists in the validStorageClassBasisFlags slice
+func validateStorageClassBasisFlag(basis string) error {
+	for _, validBasis := range validStorageClassBasisFlags {
+		if strings.ToLower(basis) == validBasis {
+			return nil
+		}
+	}
+	return fmt.Errorf("Error - '%v' is not a valid '-storage-class-basis' value", basis)
+}
+
 // validateCostPeriodFlag validates that the provided costPeriod is between 1 and 365
 func validateCostPeriodFlag(costPeriod int) error {
 	if costPeriod > 365 || costPeriod < 1 {
@@ -86,19 +174,84 @@ func validateCostPeriodFlag(costPeriod int) error {
 	return nil
 }
 
-// validateWorkersFlag validates that the provided workers count is bigger than 0
-func validateWorkersFlag(workers int) error {
+// validateTimeoutFlag validates that the provided timeout, passed with the '-name' flag, is not negative
+func validateTimeoutFlag(name string, timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("Error - '%v' is not a valid '-%v' value, it must not be negative", timeout, name)
+	}
+	return nil
+}
+
+// validateMaxRetriesFlag validates that the provided number of retries is not negative
+func validateMaxRetriesFlag(retries int) error {
+	if retries < 0 {
+		return fmt.Errorf("Error - '%v' is not a valid '-max-retries' value, it must not be negative", retries)
+	}
+	return nil
+}
+
+// validateSampleFlag validates that the provided number of requests is either 0, to list every object, or at least s3.MinSampleRequests
+func validateSampleFlag(requests int) error {
+	if requests != 0 && requests < s3.MinSampleRequests {
+		return fmt.Errorf("Error - '%v' is not a valid '-sample' value, it must be 0 or at least %v", requests, s3.MinSampleRequests)
+	}
+	return nil
+}
+
+// validateUploadsOlderThanFlag validates that the provided number of days is not negative
+func validateUploadsOlderThanFlag(days int) error {
+	if days < 0 {
+		return fmt.Errorf("Error - '%v' is not a valid '-uploads-older-than' value, it must not be negative", days)
+	}
+	return nil
+}
+
+// validateWorkersFlag validates that the provided workers count of the name flag (workers or bucket-workers) is bigger than 0
+func validateWorkersFlag(name string, workers int) error {
 	if workers < 1 {
-		return fmt.Errorf("Error - '%v' is not a valid '-workers' value, it must be bigger than 0", workers)
+		return fmt.Errorf("Error - '%v' is not a valid '-%v' value, it must be bigger than 0", workers, name)
 	}
 	return nil
 }
 
 // formatStorageClasses takes all the storage classes as well as their usage statistics and build a string containing this information
+// The classes are ordered by usage, then by name, so that the output is stable between runs
 func formatStorageClasses(storageClasses map[string]float64) string {
+	classes := make([]string, 0, len(storageClasses))
+	for class := range storageClasses {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if storageClasses[classes[i]] != storageClasses[classes[j]] {
+			return storageClasses[classes[i]] < storageClasses[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
+	b := new(bytes.Buffer)
+	for _, class := range classes {
+		fmt.Fprintf(b, "%s(%.1f%%) ", class, storageClasses[class])
+	}
+	return b.String()
+}
+
+// formatStorageClassesSize takes the size in bytes of every storage class and builds a string containing the sizes in the provided unit
+// The classes are ordered by size, then by name, so that the output is stable between runs
+func formatStorageClassesSize(storageClasses map[string]int64, sizeUnit string) string {
+	classes := make([]string, 0, len(storageClasses))
+	for class := range storageClasses {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if storageClasses[classes[i]] != storageClasses[classes[j]] {
+			return storageClasses[classes[i]] < storageClasses[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
 	b := new(bytes.Buffer)
-	for class, value := range storageClasses {
-		fmt.Fprintf(b, "%s(%.1f%%) ", class, value)
+	for _, class := range classes {
+		fmt.Fprintf(b, "%s(%.2f) ", class, convertSize(storageClasses[class], sizeUnit))
 	}
 	return b.String()
 }
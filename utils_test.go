@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cocotton/bucket-digger/s3"
+)
 
 func TestConvertSize(t *testing.T) {
 	var tests = []struct {
@@ -108,6 +114,97 @@ func TestValidateSortFlag(t *testing.T) {
 	}
 }
 
+func TestValidateOutputFlag(t *testing.T) {
+	var tests = []struct {
+		output string
+		err    bool
+	}{
+		{
+			output: "table",
+			err:    false,
+		},
+		{
+			output: "NDJSON",
+			err:    false,
+		},
+		{
+			output: "xml",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateOutputFlag(test.output)
+		if err != nil && test.err == false {
+			t.Errorf("validateOutputFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateOutputFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
+func TestValidateMetricsSourceFlag(t *testing.T) {
+	var tests = []struct {
+		metricsSource string
+		err           bool
+	}{
+		{
+			metricsSource: "list",
+			err:           false,
+		},
+		{
+			metricsSource: "CloudWatch",
+			err:           false,
+		},
+		{
+			metricsSource: "Inventory",
+			err:           false,
+		},
+		{
+			metricsSource: "listing",
+			err:           true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateMetricsSourceFlag(test.metricsSource)
+		if err != nil && test.err == false {
+			t.Errorf("validateMetricsSourceFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateMetricsSourceFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
+func TestValidateStorageClassBasisFlag(t *testing.T) {
+	var tests = []struct {
+		basis string
+		err   bool
+	}{
+		{
+			basis: "count",
+			err:   false,
+		},
+		{
+			basis: "Bytes",
+			err:   false,
+		},
+		{
+			basis: "size",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateStorageClassBasisFlag(test.basis)
+		if err != nil && test.err == false {
+			t.Errorf("validateStorageClassBasisFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateStorageClassBasisFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
 func TestValidateCostPeriodFlag(t *testing.T) {
 	var tests = []struct {
 		costPeriod int
@@ -166,6 +263,64 @@ func TestValidateLimitFlag(t *testing.T) {
 	}
 }
 
+func TestValidateTimeoutFlag(t *testing.T) {
+	var tests = []struct {
+		timeout time.Duration
+		err     bool
+	}{
+		{
+			timeout: 10 * time.Minute,
+			err:     false,
+		},
+		{
+			timeout: 0,
+			err:     false,
+		},
+		{
+			timeout: -time.Second,
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateTimeoutFlag("timeout", test.timeout)
+		if err != nil && test.err == false {
+			t.Errorf("validateTimeoutFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateTimeoutFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
+func TestValidateUploadsOlderThanFlag(t *testing.T) {
+	var tests = []struct {
+		days int
+		err  bool
+	}{
+		{
+			days: 7,
+			err:  false,
+		},
+		{
+			days: 0,
+			err:  false,
+		},
+		{
+			days: -1,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateUploadsOlderThanFlag(test.days)
+		if err != nil && test.err == false {
+			t.Errorf("validateUploadsOlderThanFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateUploadsOlderThanFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
 func TestValidateWorkersFlag(t *testing.T) {
 	var tests = []struct {
 		workers int
@@ -186,7 +341,7 @@ func TestValidateWorkersFlag(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		err := validateWorkersFlag(test.workers)
+		err := validateWorkersFlag("workers", test.workers)
 		if err != nil && test.err == false {
 			t.Errorf("validateWorkersFlag(): FAILED, Expected no error - Received: %v", err)
 		} else if err == nil && test.err {
@@ -195,6 +350,100 @@ func TestValidateWorkersFlag(t *testing.T) {
 	}
 }
 
+func TestValidateMaxRetriesFlag(t *testing.T) {
+	var tests = []struct {
+		retries int
+		err     bool
+	}{
+		{
+			retries: 0,
+			err:     false,
+		},
+		{
+			retries: 5,
+			err:     false,
+		},
+		{
+			retries: -1,
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateMaxRetriesFlag(test.retries)
+		if err != nil && test.err == false {
+			t.Errorf("validateMaxRetriesFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateMaxRetriesFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
+func TestPrintRetriesSummary(t *testing.T) {
+	var b bytes.Buffer
+	printRetriesSummary(&b, nil)
+	if b.Len() != 0 {
+		t.Errorf("printRetriesSummary(): FAILED, Expected nothing without retries - Received: '%v'", b.String())
+	}
+
+	printRetriesSummary(&b, []s3.APIStats{{API: "ce GetCostAndUsage", Retries: 4, Throttles: 5}, {API: "s3 ListObjectsV2", Retries: 1}})
+	expected := "Retries and throttles per API:\n" +
+		"  ce GetCostAndUsage: 4 retries, 5 throttles\n" +
+		"  s3 ListObjectsV2: 1 retries, 0 throttles\n"
+	if b.String() != expected {
+		t.Errorf("printRetriesSummary(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestPrintUnattributedCosts(t *testing.T) {
+	var b bytes.Buffer
+	printUnattributedCosts(&b, "profile prod", "name", nil, 0)
+	if b.Len() != 0 {
+		t.Errorf("printUnattributedCosts(): FAILED, Expected nothing without unattributed costs - Received: '%v'", b.String())
+	}
+
+	costs := []s3.TagCost{{Cost: 10, Value: "a"}, {Cost: 5, Value: "b"}, {Cost: 4, Value: "c"}, {Cost: 3, Value: "d"}, {Cost: 2, Value: "e"}, {Cost: 1, Value: "f"}, {Cost: 0.5, Value: "g"}}
+	printUnattributedCosts(&b, "profile prod", "name", costs, 1.25)
+	expected := "Warning - $25.50 of the S3 costs of profile prod are tagged with values of the 'name' cost allocation tag matching none of its buckets: a ($10.00), b ($5.00), c ($4.00), d ($3.00), e ($2.00), 2 more\n" +
+		"Warning - $1.25 of the S3 costs of profile prod are not tagged with the 'name' cost allocation tag\n"
+	if b.String() != expected {
+		t.Errorf("printUnattributedCosts(): FAILED, Expected: '%v' - Received: '%v'", expected, b.String())
+	}
+}
+
+func TestValidateSampleFlag(t *testing.T) {
+	var tests = []struct {
+		requests int
+		err      bool
+	}{
+		{
+			requests: 0,
+			err:      false,
+		},
+		{
+			requests: 200,
+			err:      false,
+		},
+		{
+			requests: 5,
+			err:      true,
+		},
+		{
+			requests: -10,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateSampleFlag(test.requests)
+		if err != nil && test.err == false {
+			t.Errorf("validateSampleFlag(): FAILED, Expected no error - Received: %v", err)
+		} else if err == nil && test.err {
+			t.Errorf("validateSampleFlag(): FAILED, Expected an error - Received: %v", err)
+		}
+	}
+}
+
 func TestFormatStorageClasses(t *testing.T) {
 	var emptyFloat float64
 	var tests = []struct {